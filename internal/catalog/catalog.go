@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"mp3tools/internal/encoder"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+)
+
+// Record is one row of the tag database: the tags and technical properties of a file
+type Record struct {
+	File    scanner.AudioFile
+	Size    int64
+	ModTime time.Time
+	Hash    string           // SHA-256 of the audio payload (tags excluded), see mpeg.HashAudio
+	Meta    *tagger.Metadata // Meta.Audio is nil if the stream could not be analyzed
+	Charset string           // Charset the tag text was detected in (UTF-8 if it needs no conversion, empty without text)
+}
+
+// Read reads the tags, technical properties and audio hash of a file
+func Read(file scanner.AudioFile) (*Record, error) {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := tagger.ReadTags(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	// A broken stream still exports its tags, the technical columns stay empty
+	meta.ReadAudio(file.Path)
+	hash, _, err := mpeg.HashAudio(file.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Record{
+		File:    file,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+		Meta:    meta,
+		Charset: DetectCharset(meta),
+	}, nil
+}
+
+// DetectCharset returns the legacy charset of the first text field that needs an encoding fix,
+// UTF-8 if none does, or an empty string if the tags have no text
+func DetectCharset(meta *tagger.Metadata) string {
+	text := false
+	for _, value := range []string{meta.Title, meta.Artist, meta.Album, meta.Genre, meta.Comment} {
+		if value == "" {
+			continue
+		}
+		text = true
+		if _, charset, changed := encoder.FixEncoding(value); changed {
+			return charset
+		}
+	}
+	if !text {
+		return ""
+	}
+	return "UTF-8"
+}
+
+// Collect reads the records of files with a worker pool.
+// Records are returned in file order; files that fail to read are returned as errors.
+func Collect(files []scanner.AudioFile, threads int) ([]*Record, []error) {
+	records := make([]*Record, len(files))
+	failures := make([]error, len(files))
+	workers.Run(len(files), threads, func(index int) {
+		record, err := Read(files[index])
+		if err != nil {
+			failures[index] = fmt.Errorf("failed to read %s: %w", files[index].Path, err)
+			return
+		}
+		records[index] = record
+	})
+
+	var result []*Record
+	var errs []error
+	for i := range files {
+		if records[i] != nil {
+			result = append(result, records[i])
+		} else {
+			errs = append(errs, failures[i])
+		}
+	}
+	return result, errs
+}
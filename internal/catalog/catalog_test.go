@@ -0,0 +1,298 @@
+package catalog
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+
+	"github.com/bogem/id3v2/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// testRecords returns a record with full properties and one whose stream could not be analyzed
+func testRecords() []*Record {
+	return []*Record{
+		{
+			File:    scanner.AudioFile{Path: "/music/白眉大侠/01.mp3", RelPath: filepath.Join("白眉大侠", "01.mp3")},
+			Size:    1024,
+			ModTime: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			Hash:    "abc",
+			Meta: &tagger.Metadata{
+				Title: "第一回, \"徐良\"", Artist: "单田芳", Album: "白眉大侠", Year: 2001, Track: 1,
+				Format: "MP3", HasPicture: true,
+				Audio: &mpeg.Properties{
+					Version: mpeg.Version1, Layer: 3, SampleRate: 44100, ChannelMode: mpeg.JointStereo,
+					Bitrate: 64, Duration: 1500*time.Millisecond + 400*time.Microsecond, Frames: 58, Source: mpeg.SourceFrames,
+				},
+			},
+			Charset: "UTF-8",
+		},
+		{
+			File:    scanner.AudioFile{Path: "/music/broken.mp3", RelPath: "broken.mp3"},
+			ModTime: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+			Meta:    &tagger.Metadata{},
+		},
+	}
+}
+
+func export(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	exporter, err := Create("", format, &buf)
+	if err != nil {
+		t.Fatalf("Failed to create %s exporter: %v", format, err)
+	}
+	for _, record := range testRecords() {
+		if err := exporter.Write(record); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	return buf.String()
+}
+
+func TestExportCSV(t *testing.T) {
+	text := export(t, FormatCSV)
+	if !strings.HasPrefix(text, "\uFEFFpath,size,mtime,hash,title,") {
+		t.Fatalf("Expected a BOM and header row, got %q", text[:40])
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(text, "\uFEFF"))).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d (%v)", len(rows), err)
+	}
+	row := make(map[string]string)
+	for i, name := range rows[0] {
+		row[name] = rows[1][i]
+	}
+	expected := map[string]string{
+		"path": "白眉大侠/01.mp3", "mtime": "2024-05-01T12:30:00Z", "title": "第一回, \"徐良\"",
+		"year": "2001", "genre": "", "has_picture": "true", "channel_mode": "Joint stereo",
+		"duration": "1.5", "vbr": "false",
+	}
+	for name, value := range expected {
+		if row[name] != value {
+			t.Errorf("Column %s: expected %q, got %q", name, value, row[name])
+		}
+	}
+	if rows[2][7] != "" || rows[2][len(rows[2])-1] != "" {
+		t.Errorf("Expected empty year and technical columns, got %q", rows[2])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(export(t, FormatJSONL)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], `{"path":"白眉大侠/01.mp3","size":1024,`) {
+		t.Errorf("Expected keys in column order, got %s", lines[0])
+	}
+	var row map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if row["year"] != nil || row["bitrate"] != nil || row["has_picture"] != false {
+		t.Errorf("Expected nulls for missing values, got %v", row)
+	}
+}
+
+func TestExportSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.db")
+	// A second export replaces the table instead of failing on the primary key
+	for i := 0; i < 2; i++ {
+		exporter, err := Create(path, FormatSQLite, nil)
+		if err != nil {
+			t.Fatalf("Failed to create database: %v", err)
+		}
+		for _, record := range testRecords() {
+			if err := exporter.Write(record); err != nil {
+				t.Fatalf("Failed to insert: %v", err)
+			}
+		}
+		if err := exporter.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	var artist string
+	var year, bitrate sql.NullInt64
+	db.QueryRow("SELECT COUNT(*) FROM files").Scan(&count)
+	db.QueryRow("SELECT artist, year, bitrate FROM files WHERE path = ?", "白眉大侠/01.mp3").Scan(&artist, &year, &bitrate)
+	if count != 2 || artist != "单田芳" || year.Int64 != 2001 || bitrate.Int64 != 64 {
+		t.Errorf("Unexpected rows: count %d, artist %q, year %v, bitrate %v", count, artist, year, bitrate)
+	}
+	db.QueryRow("SELECT year FROM files WHERE path = 'broken.mp3'").Scan(&year)
+	if year.Valid {
+		t.Errorf("Expected NULL year, got %v", year)
+	}
+
+	if _, err := Create("", FormatSQLite, nil); err == nil {
+		t.Error("Expected an error for SQLite without an output file")
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("白眉大侠 第一回 徐良出世，单田芳播讲的评书")
+	tests := []struct {
+		meta     tagger.Metadata
+		expected string
+	}{
+		{tagger.Metadata{}, ""},
+		{tagger.Metadata{Title: "Intro", Artist: "单田芳"}, "UTF-8"},
+		{tagger.Metadata{Title: "Intro", Album: gbk}, "GB-18030"},
+	}
+	for _, tt := range tests {
+		if got := DetectCharset(&tt.meta); got != tt.expected {
+			t.Errorf("DetectCharset(%+v) = %q, expected %q", tt.meta, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"tags.csv": FormatCSV, "tags.JSONL": FormatJSONL, "tags.db": FormatSQLite, "tags": FormatCSV,
+	} {
+		if got := FormatFromPath(path); got != expected {
+			t.Errorf("FormatFromPath(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "tags.csv")
+	os.WriteFile(csvPath, []byte("\uFEFFPath,title,year,track,rating\n"+
+		"a.mp3,\"Line 1\r\nLine 2\",2001.0,,5\n"+
+		",No key,,,\n"+
+		"b.mp3,B,,x,\n"), 0644)
+
+	table, err := Load(csvPath)
+	if err != nil {
+		t.Fatalf("Failed to load CSV: %v", err)
+	}
+	if len(table.Rows) != 3 || len(table.Unknown) != 1 || table.Unknown[0] != "rating" {
+		t.Fatalf("Expected 3 rows and the unknown column rating, got %d rows, %q", len(table.Rows), table.Unknown)
+	}
+	row := table.Rows[0]
+	if row.Err != nil || row.Values["path"] != "a.mp3" || row.Values["year"] != "2001" || row.Values["track"] != "" {
+		t.Errorf("Unexpected first row: %+v", row)
+	}
+	if table.Rows[1].Err == nil || table.Rows[2].Err == nil {
+		t.Errorf("Expected rows without a key or with a bad track to be invalid, got %v, %v", table.Rows[1].Err, table.Rows[2].Err)
+	}
+
+	jsonPath := filepath.Join(dir, "tags.jsonl")
+	os.WriteFile(jsonPath, []byte(`{"path":"a.mp3","year":null,"track":3,"extra":true}`+"\n\n"+`{"hash":"abc","artist":"单田芳"}`+"\n"), 0644)
+	table, err = Load(jsonPath)
+	if err != nil {
+		t.Fatalf("Failed to load JSON Lines: %v", err)
+	}
+	if len(table.Rows) != 2 || table.Rows[1].Line != 3 || len(table.Unknown) != 1 {
+		t.Fatalf("Expected 2 rows and 1 unknown column, got %+v, %q", table.Rows, table.Unknown)
+	}
+	if year, ok := table.Rows[0].Values["year"]; !ok || year != "" || table.Rows[0].Values["track"] != "3" {
+		t.Errorf("Expected null year and numeric track, got %v", table.Rows[0].Values)
+	}
+
+	meta := &tagger.Metadata{Title: "Old", Year: 2001, Comment: "Line 1\r\nLine 2"}
+	row = &Row{Values: map[string]string{"path": "a.mp3", "title": "New", "year": "", "comment": "Line 1\nLine 2"}}
+	edits := row.Apply(meta)
+	if len(edits) != 2 || edits[0] != (FieldEdit{"title", "Old", "New"}) || edits[1] != (FieldEdit{"year", "2001", ""}) {
+		t.Errorf("Expected title and year edits only, got %+v", edits)
+	}
+}
+
+// writeTagged writes a file with an ID3v2 title tag followed by audio bytes
+func writeTagged(t *testing.T, path, title, audio string) {
+	t.Helper()
+	tag := id3v2.NewEmptyTag()
+	tag.SetVersion(4)
+	tag.SetTitle(title)
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(audio)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	writeTagged(t, filepath.Join(dir, "a.mp3"), "A", "audio a")
+	writeTagged(t, filepath.Join(dir, "sub", "moved.mp3"), "B", "audio b")
+	writeTagged(t, filepath.Join(dir, "c.mp3"), "C", "audio c")
+	writeTagged(t, filepath.Join(dir, "d.mp3"), "D", "audio d")
+	files, err := scanner.ScanDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, _, _ := mpeg.HashAudio(filepath.Join(dir, "sub", "moved.mp3"))
+	stale := time.Now().Add(-time.Hour).Format(time.RFC3339)
+
+	table := &Table{Rows: []*Row{
+		{Line: 1, Values: map[string]string{"path": "a.mp3", "title": "A2"}},
+		{Line: 2, Values: map[string]string{"path": "b.mp3", "hash": hashB, "title": "B2"}},
+		{Line: 3, Values: map[string]string{"path": "gone.mp3", "hash": "0000"}},
+		{Line: 4, Values: map[string]string{"path": "c.mp3", "title": "C2"}},
+		{Line: 5, Values: map[string]string{"path": "c.mp3", "title": "C3"}},
+		{Line: 6, Values: map[string]string{"path": "d.mp3", "title": "D2", "mtime": stale}},
+		{Line: 7, Values: map[string]string{"path": "d.mp3", "title": "D", "mtime": stale}, Err: os.ErrInvalid},
+	}}
+	result, err := MatchFiles(table, files, 2, false)
+	if err != nil {
+		t.Fatalf("Failed to match: %v", err)
+	}
+
+	matched := make(map[int]string)
+	for _, match := range result.Matches {
+		matched[match.Row.Line] = RelPath(match.File) + " by " + match.By
+	}
+	if len(matched) != 2 || matched[1] != "a.mp3 by path" || matched[2] != "sub/moved.mp3 by hash" {
+		t.Errorf("Unexpected matches: %v", matched)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].Line != 3 {
+		t.Errorf("Expected row 3 missing, got %+v", result.Missing)
+	}
+	if len(result.Invalid) != 1 || result.Invalid[0].Line != 7 {
+		t.Errorf("Expected row 7 invalid, got %+v", result.Invalid)
+	}
+	var conflicts []int
+	for _, conflict := range result.Conflicts {
+		conflicts = append(conflicts, conflict.Row.Line)
+	}
+	if len(conflicts) != 3 || conflicts[0] != 4 || conflicts[1] != 5 || conflicts[2] != 6 {
+		t.Errorf("Expected rows 4 and 5 (same file) and 6 (modified since export) to conflict, got %v", conflicts)
+	}
+
+	// Forcing imports the stale row, an unchanged stale row is never a conflict
+	table.Rows = table.Rows[5:6]
+	if result, _ := MatchFiles(table, files, 2, true); len(result.Matches) != 1 {
+		t.Errorf("Expected the stale row to match with force, got %+v", result)
+	}
+	table.Rows[0].Values["title"] = "D"
+	if result, _ := MatchFiles(table, files, 2, false); len(result.Matches) != 1 {
+		t.Errorf("Expected an unchanged stale row to match, got %+v", result)
+	}
+}
@@ -0,0 +1,315 @@
+package catalog
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/scanner"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver
+)
+
+// Export formats
+const (
+	FormatCSV    = "csv"    // UTF-8 with BOM so Excel detects the encoding
+	FormatJSONL  = "jsonl"  // One JSON object per line
+	FormatSQLite = "sqlite" // Table "files" in a SQLite database
+)
+
+// ErrUnknownFormat is returned for formats other than the Format* values
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// utf8BOM starts CSV files so spreadsheets don't read them as the local code page
+const utf8BOM = "\uFEFF"
+
+// Column types, used for the SQLite schema
+const (
+	typeText    = "TEXT"
+	typeInteger = "INTEGER"
+	typeReal    = "REAL"
+)
+
+// column is one field of the tag database.
+// value returns a string, int, int64, float64, bool or nil for a missing value.
+type column struct {
+	name  string
+	kind  string
+	value func(r *Record) any
+}
+
+// columns lists every exported field in output order
+var columns = []column{
+	{"path", typeText, func(r *Record) any { return RelPath(r.File) }},
+	{"size", typeInteger, func(r *Record) any { return r.Size }},
+	{"mtime", typeText, func(r *Record) any { return r.ModTime.Format(time.RFC3339) }},
+	{"hash", typeText, func(r *Record) any { return r.Hash }},
+	{"title", typeText, func(r *Record) any { return r.Meta.Title }},
+	{"artist", typeText, func(r *Record) any { return r.Meta.Artist }},
+	{"album", typeText, func(r *Record) any { return r.Meta.Album }},
+	{"year", typeInteger, func(r *Record) any { return nonZero(r.Meta.Year) }},
+	{"genre", typeText, func(r *Record) any { return r.Meta.Genre }},
+	{"track", typeInteger, func(r *Record) any { return nonZero(r.Meta.Track) }},
+	{"comment", typeText, func(r *Record) any { return r.Meta.Comment }},
+	{"format", typeText, func(r *Record) any { return string(r.Meta.Format) }},
+	{"has_picture", typeInteger, func(r *Record) any { return r.Meta.HasPicture }},
+	{"charset", typeText, func(r *Record) any { return r.Charset }},
+	{"version", typeText, audio(func(r *Record) any { return r.Meta.Audio.Version.String() })},
+	{"layer", typeInteger, audio(func(r *Record) any { return r.Meta.Audio.Layer })},
+	{"sample_rate", typeInteger, audio(func(r *Record) any { return r.Meta.Audio.SampleRate })},
+	{"channel_mode", typeText, audio(func(r *Record) any { return r.Meta.Audio.ChannelMode.String() })},
+	{"bitrate", typeInteger, audio(func(r *Record) any { return r.Meta.Audio.Bitrate })},
+	{"vbr", typeInteger, audio(func(r *Record) any { return r.Meta.Audio.VBR })},
+	{"duration", typeReal, audio(func(r *Record) any {
+		return math.Round(r.Meta.Audio.Duration.Seconds()*1000) / 1000
+	})},
+	{"frames", typeInteger, audio(func(r *Record) any { return r.Meta.Audio.Frames })},
+	{"encoder", typeText, audio(func(r *Record) any { return r.Meta.Audio.Encoder })},
+	{"length_source", typeText, audio(func(r *Record) any { return r.Meta.Audio.Source })},
+}
+
+// Columns returns the names of the exported fields in output order
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// RelPath returns the path a record is keyed by: the slash-separated path relative to the
+// scanned directory, or the file name when a single file was scanned
+func RelPath(file scanner.AudioFile) string {
+	if file.RelPath == "." {
+		return filepath.Base(file.Path)
+	}
+	return filepath.ToSlash(file.RelPath)
+}
+
+// nonZero returns nil for an unset numeric tag
+func nonZero(n int) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// audio wraps a technical property so it is nil when the stream could not be analyzed
+func audio(value func(r *Record) any) func(r *Record) any {
+	return func(r *Record) any {
+		if r.Meta.Audio == nil {
+			return nil
+		}
+		return value(r)
+	}
+}
+
+// FormatFromPath guesses the export format from a file extension, defaulting to CSV
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL
+	case ".db", ".sqlite", ".sqlite3":
+		return FormatSQLite
+	default:
+		return FormatCSV
+	}
+}
+
+// Exporter writes records to a tag database
+type Exporter interface {
+	Write(r *Record) error
+	Close() error
+}
+
+// Create opens an exporter writing to path, or to w for CSV and JSON Lines when path is empty.
+// An existing SQLite database gets its files table replaced.
+func Create(path, format string, w io.Writer) (Exporter, error) {
+	switch format {
+	case FormatCSV, FormatJSONL:
+	case FormatSQLite:
+		if path == "" {
+			return nil, fmt.Errorf("the %s format needs an output file", format)
+		}
+		return createSQLite(path)
+	default:
+		return nil, fmt.Errorf("%w %q (use csv, jsonl or sqlite)", ErrUnknownFormat, format)
+	}
+
+	var closer io.Closer
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		w, closer = f, f
+	}
+	buf := bufio.NewWriter(w)
+	if format == FormatJSONL {
+		return &jsonExporter{buf: buf, closer: closer}, nil
+	}
+
+	if _, err := buf.WriteString(utf8BOM); err != nil {
+		return nil, err
+	}
+	exporter := &csvExporter{buf: buf, closer: closer, w: csv.NewWriter(buf)}
+	if err := exporter.w.Write(Columns()); err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+// finish flushes a text exporter and closes its file
+func finish(buf *bufio.Writer, closer io.Closer) error {
+	err := buf.Flush()
+	if closer != nil {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// csvExporter writes a header row followed by one row per record
+type csvExporter struct {
+	buf    *bufio.Writer
+	closer io.Closer
+	w      *csv.Writer
+}
+
+func (e *csvExporter) Write(r *Record) error {
+	row := make([]string, len(columns))
+	for i, col := range columns {
+		row[i] = formatValue(col.value(r))
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return err
+	}
+	return finish(e.buf, e.closer)
+}
+
+// formatValue renders a column value as CSV text
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonExporter writes one object per record with the keys in column order
+type jsonExporter struct {
+	buf    *bufio.Writer
+	closer io.Closer
+}
+
+func (e *jsonExporter) Write(r *Record) error {
+	e.buf.WriteByte('{')
+	for i, col := range columns {
+		if i > 0 {
+			e.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(col.name)
+		value, err := json.Marshal(col.value(r))
+		if err != nil {
+			return err
+		}
+		e.buf.Write(key)
+		e.buf.WriteByte(':')
+		e.buf.Write(value)
+	}
+	_, err := e.buf.WriteString("}\n")
+	return err
+}
+
+func (e *jsonExporter) Close() error {
+	return finish(e.buf, e.closer)
+}
+
+// sqliteExporter inserts records into the files table within one transaction
+type sqliteExporter struct {
+	db   *sql.DB
+	tx   *sql.Tx
+	stmt *sql.Stmt
+}
+
+// createSQLite opens the database and recreates the files table
+func createSQLite(path string) (Exporter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	defs := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = col.name + " " + col.kind
+		placeholders[i] = "?"
+	}
+	defs[0] += " PRIMARY KEY"
+	schema := []string{
+		"DROP TABLE IF EXISTS files",
+		fmt.Sprintf("CREATE TABLE files (%s)", strings.Join(defs, ", ")),
+		"CREATE INDEX files_hash ON files (hash)",
+	}
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create table in %s: %w", path, err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO files (%s) VALUES (%s)",
+		strings.Join(Columns(), ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		tx.Rollback()
+		db.Close()
+		return nil, err
+	}
+	return &sqliteExporter{db: db, tx: tx, stmt: stmt}, nil
+}
+
+func (e *sqliteExporter) Write(r *Record) error {
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = col.value(r)
+	}
+	_, err := e.stmt.Exec(values...)
+	return err
+}
+
+func (e *sqliteExporter) Close() error {
+	e.stmt.Close()
+	err := e.tx.Commit()
+	if closeErr := e.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,358 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+)
+
+// Editable lists the columns import writes back to the tags; other known columns are read-only
+var Editable = []string{"title", "artist", "album", "year", "genre", "track", "comment"}
+
+// How a row was matched to a file
+const (
+	ByPath = "path"
+	ByHash = "hash"
+)
+
+// Row is one record of an edited tag database
+type Row struct {
+	Line   int               // Line (JSON Lines) or record number (CSV, header excluded) for reports
+	Values map[string]string // Cells of known columns; missing cells leave the field untouched
+	Err    error             // Invalid cell, the row is not imported
+}
+
+// Table is an edited tag database read by Load
+type Table struct {
+	Rows    []*Row
+	Unknown []string // Columns that are neither exported nor editable, ignored
+}
+
+// Load reads a tag database written by export (and edited since) in CSV or JSON Lines format,
+// chosen by the file extension. Empty cells clear a field, absent columns leave it untouched.
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	data = bytes.TrimPrefix(data, []byte(utf8BOM))
+
+	var table *Table
+	switch format := FormatFromPath(path); format {
+	case FormatCSV:
+		table, err = parseCSV(data)
+	case FormatJSONL:
+		table, err = parseJSONL(data)
+	default:
+		return nil, fmt.Errorf("can't import %s: use a csv or jsonl file", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return table, nil
+}
+
+// parseCSV reads a header row followed by one row per file
+func parseCSV(data []byte) (*Table, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing header row")
+	}
+
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	table := &Table{}
+	known := knownColumns()
+	seen := make(map[string]bool)
+	for _, name := range header {
+		if !known[name] && !seen[name] {
+			table.Unknown = append(table.Unknown, name)
+		}
+		seen[name] = true
+	}
+
+	for i, record := range records[1:] {
+		row := &Row{Line: i + 1, Values: make(map[string]string)}
+		for j, value := range record {
+			if j < len(header) && known[header[j]] {
+				row.Values[header[j]] = value
+			}
+		}
+		row.validate()
+		table.Rows = append(table.Rows, row)
+	}
+	return table, nil
+}
+
+// parseJSONL reads one object per line; null is an empty cell
+func parseJSONL(data []byte) (*Table, error) {
+	table := &Table{}
+	known := knownColumns()
+	unknown := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := &Row{Line: line, Values: make(map[string]string)}
+		var object map[string]any
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %w", err)
+			table.Rows = append(table.Rows, row)
+			continue
+		}
+		for key, value := range object {
+			key = strings.ToLower(key)
+			if !known[key] {
+				if !unknown[key] {
+					unknown[key] = true
+					table.Unknown = append(table.Unknown, key)
+				}
+				continue
+			}
+			switch v := value.(type) {
+			case nil:
+				row.Values[key] = ""
+			case string:
+				row.Values[key] = v
+			default:
+				row.Values[key] = formatValue(v)
+			}
+		}
+		row.validate()
+		table.Rows = append(table.Rows, row)
+	}
+	sort.Strings(table.Unknown)
+	return table, scanner.Err()
+}
+
+// knownColumns returns the set of exported column names
+func knownColumns() map[string]bool {
+	known := make(map[string]bool)
+	for _, col := range columns {
+		known[col.name] = true
+	}
+	return known
+}
+
+// validate checks that the row has a key and that numeric fields are numbers
+func (r *Row) validate() {
+	if r.Err != nil {
+		return
+	}
+	if r.Values["path"] == "" && r.Values["hash"] == "" {
+		r.Err = fmt.Errorf("no path or hash")
+		return
+	}
+	for _, field := range []string{"year", "track"} {
+		value, ok := r.Values[field]
+		if !ok || value == "" {
+			continue
+		}
+		// Spreadsheets like to turn 2001 into 2001.0
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || n != float64(int(n)) || n < 0 {
+			r.Err = fmt.Errorf("%s %q is not a number", field, value)
+			return
+		}
+		r.Values[field] = strconv.Itoa(int(n))
+	}
+}
+
+// Apply returns the editable fields of the row that differ from meta, in Editable order
+func (r *Row) Apply(meta *tagger.Metadata) []FieldEdit {
+	current := map[string]string{
+		"title":   meta.Title,
+		"artist":  meta.Artist,
+		"album":   meta.Album,
+		"year":    formatValue(nonZero(meta.Year)),
+		"genre":   meta.Genre,
+		"track":   formatValue(nonZero(meta.Track)),
+		"comment": meta.Comment,
+	}
+
+	var edits []FieldEdit
+	for _, field := range Editable {
+		value, ok := r.Values[field]
+		// CSV readers and spreadsheets turn CRLF line breaks into LF
+		if ok && normalizeNewlines(value) != normalizeNewlines(current[field]) {
+			edits = append(edits, FieldEdit{Field: field, Old: current[field], New: value})
+		}
+	}
+	return edits
+}
+
+// normalizeNewlines converts CRLF line breaks to LF
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// FieldEdit is a field whose imported value differs from the file's tag
+type FieldEdit struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Match is a row matched to a file
+type Match struct {
+	Row  *Row
+	File scanner.AudioFile
+	By   string // ByPath or ByHash
+}
+
+// Problem is a row that is not imported
+type Problem struct {
+	Row    *Row
+	File   *scanner.AudioFile // Matched file, nil if none
+	Reason string
+}
+
+// Result is the outcome of matching a table against the scanned files
+type Result struct {
+	Matches   []Match
+	Missing   []*Row    // Rows whose path and hash match no file
+	Conflicts []Problem // Rows for a file that another row also edits, ambiguous hashes and files changed since the export
+	Invalid   []*Row    // Rows with Err set
+}
+
+// MatchFiles matches rows to files by relative path, then by audio hash for rows whose path is
+// gone (renamed or moved files). Files modified after the row's mtime are conflicts when the row
+// would change their tags, unless force is set, so edits made since the export aren't reverted.
+func MatchFiles(table *Table, files []scanner.AudioFile, threads int, force bool) (*Result, error) {
+	result := &Result{}
+	byPath := make(map[string]scanner.AudioFile)
+	for _, file := range files {
+		byPath[RelPath(file)] = file
+	}
+
+	var byHash map[string][]scanner.AudioFile
+	var matches []Match
+	for _, row := range table.Rows {
+		if row.Err != nil {
+			result.Invalid = append(result.Invalid, row)
+			continue
+		}
+		if file, ok := byPath[row.Values["path"]]; ok {
+			matches = append(matches, Match{Row: row, File: file, By: ByPath})
+			continue
+		}
+
+		hash := row.Values["hash"]
+		if hash == "" {
+			result.Missing = append(result.Missing, row)
+			continue
+		}
+		if byHash == nil {
+			byHash = hashFiles(files, threads)
+		}
+		switch candidates := byHash[hash]; len(candidates) {
+		case 0:
+			result.Missing = append(result.Missing, row)
+		case 1:
+			matches = append(matches, Match{Row: row, File: candidates[0], By: ByHash})
+		default:
+			result.Conflicts = append(result.Conflicts, Problem{
+				Row:    row,
+				Reason: fmt.Sprintf("hash matches %d files", len(candidates)),
+			})
+		}
+	}
+
+	// Several rows for one file can't all win
+	rowsPerFile := make(map[string]int)
+	for _, match := range matches {
+		rowsPerFile[match.File.Path]++
+	}
+	for _, match := range matches {
+		file := match.File
+		if n := rowsPerFile[file.Path]; n > 1 {
+			result.Conflicts = append(result.Conflicts, Problem{
+				Row:    match.Row,
+				File:   &file,
+				Reason: fmt.Sprintf("%d rows edit this file", n),
+			})
+			continue
+		}
+		if !force {
+			reason, err := changedSinceExport(match)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				result.Conflicts = append(result.Conflicts, Problem{Row: match.Row, File: &file, Reason: reason})
+				continue
+			}
+		}
+		result.Matches = append(result.Matches, match)
+	}
+	return result, nil
+}
+
+// changedSinceExport reports why a matched row conflicts with a file modified after the row's mtime,
+// or an empty string if it doesn't
+func changedSinceExport(match Match) (string, error) {
+	exported, err := time.Parse(time.RFC3339, match.Row.Values["mtime"])
+	if err != nil {
+		// No or unreadable mtime: nothing to compare
+		return "", nil
+	}
+	info, err := os.Stat(match.File.Path)
+	if err != nil {
+		return "", err
+	}
+	if !info.ModTime().Truncate(time.Second).After(exported) {
+		return "", nil
+	}
+
+	meta, err := tagger.ReadTags(match.File.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tags from %s: %w", match.File.Path, err)
+	}
+	if len(match.Row.Apply(meta)) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("modified since the export (%s, exported %s)",
+		info.ModTime().Format(time.RFC3339), exported.Format(time.RFC3339)), nil
+}
+
+// hashFiles indexes files by audio hash; files that fail to hash are left out
+func hashFiles(files []scanner.AudioFile, threads int) map[string][]scanner.AudioFile {
+	hashes := make([]string, len(files))
+	workers.Run(len(files), threads, func(index int) {
+		hashes[index], _, _ = mpeg.HashAudio(files[index].Path)
+	})
+
+	byHash := make(map[string][]scanner.AudioFile)
+	for i, hash := range hashes {
+		if hash != "" {
+			byHash[hash] = append(byHash[hash], files[i])
+		}
+	}
+	return byHash
+}
@@ -0,0 +1,205 @@
+package chapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/encoder"
+)
+
+// Chapter list formats for LoadFile, Format and SidecarPath
+const (
+	FormatMP4Chaps = "mp4chaps" // "00:01:30.000 Title" lines, also the import text format
+	FormatPodlove  = "podlove"  // Podlove Simple Chapters XML
+	FormatJSON     = "json"     // Podlove JSON: [{"start": "00:01:30.000", "title": "Title"}]
+)
+
+// sidecarSuffixes are the chapter list files looked for next to an audio file, by format
+var sidecarSuffixes = map[string]string{
+	FormatMP4Chaps: ".chapters.txt",
+	FormatPodlove:  ".chapters.xml",
+	FormatJSON:     ".chapters.json",
+}
+
+// lineTime matches a chapter line: [hh:]mm:ss[.fff] followed by the title
+var lineTime = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2}(?:[.,]\d+)?)(?:\s+(.*))?$`)
+
+// jsonChapter is a chapter in Podlove JSON
+type jsonChapter struct {
+	Start string `json:"start"`
+	Title string `json:"title"`
+}
+
+// Parse parses chapter lines such as "00:01:30.000 Title" or "1:30 Title"; blank lines and
+// lines starting with # are skipped
+func Parse(text string) ([]Chapter, error) {
+	var list []Chapter
+	for n, line := range strings.Split(strings.TrimPrefix(text, "\uFEFF"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := lineTime.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: expected \"hh:mm:ss.mmm title\", got %q", n+1, line)
+		}
+		start, err := parseTime(match[1], match[2], match[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		list = append(list, Chapter{Start: start, Title: strings.TrimSpace(match[4])})
+	}
+	return list, nil
+}
+
+// ParseJSON parses a Podlove JSON chapter list
+func ParseJSON(data []byte) ([]Chapter, error) {
+	var entries []jsonChapter
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\uFEFF")), &entries); err != nil {
+		return nil, fmt.Errorf("invalid chapter JSON: %w", err)
+	}
+	list := make([]Chapter, 0, len(entries))
+	for i, entry := range entries {
+		match := lineTime.FindStringSubmatch(strings.TrimSpace(entry.Start))
+		if match == nil || match[4] != "" {
+			return nil, fmt.Errorf("chapter %d: invalid start %q", i+1, entry.Start)
+		}
+		start, err := parseTime(match[1], match[2], match[3])
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: %w", i+1, err)
+		}
+		list = append(list, Chapter{Start: start, Title: entry.Title})
+	}
+	return list, nil
+}
+
+// parseTime converts hours, minutes and (fractional) seconds to a duration
+func parseTime(hours, minutes, seconds string) (time.Duration, error) {
+	h := 0
+	if hours != "" {
+		h, _ = strconv.Atoi(hours)
+	}
+	m, _ := strconv.Atoi(minutes)
+	s, err := strconv.ParseFloat(strings.Replace(seconds, ",", ".", 1), 64)
+	if err != nil || m >= 60 && hours != "" || s >= 60 {
+		return 0, fmt.Errorf("invalid time %s:%s:%s", hours, minutes, seconds)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s*float64(time.Second)+0.5), nil
+}
+
+// LoadFile reads a chapter list (JSON for .json files, chapter lines otherwise), converting
+// it to UTF-8. Returns the chapters and the charset the file was converted from.
+func LoadFile(path string) ([]Chapter, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read chapters: %w", err)
+	}
+
+	// Hand-written lists are often GBK
+	text, charset, err := encoder.DecodeText(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode chapters %s: %w", path, err)
+	}
+
+	var list []Chapter
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		list, err = ParseJSON([]byte(text))
+	} else {
+		list, err = Parse(text)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	return list, charset, nil
+}
+
+// Finish sorts chapters by start, ends each one where the next starts and the last one at
+// duration, and numbers chapters without an ID
+func Finish(list []Chapter, duration time.Duration) {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Start < list[j].Start })
+	for i := range list {
+		if i+1 < len(list) {
+			list[i].End = list[i+1].Start
+		} else {
+			list[i].End = max(duration, list[i].Start)
+		}
+	}
+	Number(list)
+}
+
+// Shift moves all chapter times by offset, keeping them between 0 and duration
+func Shift(list []Chapter, offset, duration time.Duration) {
+	clamp := func(t time.Duration) time.Duration {
+		return min(max(t+offset, 0), duration)
+	}
+	for i := range list {
+		list[i].Start = clamp(list[i].Start)
+		list[i].End = clamp(list[i].End)
+	}
+}
+
+// Format writes a chapter list in the given format
+func Format(list []Chapter, format string) (string, error) {
+	var buf strings.Builder
+	switch format {
+	case FormatMP4Chaps:
+		for _, chapter := range list {
+			fmt.Fprintf(&buf, "%s %s\n", formatTime(chapter.Start), chapter.Title)
+		}
+	case FormatPodlove:
+		buf.WriteString(xml.Header)
+		buf.WriteString(`<psc:chapters version="1.2" xmlns:psc="http://podlove.org/simple-chapters">` + "\n")
+		for _, chapter := range list {
+			var title bytes.Buffer
+			xml.EscapeText(&title, []byte(chapter.Title))
+			fmt.Fprintf(&buf, "  <psc:chapter start=\"%s\" title=\"%s\" />\n", formatTime(chapter.Start), title.String())
+		}
+		buf.WriteString("</psc:chapters>\n")
+	case FormatJSON:
+		entries := make([]jsonChapter, len(list))
+		for i, chapter := range list {
+			entries[i] = jsonChapter{Start: formatTime(chapter.Start), Title: chapter.Title}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	default:
+		return "", fmt.Errorf("unknown chapter format %q (use mp4chaps, podlove or json)", format)
+	}
+	return buf.String(), nil
+}
+
+// formatTime formats a chapter time as hh:mm:ss.mmm
+func formatTime(t time.Duration) string {
+	ms := t.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// FindSidecar looks for a chapter list next to the audio file: <name>.chapters.txt or
+// <name>.chapters.json
+func FindSidecar(audioPath string) (string, bool) {
+	for _, format := range []string{FormatMP4Chaps, FormatJSON} {
+		path := SidecarPath(audioPath, format)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// SidecarPath returns the path chapters of an audio file are exported to in a format
+func SidecarPath(audioPath, format string) string {
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + sidecarSuffixes[format]
+}
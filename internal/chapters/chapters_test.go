@@ -0,0 +1,162 @@
+package chapters
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	list := []Chapter{
+		{Start: 0, End: 90 * time.Second, Title: "第一回 徐良出世"},
+		{ID: "intro", Start: 90 * time.Second, End: 200500 * time.Millisecond, Title: "Intro"},
+	}
+	Number(list)
+	if list[0].ID != "chp0" || list[1].ID != "intro" {
+		t.Fatalf("Expected generated and kept IDs, got %q %q", list[0].ID, list[1].ID)
+	}
+
+	tag := id3v2.NewEmptyTag()
+	tag.SetVersion(4)
+	for _, chapter := range list {
+		tag.AddFrame("CHAP", id3v2.UnknownFrame{Body: EncodeCHAP(chapter)})
+	}
+	tocBody, err := EncodeCTOC(list)
+	if err != nil {
+		t.Fatalf("Failed to encode CTOC: %v", err)
+	}
+	tag.AddFrame("CTOC", id3v2.UnknownFrame{Body: tocBody})
+	path := filepath.Join(t.TempDir(), "chapters.mp3")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write tag: %v", err)
+	}
+	os.WriteFile(path, buf.Bytes(), 0644)
+
+	parsed, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatalf("Failed to parse tag: %v", err)
+	}
+	defer parsed.Close()
+	frames := parsed.GetFrames("CHAP")
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 chapters, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		chap := frame.(id3v2.ChapterFrame)
+		if chap.ElementID != list[i].ID || chap.StartTime != list[i].Start || chap.EndTime != list[i].End || chap.Title.Text != list[i].Title {
+			t.Errorf("Chapter %d: expected %+v, got %+v (%q)", i, list[i], chap, chap.Title.Text)
+		}
+	}
+	toc := parsed.GetFrames("CTOC")
+	if len(toc) != 1 || !bytes.Equal(toc[0].(id3v2.UnknownFrame).Body, []byte("toc\x00\x03\x02chp0\x00intro\x00")) {
+		t.Errorf("Unexpected CTOC frame %v", toc)
+	}
+}
+
+func TestParseAndFormat(t *testing.T) {
+	list, err := Parse("\uFEFF# Chapters\n00:00:00.000 Intro\n\n1:30.5 第一回\n1:02:03,25 Ending\n")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	expected := []time.Duration{0, 90500 * time.Millisecond, time.Hour + 2*time.Minute + 3250*time.Millisecond}
+	if len(list) != 3 || list[1].Title != "第一回" {
+		t.Fatalf("Expected 3 chapters, got %+v", list)
+	}
+	for i, start := range expected {
+		if list[i].Start != start {
+			t.Errorf("Chapter %d: expected start %v, got %v", i+1, start, list[i].Start)
+		}
+	}
+	if _, err := Parse("Intro 00:00"); err == nil {
+		t.Error("Expected an error for a line without a leading time")
+	}
+
+	Finish(list, 2*time.Hour)
+	if list[0].End != list[1].Start || list[2].End != 2*time.Hour || list[2].ID != "chp2" {
+		t.Errorf("Expected chained end times and IDs, got %+v", list)
+	}
+
+	text, _ := Format(list, FormatMP4Chaps)
+	if text != "00:00:00.000 Intro\n00:01:30.500 第一回\n01:02:03.250 Ending\n" {
+		t.Errorf("Unexpected mp4chaps output:\n%s", text)
+	}
+	list[0].Title = "Q&A"
+	text, _ = Format(list[:1], FormatPodlove)
+	if !strings.Contains(text, `<psc:chapter start="00:00:00.000" title="Q&amp;A" />`) {
+		t.Errorf("Unexpected Podlove output:\n%s", text)
+	}
+	text, _ = Format(list, FormatJSON)
+	parsed, err := ParseJSON([]byte(text))
+	if err != nil || len(parsed) != 3 || parsed[2].Start != list[2].Start || parsed[1].Title != "第一回" {
+		t.Errorf("Expected JSON round trip, got %+v (%v)", parsed, err)
+	}
+
+	Shift(list, -time.Minute, 2*time.Hour)
+	if list[0].Start != 0 || list[1].Start != 30500*time.Millisecond {
+		t.Errorf("Expected times shifted and clamped at 0, got %+v", list)
+	}
+}
+
+func TestReadEmbedded(t *testing.T) {
+	// The table of contents orders the chapters, not the frame order
+	list := []Chapter{
+		{ID: "b", Start: time.Minute, End: 2 * time.Minute, Title: "Second"},
+		{ID: "a", Start: 0, End: time.Minute, Title: "First"},
+	}
+	tag := id3v2.NewEmptyTag()
+	tag.SetVersion(4)
+	bodies, _, _ := Encode(list)
+	for _, body := range bodies {
+		tag.AddFrame("CHAP", id3v2.UnknownFrame{Body: body})
+	}
+	toc, _ := EncodeCTOC([]Chapter{list[1], list[0]})
+	tag.AddFrame("CTOC", id3v2.UnknownFrame{Body: toc})
+	var buf bytes.Buffer
+	tag.WriteTo(&buf)
+	path := filepath.Join(t.TempDir(), "book.mp3")
+	os.WriteFile(path, buf.Bytes(), 0644)
+
+	read, err := ReadEmbedded(path)
+	if err != nil || len(read) != 2 || read[0].Title != "First" || read[1].ID != "b" {
+		t.Errorf("Expected chapters in table of contents order, got %+v (%v)", read, err)
+	}
+
+	os.WriteFile(path, nil, 0644)
+	if _, err := ReadEmbedded(path); err != ErrNoChapters {
+		t.Errorf("Expected ErrNoChapters, got %v", err)
+	}
+}
+
+func TestEncodeChapterLimit(t *testing.T) {
+	list := make([]Chapter, MaxChapters+1)
+	for i := range list {
+		list[i] = Chapter{Start: time.Duration(i) * time.Minute, End: time.Duration(i+1) * time.Minute}
+	}
+	Number(list)
+
+	// The entry count is one byte, 256 would wrap to 0
+	if _, err := EncodeCTOC(list); err == nil {
+		t.Errorf("Expected %d chapters to be rejected", len(list))
+	}
+	if _, _, err := Encode(list); err == nil {
+		t.Errorf("Expected Encode to reject %d chapters", len(list))
+	}
+
+	toc, err := EncodeCTOC(list[:MaxChapters])
+	if err != nil {
+		t.Fatalf("Failed to encode %d chapters: %v", MaxChapters, err)
+	}
+	_, _, children, err := DecodeCTOC(toc)
+	if err != nil || len(children) != MaxChapters || children[MaxChapters-1] != "chp254" {
+		t.Errorf("Expected %d children, got %d (%v)", MaxChapters, len(children), err)
+	}
+}
@@ -0,0 +1,172 @@
+package chapters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// Chapter frame values (ID3v2 Chapter Frame Addendum 1.0)
+const (
+	ignoredOffset    = 0xFFFFFFFF // Byte offsets are not used, only times
+	ctocTopLevel     = 0x02
+	ctocOrdered      = 0x01
+	textEncodingUTF8 = 3
+	tocID            = "toc"
+)
+
+// MaxChapters is the most chapters a single CTOC frame can list (its entry count is one byte)
+const MaxChapters = 255
+
+// ErrNoChapters is returned when a file has no chapter frames
+var ErrNoChapters = errors.New("no chapters")
+
+// Chapter is one chapter of an audio file (ID3v2 CHAP frame)
+type Chapter struct {
+	ID    string // Element ID, unique within the tag
+	Start time.Duration
+	End   time.Duration
+	Title string
+}
+
+// Number assigns element IDs "chp0", "chp1", ... to chapters without one
+func Number(chapters []Chapter) {
+	for i := range chapters {
+		if chapters[i].ID == "" {
+			chapters[i].ID = fmt.Sprintf("chp%d", i)
+		}
+	}
+}
+
+// EncodeCHAP builds the body of a CHAP frame with a UTF-8 TIT2 title sub-frame
+func EncodeCHAP(chapter Chapter) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(chapter.ID)
+	buf.WriteByte(0)
+
+	var field [4]byte
+	for _, value := range []uint32{uint32(chapter.Start.Milliseconds()), uint32(chapter.End.Milliseconds()), ignoredOffset, ignoredOffset} {
+		binary.BigEndian.PutUint32(field[:], value)
+		buf.Write(field[:])
+	}
+
+	if chapter.Title != "" {
+		writeSubFrame(&buf, "TIT2", append([]byte{textEncodingUTF8}, chapter.Title...))
+	}
+	return buf.Bytes()
+}
+
+// EncodeCTOC builds the body of a top-level, ordered CTOC frame listing the chapter IDs.
+// Returns an error for more than MaxChapters chapters.
+func EncodeCTOC(chapters []Chapter) ([]byte, error) {
+	if len(chapters) > MaxChapters {
+		return nil, fmt.Errorf("%d chapters, a table of contents holds at most %d", len(chapters), MaxChapters)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(tocID)
+	buf.WriteByte(0)
+	buf.WriteByte(ctocTopLevel | ctocOrdered)
+	buf.WriteByte(byte(len(chapters)))
+	for _, chapter := range chapters {
+		buf.WriteString(chapter.ID)
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeSubFrame writes an embedded ID3v2.4 frame (synchsafe size, no flags)
+func writeSubFrame(buf *bytes.Buffer, id string, body []byte) {
+	size := len(body)
+	buf.WriteString(id)
+	buf.Write([]byte{byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F), 0, 0})
+	buf.Write(body)
+}
+
+// Encode builds the CHAP frame bodies and the CTOC body of a chapter list
+func Encode(list []Chapter) ([][]byte, []byte, error) {
+	if len(list) == 0 {
+		return nil, nil, nil
+	}
+	toc, err := EncodeCTOC(list)
+	if err != nil {
+		return nil, nil, err
+	}
+	bodies := make([][]byte, len(list))
+	for i, chapter := range list {
+		bodies[i] = EncodeCHAP(chapter)
+	}
+	return bodies, toc, nil
+}
+
+// DecodeCTOC parses the body of a CTOC frame: its element ID, whether it is the top-level
+// table of contents, and the child element IDs
+func DecodeCTOC(body []byte) (string, bool, []string, error) {
+	end := bytes.IndexByte(body, 0)
+	if end < 0 || len(body) < end+3 {
+		return "", false, nil, fmt.Errorf("truncated CTOC frame")
+	}
+	id := string(body[:end])
+	flags, count := body[end+1], int(body[end+2])
+	rest := body[end+3:]
+
+	children := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return "", false, nil, fmt.Errorf("truncated CTOC frame")
+		}
+		children = append(children, string(rest[:end]))
+		rest = rest[end+1:]
+	}
+	return id, flags&ctocTopLevel != 0, children, nil
+}
+
+// ReadEmbedded reads the chapters of an audio file, in the order of the top-level table of
+// contents if there is one, otherwise by start time
+func ReadEmbedded(filePath string) ([]Chapter, error) {
+	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	defer tag.Close()
+
+	var list []Chapter
+	for _, frame := range tag.GetFrames("CHAP") {
+		if chap, ok := frame.(id3v2.ChapterFrame); ok {
+			chapter := Chapter{ID: chap.ElementID, Start: chap.StartTime, End: chap.EndTime}
+			if chap.Title != nil {
+				chapter.Title = chap.Title.Text
+			}
+			list = append(list, chapter)
+		}
+	}
+	if len(list) == 0 {
+		return nil, ErrNoChapters
+	}
+
+	order := make(map[string]int)
+	for _, frame := range tag.GetFrames("CTOC") {
+		unknown, ok := frame.(id3v2.UnknownFrame)
+		if !ok {
+			continue
+		}
+		if _, topLevel, children, err := DecodeCTOC(unknown.Body); err == nil && topLevel {
+			for i, child := range children {
+				order[child] = i + 1
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		oi, oj := order[list[i].ID], order[list[j].ID]
+		if oi != oj && oi > 0 && oj > 0 {
+			return oi < oj
+		}
+		return list[i].Start < list[j].Start
+	})
+	return list, nil
+}
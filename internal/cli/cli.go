@@ -1,13 +1,29 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"mp3tools/internal/catalog"
+	"mp3tools/internal/chapters"
+	"mp3tools/internal/cover"
+	"mp3tools/internal/cue"
+	"mp3tools/internal/dupes"
+	"mp3tools/internal/fingerprint"
+	"mp3tools/internal/journal"
+	"mp3tools/internal/loudness"
+	"mp3tools/internal/mpeg"
 	"mp3tools/internal/processor"
+	"mp3tools/internal/query"
 	"mp3tools/internal/scanner"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -16,6 +32,58 @@ var (
 	threads  int
 	outdir   string
 	update   bool
+	stateDir string
+	format   string
+	rules    string
+	cleanup  string
+
+	covers        bool
+	coverSize     int
+	replaceCovers bool
+
+	extract bool
+	minSize int
+
+	useCue bool
+
+	synced    bool
+	lang      string
+	exportLrc bool
+
+	keepPolicy string
+	prefer     []string
+	action     string
+	moveTo     string
+	acoustic   bool
+	similarity float64
+	indexPath  string
+
+	analyzeOnly bool
+	applyGain   string
+	undoGain    bool
+	threshold   float64
+	minSilence  time.Duration
+	margin      time.Duration
+	splitAt     []string
+	splitQuiet  bool
+	splitCue    bool
+	splitTitle  string
+	renames     []string
+	shift       time.Duration
+	importChaps bool
+	exportChaps string
+
+	output     string
+	importFile string
+
+	setValues map[string]*string
+	clears    []string
+	replaces  []string
+	where     string
+	dryRun    bool
+
+	sortBy     []string
+	fieldNames []string
 )
 
 var rootCmd = &cobra.Command{
@@ -29,25 +97,128 @@ Commands:
   fix <path>     Fix encoding issues in audio file tags
   tag <path>     Auto-fill missing metadata tags
   test <path>    Preview changes with parameters (simulation only, no file modification)
-  check <path>   Display current tags (display only, no parameters)
+  check <path>   Display current tags (display only, no tag parameters; takes --where, --sort and --fields)
+  restore <run-id>  Roll back all files modified in place by a fix/tag run
+  validate <path>  Check MPEG streams for lost sync, truncated frames, bad CRCs, junk and trailers
+  repair <path>  Drop junk, stacked ID3v2 tags and partial frames, and rebuild the Xing/Info header
+  dupes <path>   Find files with identical audio (tags ignored) and optionally delete, hardlink or move the extras
+  gain <path>    Measure EBU R128 loudness and true peak, and write ReplayGain 2.0 track and album (per directory) tags
+  silence <path>  Find silent regions below a dBFS threshold (analysis only)
+  trim <path>    Cut leading and trailing silence at frame boundaries and rebuild the Xing/Info header
+  split <path>   Cut files at frame boundaries at timestamps (--at), silences (--silence) or cue sheet tracks (--cue)
+  merge <path>   Join the MP3s of each directory into one file with a chapter (CHAP/CTOC) per source file
+  chapters <path>  List ID3v2 chapters (CHAP/CTOC); rename, shift or import them, or export to mp4chaps, Podlove or JSON
+  export <path>  Write every file's tags, path, size, mtime, audio hash, technical properties and charset to CSV, JSON Lines or SQLite
+  import <path> <file>  Write tags edited in an exported CSV/JSONL back to the files, matched by path or audio hash
+  set <path>     Set, clear or regex-replace tag fields directly, optionally only in files matching --where
+  covers <path>  Report albums with missing, inconsistent or tiny embedded cover art
+  cue <path>     Tag split MP3s from the .cue sheet in their directory (title, artist, album, track)
+  lyrics <path>  Embed sidecar .lrc lyrics (same base name as the MP3), or export embedded lyrics with --export
 
 Options:
   -f, --force    Derive tags from filename and directory name (for tag command)
   -a, --all      Force update all tags (overwrite existing tags)
   -n, --threads  Number of worker threads (default: 5)
   -u, --update   Fix encoding only (for tag command, default: true) or update original files (for other commands)
-  -o, --outdir   Output directory, preserve directory structure (default: update original files)
+  -o, --outdir   Output directory, preserve directory structure (default: ./output for fix, tag, repair, trim, split and merge unless -u; the original files for other commands)
+  --state-dir    Directory for undo journals (default: ~/.mp3tools/journal)
+  --format       Diff format for test and set --dry-run: text, unified or json; report format for validate: text or json (default: text); database format for export: csv (UTF-8 with BOM), jsonl or sqlite (default: from the --output extension)
+  --rules        Rule pipeline config file for fix/tag/test (YAML, default: built-in pipeline)
+  --covers       Embed cover.*, folder.* or front.* from each album directory (for tag/test command)
+  --cover-size   Maximum cover width/height in pixels, larger images are scaled down (default: 800)
+  --replace-covers  Replace existing embedded covers (default: keep them)
+  --extract      Write each album's embedded art to cover.jpg (for covers command, -f replaces existing cover files)
+  --rename       Rename a chapter: N=Title, N counting from 1 (for chapters command, repeatable)
+  --shift        Move all chapter times by a duration such as 2.5s or -1s (for chapters command)
+  --import       Replace chapters with <name>.chapters.txt or <name>.chapters.json next to each MP3 (for chapters command, -f replaces existing chapters); preview tags from an exported and edited CSV/JSONL instead of the rule pipeline (for test command, -f includes files modified since the export)
+  --export       Write chapters to a file next to each MP3: mp4chaps, podlove or json (for chapters command); write embedded lyrics to .lrc files next to the MP3s (for lyrics command); -f replaces existing files
+  --min-size     Art smaller than this width/height in pixels is reported as a thumbnail (default: 300)
+  --synced       Also write synchronised lyrics (SYLT, millisecond timestamps) for timed .lrc files (for lyrics command)
+  --lang         Lyrics language code, ISO 639-2 (for lyrics command, default: und)
+  --keep         Copy to keep in each duplicate group: longest-tag, newest or path (for dupes command, default: longest-tag)
+  --prefer       Preferred paths for --keep path, relative to the scanned directory or absolute (repeatable)
+  --action       What to do with extra copies: delete, hardlink or move (for dupes command, default: report only)
+  --move-to      Directory extra copies are moved to, preserving relative paths (for --action move)
+  --acoustic     Match re-encoded copies by acoustic fingerprint instead of identical audio (for dupes command)
+  --similarity   Fingerprint similarity from which files are near-duplicates, 0.5-1 (for --acoustic, default: 0.85)
+  --index        Fingerprint index file (for --acoustic, default: ~/.mp3tools/fingerprints.jsonl)
+  --analyze      Only report loudness, don't write ReplayGain tags (for gain command)
+  --apply        Also adjust global_gain losslessly by the track or album gain in 1.5 dB steps: track or album (for gain command)
+  --undo         Revert global_gain adjustments recorded in MP3GAIN_UNDO tags (for gain command)
+  --threshold    Frames whose RMS level is below this many dBFS are silent (for silence/trim command, default: -50)
+  --min-silence  Shortest silent region reported or trimmed (for silence/trim command, default: 500ms)
+  --margin       Silence kept at each end (for trim command, default: 200ms)
+  --at           Split points such as 1:02:03.5, 62:03 or 3723 seconds (for split command, comma-separated or repeatable)
+  --silence      Split in the middle of each silent region (for split command, with --threshold and --min-silence)
+  --cue          Preview tags from .cue sheets instead of the rule pipeline (for test command); split at the tracks of the file's .cue sheet (for split command)
+  --title        Title template of parts: {title}, {album}, {artist}, {n}, {total}, {start}, {duration}, {bitrate} (for split command, default: "{title} {n}")
+  --output       Tag database file for export command; the format follows the extension (.csv, .jsonl, .db) unless --format is given, -f replaces an existing file (default: CSV to stdout)
+  --artist, --album, --genre, --comment, --year, --track  Set a field, an empty value clears it (for set command; --title sets the title)
+  --clear        Remove a field: title, artist, album, year, genre, track or comment (for set command, repeatable)
+  --replace      Regex replacement on a field such as title:s/第(\d+)回/$1/, i flag for case-insensitive (for set command, repeatable)
+  --where        Only show (for scan/check) or edit (for set) files matching a filter such as 'album ~ "评书" and year < 1990' or 'garbled(title) or bitrate < 64'
+  --sort         Sort by fields, -field for descending: artist,-bitrate (for scan/check command, comma-separated)
+  --fields       Print these fields as a table, one line per file: path,title,bitrate (for scan/check command, comma-separated)
+  --dry-run      Show the changes as a diff without writing (for set command, with --format)
+  --cleanup      Cleanup rule file of find/replace regexes for fix/tag/test (YAML, added to the built-in rules)
 
 Examples:
   mp3tools scan ./music
   mp3tools fix ./music -u
   mp3tools tag ./music -f
-  mp3tools check ./music -u`,
+  mp3tools test ./music --format json
+  mp3tools fix ./music -u --rules rules.yaml
+  mp3tools test ./music --cleanup cleanup.yaml
+  mp3tools tag ./music --covers --cover-size 600
+  mp3tools check ./music -u
+  mp3tools scan ./music --where 'artist == "" or garbled(title) or year < 1990 or bitrate < 64'
+  mp3tools check ./music --sort -bitrate --fields path,title,bitrate,charset
+  mp3tools validate ./music --format json > report.jsonl
+  mp3tools repair ./music -o ./repaired
+  mp3tools dupes ./music --keep path --prefer 白眉大侠 --action move --move-to ./extras
+  mp3tools dupes ./music --acoustic --similarity 0.9
+  mp3tools gain ./music
+  mp3tools gain ./music --apply album
+  mp3tools silence ./music --threshold -45
+  mp3tools trim ./music -u --margin 300ms
+  mp3tools split ./book.mp3 --at 30:00,1:00:00 -o ./parts
+  mp3tools split ./books --silence --min-silence 3s
+  mp3tools merge ./books -o ./merged
+  mp3tools chapters ./books --rename "3=第三回 出世" --shift 1.5s
+  mp3tools chapters ./books --export podlove
+  mp3tools export ./music --output tags.csv
+  mp3tools export ./music --output tags.db
+  mp3tools test ./music --import tags.csv
+  mp3tools import ./music tags.csv
+  mp3tools set ./music --artist 单田芳 --album 白眉大侠 --where 'album ~ "评书"'
+  mp3tools set ./music --clear comment --replace 'title:s/第(\d+)回/$1/' --dry-run
+  mp3tools covers ./music --extract
+  mp3tools test ./music --cue
+  mp3tools cue ./music
+  mp3tools lyrics ./music --synced
+  mp3tools restore 20251114-103000-a1b2c3`,
+	PersistentPreRun: resetFlagDefaults,
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
 }
 
+// resetFlagDefaults sets every flag the user didn't pass to the running command's default.
+// Commands share flag variables, and defining a flag stores its default in the variable,
+// so without this the last command to define a flag would decide the default for all of them.
+func resetFlagDefaults(cmd *cobra.Command, args []string) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed {
+			return
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+			return
+		}
+		flag.Value.Set(flag.DefValue)
+	})
+}
+
 var scanCmd = &cobra.Command{
 	Use:   "scan [path]",
 	Short: "Scan directory and display audio file tags",
@@ -83,8 +254,120 @@ var checkCmd = &cobra.Command{
 	Run:   runCheck,
 }
 
+var restoreCmd = &cobra.Command{
+	Use:   "restore [run-id]",
+	Short: "Roll back files modified by a run",
+	Args:  cobra.ExactArgs(1),
+	Run:   runRestore,
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [path]",
+	Short: "Check MPEG stream integrity",
+	Args:  cobra.ExactArgs(1),
+	Run:   runValidate,
+}
+
+var repairCmd = &cobra.Command{
+	Use:   "repair [path]",
+	Short: "Repair MPEG streams and rebuild Xing headers",
+	Args:  cobra.ExactArgs(1),
+	Run:   runRepair,
+}
+
+var dupesCmd = &cobra.Command{
+	Use:   "dupes [path]",
+	Short: "Find duplicate audio regardless of tags",
+	Args:  cobra.ExactArgs(1),
+	Run:   runDupes,
+}
+
+var gainCmd = &cobra.Command{
+	Use:   "gain [path]",
+	Short: "Write ReplayGain tags from EBU R128 loudness",
+	Args:  cobra.ExactArgs(1),
+	Run:   runGain,
+}
+
+var silenceCmd = &cobra.Command{
+	Use:   "silence [path]",
+	Short: "Find silent regions",
+	Args:  cobra.ExactArgs(1),
+	Run:   runSilence,
+}
+
+var trimCmd = &cobra.Command{
+	Use:   "trim [path]",
+	Short: "Trim leading and trailing silence",
+	Args:  cobra.ExactArgs(1),
+	Run:   runTrim,
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split [path]",
+	Short: "Split MP3s losslessly by time, silence or cue sheet",
+	Args:  cobra.ExactArgs(1),
+	Run:   runSplit,
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge [path]",
+	Short: "Join each directory into one MP3 with chapters",
+	Args:  cobra.ExactArgs(1),
+	Run:   runMerge,
+}
+
+var chaptersCmd = &cobra.Command{
+	Use:   "chapters [path]",
+	Short: "List, edit, import or export ID3v2 chapters",
+	Args:  cobra.ExactArgs(1),
+	Run:   runChapters,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [path]",
+	Short: "Export tags and properties to CSV, JSON Lines or SQLite",
+	Args:  cobra.ExactArgs(1),
+	Run:   runExport,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import [path] [file]",
+	Short: "Write tags from an edited CSV/JSONL export",
+	Args:  cobra.ExactArgs(2),
+	Run:   runImport,
+}
+
+var setCmd = &cobra.Command{
+	Use:   "set [path]",
+	Short: "Set, clear or regex-replace tag fields directly",
+	Args:  cobra.ExactArgs(1),
+	Run:   runSet,
+}
+
+var coversCmd = &cobra.Command{
+	Use:   "covers [path]",
+	Short: "Report and extract embedded cover art",
+	Args:  cobra.ExactArgs(1),
+	Run:   runCovers,
+}
+
+var cueCmd = &cobra.Command{
+	Use:   "cue [path]",
+	Short: "Tag split tracks from cue sheets",
+	Args:  cobra.ExactArgs(1),
+	Run:   runCue,
+}
+
+var lyricsCmd = &cobra.Command{
+	Use:   "lyrics [path]",
+	Short: "Embed or export .lrc lyrics",
+	Args:  cobra.ExactArgs(1),
+	Run:   runLyrics,
+}
+
 func init() {
-	rootCmd.AddCommand(scanCmd, fixCmd, tagCmd, testCmd, checkCmd)
+	rootCmd.AddCommand(scanCmd, fixCmd, tagCmd, testCmd, checkCmd, restoreCmd, validateCmd, repairCmd, dupesCmd, gainCmd, silenceCmd, trimCmd, splitCmd, mergeCmd, chaptersCmd, exportCmd, importCmd, setCmd, coversCmd, cueCmd, lyricsCmd)
 
 	// Custom help template to remove duplicate sections
 	rootCmd.SetHelpTemplate(`{{.Long}}`)
@@ -94,25 +377,145 @@ func init() {
 	scanCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
 	scanCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
 	scanCmd.Flags().BoolVarP(&update, "update", "u", false, "Update original MP3 files (overwrite)")
+	scanCmd.Flags().StringVar(&where, "where", "", "Only show files matching a filter expression")
+	scanCmd.Flags().StringSliceVar(&sortBy, "sort", nil, "Sort by fields, -field for descending (comma-separated)")
+	scanCmd.Flags().StringSliceVar(&fieldNames, "fields", nil, "Print these fields as a table instead (comma-separated)")
 
 	fixCmd.Flags().BoolVarP(&force, "force", "f", false, "Derive tags from filename and directory name")
 	fixCmd.Flags().BoolVarP(&forceAll, "all", "a", false, "Force update all tags (overwrite existing tags)")
 	fixCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	fixCmd.Flags().StringVar(&rules, "rules", "", "Rule pipeline config file (YAML, default: built-in pipeline)")
+	fixCmd.Flags().StringVar(&cleanup, "cleanup", "", "Cleanup rule file of find/replace regexes (YAML, added to the built-in rules)")
 	fixCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, preserve directory structure (default: output)")
 	fixCmd.Flags().BoolVarP(&update, "update", "u", false, "Update original MP3 files (overwrite)")
+	fixCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
 
 	tagCmd.Flags().BoolVarP(&force, "force", "f", false, "Derive tags from filename and directory name")
 	tagCmd.Flags().BoolVarP(&forceAll, "all", "a", false, "Force update all tags (overwrite existing tags)")
 	tagCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	tagCmd.Flags().StringVar(&rules, "rules", "", "Rule pipeline config file (YAML, default: built-in pipeline)")
+	tagCmd.Flags().StringVar(&cleanup, "cleanup", "", "Cleanup rule file of find/replace regexes (YAML, added to the built-in rules)")
+	tagCmd.Flags().BoolVar(&covers, "covers", false, "Embed cover.*, folder.* or front.* from each album directory")
+	tagCmd.Flags().IntVar(&coverSize, "cover-size", cover.DefaultMaxSize, "Maximum cover width/height, larger images are scaled down")
+	tagCmd.Flags().BoolVar(&replaceCovers, "replace-covers", false, "Replace existing embedded covers (default: keep them)")
 	tagCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, preserve directory structure (default: output)")
 	tagCmd.Flags().BoolVarP(&update, "update", "u", true, "Fix encoding only (default: true)")
+	tagCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
 
 	testCmd.Flags().BoolVarP(&force, "force", "f", false, "Derive tags from filename and directory name")
 	testCmd.Flags().BoolVarP(&forceAll, "all", "a", false, "Force update all tags (overwrite existing tags)")
 	testCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	testCmd.Flags().StringVar(&rules, "rules", "", "Rule pipeline config file (YAML, default: built-in pipeline)")
+	testCmd.Flags().StringVar(&cleanup, "cleanup", "", "Cleanup rule file of find/replace regexes (YAML, added to the built-in rules)")
+	testCmd.Flags().BoolVar(&covers, "covers", false, "Embed cover.*, folder.* or front.* from each album directory")
+	testCmd.Flags().IntVar(&coverSize, "cover-size", cover.DefaultMaxSize, "Maximum cover width/height, larger images are scaled down")
+	testCmd.Flags().BoolVar(&replaceCovers, "replace-covers", false, "Replace existing embedded covers (default: keep them)")
 	testCmd.Flags().BoolVarP(&update, "update", "u", true, "Fix encoding only (default: true)")
+	testCmd.Flags().StringVar(&format, "format", processor.FormatText, "Diff output format: text, unified or json")
+	testCmd.Flags().BoolVar(&useCue, "cue", false, "Preview tags from .cue sheets instead of the rule pipeline")
+	testCmd.Flags().StringVar(&importFile, "import", "", "Preview tags from an exported and edited CSV/JSONL instead of the rule pipeline")
+
+	cueCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	cueCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
+	cueCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	restoreCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	validateCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	validateCmd.Flags().StringVar(&format, "format", processor.FormatText, "Report format: text or json (one JSON object per file)")
+
+	repairCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	repairCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, preserve directory structure (default: output)")
+	repairCmd.Flags().BoolVarP(&update, "update", "u", false, "Update original MP3 files (overwrite, not journaled)")
+
+	dupesCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	dupesCmd.Flags().StringVar(&keepPolicy, "keep", dupes.KeepLongestTag, "Copy to keep: longest-tag, newest or path")
+	dupesCmd.Flags().StringSliceVar(&prefer, "prefer", nil, "Preferred paths for --keep path (repeatable)")
+	dupesCmd.Flags().StringVar(&action, "action", "", "Action for extra copies: delete, hardlink or move (default: report only)")
+	dupesCmd.Flags().StringVar(&moveTo, "move-to", "", "Directory extra copies are moved to (for --action move)")
+	dupesCmd.Flags().BoolVar(&acoustic, "acoustic", false, "Match re-encoded copies by acoustic fingerprint")
+	dupesCmd.Flags().Float64Var(&similarity, "similarity", dupes.DefaultSimilarity, "Fingerprint similarity from which files are near-duplicates (0.5-1)")
+	dupesCmd.Flags().StringVar(&indexPath, "index", "", "Fingerprint index file (default: ~/.mp3tools/fingerprints.jsonl)")
 
-	// check command has no flags - display only
+	gainCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	gainCmd.Flags().BoolVar(&analyzeOnly, "analyze", false, "Only report loudness, don't write tags")
+	gainCmd.Flags().StringVar(&applyGain, "apply", "", "Adjust global_gain by the track or album gain: track or album")
+	gainCmd.Flags().BoolVar(&undoGain, "undo", false, "Revert global_gain adjustments recorded in MP3GAIN_UNDO tags")
+	gainCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	silenceCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	silenceCmd.Flags().Float64Var(&threshold, "threshold", loudness.DefaultSilenceThreshold, "Frames whose RMS level is below this many dBFS are silent")
+	silenceCmd.Flags().DurationVar(&minSilence, "min-silence", loudness.DefaultMinSilence, "Shortest silent region reported")
+
+	trimCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	trimCmd.Flags().Float64Var(&threshold, "threshold", loudness.DefaultSilenceThreshold, "Frames whose RMS level is below this many dBFS are silent")
+	trimCmd.Flags().DurationVar(&minSilence, "min-silence", loudness.DefaultMinSilence, "Shortest silent region trimmed")
+	trimCmd.Flags().DurationVar(&margin, "margin", processor.DefaultSilenceMargin, "Silence kept at each end")
+	trimCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, preserve directory structure (default: output)")
+	trimCmd.Flags().BoolVarP(&update, "update", "u", false, "Update original MP3 files (overwrite, not journaled)")
+
+	splitCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	splitCmd.Flags().StringSliceVar(&splitAt, "at", nil, "Split points such as 1:02:03.5, 62:03 or 3723 (comma-separated or repeatable)")
+	splitCmd.Flags().BoolVar(&splitQuiet, "silence", false, "Split in the middle of each silent region")
+	splitCmd.Flags().BoolVar(&splitCue, "cue", false, "Split at the tracks of the file's .cue sheet")
+	splitCmd.Flags().StringVar(&splitTitle, "title", processor.DefaultSplitTitle, "Title template of parts: {title}, {album}, {artist}, {n}, {total}, {start}, {duration}, {bitrate}")
+	splitCmd.Flags().Float64Var(&threshold, "threshold", loudness.DefaultSilenceThreshold, "Frames whose RMS level is below this many dBFS are silent (for --silence)")
+	splitCmd.Flags().DurationVar(&minSilence, "min-silence", loudness.DefaultMinSilence, "Shortest silent region split at (for --silence)")
+	splitCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, preserve directory structure (default: output)")
+
+	mergeCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	mergeCmd.Flags().StringVarP(&outdir, "outdir", "o", "output", "Output directory, one file per source directory (default: output)")
+
+	chaptersCmd.Flags().StringArrayVar(&renames, "rename", nil, "Rename a chapter: N=Title, N counting from 1 (repeatable)")
+	chaptersCmd.Flags().DurationVar(&shift, "shift", 0, "Move all chapter times by a duration such as 2.5s or -1s")
+	chaptersCmd.Flags().BoolVar(&importChaps, "import", false, "Replace chapters with <name>.chapters.txt or <name>.chapters.json next to each MP3")
+	chaptersCmd.Flags().StringVar(&exportChaps, "export", "", "Write chapters next to each MP3: mp4chaps, podlove or json")
+	chaptersCmd.Flags().BoolVarP(&force, "force", "f", false, "Replace existing chapters when importing, or existing files when exporting")
+	chaptersCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	chaptersCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
+	chaptersCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	exportCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	exportCmd.Flags().StringVar(&output, "output", "", "Tag database file (default: CSV to stdout)")
+	exportCmd.Flags().StringVar(&format, "format", "", "Database format: csv, jsonl or sqlite (default: from the --output extension)")
+	exportCmd.Flags().BoolVarP(&force, "force", "f", false, "Replace an existing output file")
+
+	importCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	importCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
+	importCmd.Flags().BoolVarP(&force, "force", "f", false, "Also import rows for files modified since the export")
+	importCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	setValues = make(map[string]*string)
+	for _, field := range []string{"title", "artist", "album", "genre", "comment", "year", "track"} {
+		setValues[field] = setCmd.Flags().String(field, "", fmt.Sprintf("Set the %s (empty clears it)", field))
+	}
+	setCmd.Flags().StringArrayVar(&clears, "clear", nil, "Remove a field: title, artist, album, year, genre, track or comment (repeatable)")
+	setCmd.Flags().StringArrayVar(&replaces, "replace", nil, "Regex replacement such as title:s/第(\\d+)回/$1/ (repeatable)")
+	setCmd.Flags().StringVar(&where, "where", "", "Only edit files matching a filter expression")
+	setCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes as a diff without writing")
+	setCmd.Flags().StringVar(&format, "format", processor.FormatText, "Diff output format for --dry-run: text, unified or json")
+	setCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	setCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
+	setCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	coversCmd.Flags().BoolVar(&extract, "extract", false, "Write each album's embedded art to cover.jpg")
+	coversCmd.Flags().BoolVarP(&force, "force", "f", false, "Replace existing cover files when extracting")
+	coversCmd.Flags().IntVar(&minSize, "min-size", cover.DefaultMinSize, "Art smaller than this width/height is reported as a thumbnail")
+	coversCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+
+	lyricsCmd.Flags().BoolVar(&synced, "synced", false, "Also write synchronised lyrics (SYLT) for timed .lrc files")
+	lyricsCmd.Flags().StringVar(&lang, "lang", processor.DefaultLyricsLanguage, "Lyrics language code (ISO 639-2)")
+	lyricsCmd.Flags().BoolVar(&exportLrc, "export", false, "Write embedded lyrics to .lrc files next to the MP3s")
+	lyricsCmd.Flags().BoolVarP(&force, "force", "f", false, "Replace existing embedded lyrics or .lrc files")
+	lyricsCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	lyricsCmd.Flags().StringVarP(&outdir, "outdir", "o", "", "Output directory, preserve directory structure (default: update original files)")
+	lyricsCmd.Flags().StringVar(&stateDir, "state-dir", "", "Directory for undo journals (default: ~/.mp3tools/journal)")
+
+	// check command only takes query flags - display only
+	checkCmd.Flags().IntVarP(&threads, "threads", "n", 5, "Number of worker threads")
+	checkCmd.Flags().StringVar(&where, "where", "", "Only show files matching a filter expression")
+	checkCmd.Flags().StringSliceVar(&sortBy, "sort", nil, "Sort by fields, -field for descending (comma-separated)")
+	checkCmd.Flags().StringSliceVar(&fieldNames, "fields", nil, "Print these fields as a table instead (comma-separated)")
 }
 
 func Execute() error {
@@ -132,6 +535,16 @@ func runScan(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	files = queryFiles(files, threads)
+	if len(files) == 0 {
+		return
+	}
+	// Workers print as they finish, one keeps the sorted order
+	workers := threads
+	if len(sortBy) > 0 {
+		workers = 1
+	}
+
 	// Default: update original files (unless -o is specified)
 	outputDir := outdir
 	if update {
@@ -142,10 +555,10 @@ func runScan(cmd *cobra.Command, args []string) {
 		Force:    force,
 		ForceAll: forceAll,
 		OutDir:   outputDir,
-		Threads:  threads,
+		Threads:  workers,
 	})
 
-	if err := proc.ProcessFiles(files, "scan", threads); err != nil {
+	if err := proc.ProcessFiles(files, "scan", workers); err != nil {
 		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
 		os.Exit(1)
 	}
@@ -170,12 +583,20 @@ func runFix(cmd *cobra.Command, args []string) {
 		outputDir = ""
 	}
 
+	pipeline := loadPipeline()
+	jrnl := openJournal(outputDir)
+	if jrnl != nil {
+		defer closeJournal(jrnl)
+	}
+
 	proc := processor.New(processor.ProcessOptions{
 		Force:          force,
 		ForceAll:       forceAll,
 		UpdateEncoding: false,
 		OutDir:         outputDir,
 		Threads:        threads,
+		Journal:        jrnl,
+		Pipeline:       pipeline,
 	})
 
 	if err := proc.ProcessFiles(files, "fix", threads); err != nil {
@@ -203,12 +624,23 @@ func runTag(cmd *cobra.Command, args []string) {
 		outputDir = ""
 	}
 
+	pipeline := loadPipeline()
+	jrnl := openJournal(outputDir)
+	if jrnl != nil {
+		defer closeJournal(jrnl)
+	}
+
 	proc := processor.New(processor.ProcessOptions{
 		Force:          force,
 		ForceAll:       forceAll,
 		UpdateEncoding: update,
 		OutDir:         outputDir,
 		Threads:        threads,
+		Journal:        jrnl,
+		Pipeline:       pipeline,
+		Covers:         covers,
+		CoverSize:      coverSize,
+		ReplaceCovers:  replaceCovers,
 	})
 
 	if err := proc.ProcessFiles(files, "tag", threads); err != nil {
@@ -219,6 +651,14 @@ func runTag(cmd *cobra.Command, args []string) {
 
 func runTest(cmd *cobra.Command, args []string) {
 	path := args[0]
+	switch format {
+	case processor.FormatText, processor.FormatUnified, processor.FormatJSON:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, unified or json)\n", format)
+		os.Exit(1)
+	}
+	pipeline := loadPipeline()
+
 	files, err := scanner.ScanDirectory(path)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
@@ -226,19 +666,46 @@ func runTest(cmd *cobra.Command, args []string) {
 	}
 
 	if len(files) == 0 {
-		fmt.Println("No audio files found")
+		if format != processor.FormatJSON {
+			fmt.Println("No audio files found")
+		}
 		return
 	}
 
-	fmt.Printf("Preview Mode - No changes will be made\n")
-	fmt.Printf("Scanning directory: %s\n", path)
-	fmt.Printf("Found %d audio files\n\n", len(files))
+	if format != processor.FormatJSON {
+		fmt.Printf("Preview Mode - No changes will be made\n")
+		fmt.Printf("Scanning directory: %s\n", path)
+		fmt.Printf("Found %d audio files\n\n", len(files))
+	}
+
+	var cueEntries map[string]processor.CueEntry
+	if useCue {
+		files, cueEntries = matchCues(files, format == processor.FormatJSON)
+		if len(files) == 0 {
+			return
+		}
+	}
+	var importEntries map[string]processor.ImportEntry
+	if importFile != "" {
+		files, importEntries = matchImport(files, importFile, format == processor.FormatJSON)
+		if len(files) == 0 {
+			return
+		}
+	}
 
 	proc := processor.New(processor.ProcessOptions{
 		Force:          force,
+		ForceAll:       forceAll,
 		UpdateEncoding: update,
 		OutDir:         "",
 		Threads:        threads,
+		Format:         format,
+		Pipeline:       pipeline,
+		Covers:         covers,
+		CoverSize:      coverSize,
+		ReplaceCovers:  replaceCovers,
+		Cue:            cueEntries,
+		Import:         importEntries,
 	})
 
 	if err := proc.ProcessFiles(files, "test", threads); err != nil {
@@ -260,16 +727,1136 @@ func runCheck(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	// check command: display only, no parameters
+	files = queryFiles(files, threads)
+	if len(files) == 0 {
+		return
+	}
+	// Workers print as they finish, one keeps the sorted order
+	workers := threads
+	if len(sortBy) > 0 {
+		workers = 1
+	}
+
+	// check command: display only, no tag parameters
 	proc := processor.New(processor.ProcessOptions{
 		Force:          false,
 		UpdateEncoding: false,
 		OutDir:         "",
-		Threads:        5,
+		Threads:        workers,
+	})
+
+	if err := proc.ProcessFiles(files, "check", workers); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runRestore(cmd *cobra.Command, args []string) {
+	runID := args[0]
+	entries, err := journal.Load(stateDir, runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading journal: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No files recorded in run", runID)
+		return
+	}
+
+	restored, skipped, failed := 0, 0, 0
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		// Only the first entry holds the original tag if a file was written more than once
+		if seen[entry.Path] {
+			continue
+		}
+		seen[entry.Path] = true
+
+		fmt.Printf("[%d/%d] Restoring: %s", i+1, len(entries), entry.Path)
+		err := journal.RestoreEntry(entry)
+		switch {
+		case err == nil:
+			restored++
+			fmt.Println(" → restored")
+		case errors.Is(err, journal.ErrAudioChanged):
+			skipped++
+			fmt.Println(" → skipped (audio changed since run)")
+		default:
+			failed++
+			fmt.Printf(" → failed: %v\n", err)
+		}
+	}
+
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Restored: %d\n", restored)
+	fmt.Printf("  Skipped (audio changed): %d\n", skipped)
+	fmt.Printf("  Failed: %d\n", failed)
+	fmt.Println()
+
+	if skipped > 0 || failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runValidate checks every file's MPEG stream.
+// Exits with 1 if any file has errors or could not be read, 2 if there are only warnings.
+func runValidate(cmd *cobra.Command, args []string) {
+	path := args[0]
+	if format != processor.FormatText && format != processor.FormatJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text or json)\n", format)
+		os.Exit(1)
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		if format != processor.FormatJSON {
+			fmt.Println("No audio files found")
+		}
+		return
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		Threads: threads,
+		Format:  format,
+	})
+
+	if err := proc.ProcessFiles(files, "validate", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+
+	stats := proc.Statistics()
+	switch {
+	case stats.StreamsErrors > 0 || stats.Failed > 0:
+		os.Exit(1)
+	case stats.StreamsWarnings > 0:
+		os.Exit(2)
+	}
+}
+
+func runRepair(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	// Default: write to the output directory (unless -u is specified).
+	// Audio changes can't be undone with restore, so in-place repairs are not journaled.
+	outputDir := outdir
+	if update {
+		outputDir = ""
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:  outputDir,
+		Threads: threads,
+	})
+
+	if err := proc.ProcessFiles(files, "repair", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+	if proc.Statistics().Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runSilence(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		Threads:          threads,
+		SilenceThreshold: threshold,
+		MinSilence:       minSilence,
+	})
+
+	if err := proc.ProcessFiles(files, "silence", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runTrim(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	// Default: write to the output directory (unless -u is specified).
+	// Audio changes can't be undone with restore, so in-place trims are not journaled.
+	outputDir := outdir
+	if update {
+		outputDir = ""
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:           outputDir,
+		Threads:          threads,
+		SilenceThreshold: threshold,
+		MinSilence:       minSilence,
+		SilenceMargin:    margin,
 	})
 
-	if err := proc.ProcessFiles(files, "check", 5); err != nil {
+	if err := proc.ProcessFiles(files, "trim", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+	if proc.Statistics().Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runSplit(cmd *cobra.Command, args []string) {
+	path := args[0]
+	options := processor.ProcessOptions{
+		OutDir:           outdir,
+		Threads:          threads,
+		SilenceThreshold: threshold,
+		MinSilence:       minSilence,
+		SplitTitle:       splitTitle,
+	}
+
+	modes := 0
+	if len(splitAt) > 0 {
+		modes++
+		options.SplitMode = processor.SplitAt
+		for _, text := range splitAt {
+			t, err := processor.ParseTimestamp(text)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			options.SplitAt = append(options.SplitAt, t)
+		}
+	}
+	if splitQuiet {
+		modes++
+		options.SplitMode = processor.SplitSilence
+	}
+	if splitCue {
+		modes++
+		options.SplitMode = processor.SplitCue
+	}
+	if modes != 1 {
+		fmt.Fprintln(os.Stderr, "Error: use exactly one of --at, --silence or --cue")
+		os.Exit(1)
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	proc := processor.New(options)
+	if err := proc.ProcessFiles(files, "split", threads); err != nil {
 		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
 		os.Exit(1)
 	}
+	if proc.Statistics().Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runMerge(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:  outdir,
+		Threads: threads,
+	})
+
+	if err := proc.ProcessFiles(files, "merge", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+	if proc.Statistics().Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runDupes(cmd *cobra.Command, args []string) {
+	path := args[0]
+	switch {
+	case keepPolicy != dupes.KeepLongestTag && keepPolicy != dupes.KeepNewest && keepPolicy != dupes.KeepPath:
+		fmt.Fprintf(os.Stderr, "Error: unknown keep policy %q (use longest-tag, newest or path)\n", keepPolicy)
+		os.Exit(1)
+	case keepPolicy == dupes.KeepPath && len(prefer) == 0:
+		fmt.Fprintln(os.Stderr, "Error: --keep path needs at least one --prefer path")
+		os.Exit(1)
+	case action != "" && action != dupes.ActionDelete && action != dupes.ActionHardlink && action != dupes.ActionMove:
+		fmt.Fprintf(os.Stderr, "Error: unknown action %q (use delete, hardlink or move)\n", action)
+		os.Exit(1)
+	case action == dupes.ActionMove && moveTo == "":
+		fmt.Fprintln(os.Stderr, "Error: --action move needs --move-to")
+		os.Exit(1)
+	case similarity < 0.5 || similarity > 1:
+		fmt.Fprintf(os.Stderr, "Error: --similarity must be between 0.5 and 1, got %g\n", similarity)
+		os.Exit(1)
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	fmt.Printf("Scanning directory: %s\n", path)
+	fmt.Printf("Found %d audio files\n\n", len(files))
+
+	var groups []*dupes.Group
+	var errs []error
+	if acoustic {
+		index, err := fingerprint.OpenIndex(indexPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		groups, errs = dupes.FindAcoustic(files, threads, index, similarity)
+		if err := index.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	} else {
+		groups, errs = dupes.Find(files, threads)
+	}
+	for _, err := range errs {
+		fmt.Printf("Error: %v\n", err)
+	}
+
+	extras, resolved, failed := 0, 0, len(errs)
+	var wasted int64
+	for i, group := range groups {
+		keep, err := group.Keeper(keepPolicy, prefer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		extras += len(group.Entries) - 1
+		wasted += group.Wasted(keep)
+
+		if acoustic {
+			fmt.Printf("[%d/%d] %d copies (similarity %.0f%%)\n", i+1, len(groups), len(group.Entries), group.Similarity*100)
+		} else {
+			fmt.Printf("[%d/%d] %d copies (%d KB audio, sha256 %s)\n",
+				i+1, len(groups), len(group.Entries), (group.Entries[0].AudioSize+1023)/1024, group.Hash[:12])
+		}
+		for _, entry := range group.Entries {
+			label := "extra"
+			if entry == keep {
+				label = "keep "
+			}
+			details := entry.ModTime.Format("2006-01-02 15:04")
+			if acoustic {
+				details = fmt.Sprintf("%s, %.0f%%, %s", mpeg.FormatDuration(entry.Duration), entry.Similarity*100, details)
+			}
+			fmt.Printf("  %s %s → %s (%s)\n", label, entry.File.RelPath, formatDupeTags(entry), details)
+			if entry == keep || action == "" {
+				continue
+			}
+
+			target, err := dupes.Resolve(keep, entry, action, moveTo)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Printf("    Error: %v\n", err)
+			case action == dupes.ActionDelete:
+				resolved++
+				fmt.Println("    Deleted")
+			case action == dupes.ActionHardlink:
+				resolved++
+				fmt.Println("    Hard-linked to kept copy")
+			default:
+				resolved++
+				fmt.Printf("    Moved to %s\n", target)
+			}
+		}
+	}
+
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", len(files))
+	fmt.Printf("  Duplicate groups: %d\n", len(groups))
+	fmt.Printf("  Extra copies: %d\n", extras)
+	fmt.Printf("  Reclaimable: %d KB\n", (wasted+1023)/1024)
+	if action != "" {
+		fmt.Printf("  Resolved (%s): %d\n", action, resolved)
+	}
+	fmt.Printf("  Failed: %d\n", failed)
+	fmt.Println()
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// formatDupeTags formats the tags of a duplicate like the fix/tag output
+func formatDupeTags(entry *dupes.Entry) string {
+	if entry.Meta == nil {
+		return "(tags unreadable)"
+	}
+	return fmt.Sprintf("Title: %q, Artist: %q, Album: %q", entry.Meta.Title, entry.Meta.Artist, entry.Meta.Album)
+}
+
+func runGain(cmd *cobra.Command, args []string) {
+	path := args[0]
+	switch {
+	case applyGain != "" && applyGain != processor.ApplyTrack && applyGain != processor.ApplyAlbum:
+		fmt.Fprintf(os.Stderr, "Error: unknown --apply mode %q (use track or album)\n", applyGain)
+		os.Exit(1)
+	case applyGain != "" && (analyzeOnly || undoGain):
+		fmt.Fprintln(os.Stderr, "Error: --apply can't be combined with --analyze or --undo")
+		os.Exit(1)
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	command := "gain"
+	if undoGain {
+		command = "gain-undo"
+	}
+
+	// Adjusted audio can't be restored from the journal; MP3GAIN_UNDO tags revert it instead
+	var jrnl *journal.Journal
+	if !analyzeOnly && !undoGain && applyGain == "" {
+		jrnl = openJournal("")
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		Threads:     threads,
+		Journal:     jrnl,
+		AnalyzeOnly: analyzeOnly,
+		ApplyGain:   applyGain,
+	})
+
+	err = proc.ProcessFiles(files, command, threads)
+	// Closed before exiting, so failed runs can still be restored
+	if jrnl != nil {
+		closeJournal(jrnl)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+	if stats := proc.Statistics(); stats.Failed > 0 || stats.GainWriteFailed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runCovers(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	reports := cover.Survey(files, threads)
+	fmt.Printf("Scanning directory: %s\n", path)
+	fmt.Printf("Found %d audio files in %d albums\n\n", len(files), len(reports))
+
+	complete, missing, partial, inconsistent, thumbnails, extracted, failed := 0, 0, 0, 0, 0, 0, 0
+	for i, report := range reports {
+		fmt.Printf("[%d/%d] %s (%d tracks)\n", i+1, len(reports), report.RelDir, report.Tracks)
+		for _, err := range report.Errors {
+			fmt.Printf("  Error: %v\n", err)
+		}
+		failed += len(report.Errors)
+
+		ok := true
+		if report.Missing() {
+			missing++
+			ok = false
+			fmt.Println("  Missing art: no track has embedded art")
+		} else if report.Partial() {
+			partial++
+			ok = false
+			fmt.Printf("  Missing art: %d/%d tracks\n", report.Tracks-report.WithArt, report.Tracks)
+		}
+		if report.Inconsistent() {
+			inconsistent++
+			ok = false
+			fmt.Printf("  Inconsistent art: %d different images\n", len(report.Images))
+			for _, img := range report.Images {
+				fmt.Printf("    %s in %d tracks\n", img, img.Tracks)
+			}
+		}
+		if tiny := report.Thumbnails(minSize); len(tiny) > 0 {
+			thumbnails++
+			ok = false
+			for _, img := range tiny {
+				fmt.Printf("  Tiny thumbnail: %s (< %dpx)\n", img, minSize)
+			}
+		}
+		if ok {
+			complete++
+			fmt.Printf("  Art: %s\n", report.Primary())
+		}
+
+		if extract && !report.Missing() {
+			target, err := cover.Extract(report, force)
+			switch {
+			case err == nil:
+				extracted++
+				fmt.Printf("  Extracted: %s\n", target)
+			case errors.Is(err, cover.ErrCoverExists):
+				fmt.Printf("  Not extracted: %s exists (use -f to replace)\n", filepath.Base(target))
+			default:
+				fmt.Printf("  Extract failed: %v\n", err)
+			}
+		}
+	}
+
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Albums: %d\n", len(reports))
+	fmt.Printf("  Complete art: %d\n", complete)
+	fmt.Printf("  Missing art: %d\n", missing)
+	fmt.Printf("  Partial art: %d\n", partial)
+	fmt.Printf("  Inconsistent art: %d\n", inconsistent)
+	fmt.Printf("  Tiny thumbnails: %d\n", thumbnails)
+	if extract {
+		fmt.Printf("  Extracted: %d\n", extracted)
+	}
+	fmt.Printf("  Failed: %d\n", failed)
+	fmt.Println()
+}
+
+func runCue(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	files, entries := matchCues(files, false)
+	if len(files) == 0 {
+		return
+	}
+
+	jrnl := openJournal(outdir)
+	if jrnl != nil {
+		defer closeJournal(jrnl)
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:  outdir,
+		Threads: threads,
+		Journal: jrnl,
+		Cue:     entries,
+	})
+
+	if err := proc.ProcessFiles(files, "cue", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// matchCues matches the files against the cue sheets in their directories and reports
+// unmatched tracks and files. Returns the matched files and their cue entries.
+// The report goes to stderr when quiet, to keep JSON output machine-readable.
+func matchCues(files []scanner.AudioFile, quiet bool) ([]scanner.AudioFile, map[string]processor.CueEntry) {
+	out := os.Stdout
+	if quiet {
+		out = os.Stderr
+	}
+
+	results, errs := cue.Scan(files)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	for _, result := range results {
+		sheet := result.Sheet
+		rel, err := filepath.Rel(files[0].BasePath, sheet.Path)
+		if err != nil {
+			rel = sheet.Path
+		}
+		encoding := ""
+		if sheet.Charset != "UTF-8" {
+			encoding = ", " + sheet.Charset + "→UTF-8"
+		}
+		fmt.Fprintf(out, "Cue sheet: %s (%d tracks, %d matched%s)\n", rel, len(sheet.Tracks), len(result.Matches), encoding)
+		for _, track := range result.UnmatchedTracks {
+			fmt.Fprintf(out, "  Unmatched track %02d: %q\n", track.Number, track.Title)
+		}
+		for _, file := range result.UnmatchedFiles {
+			fmt.Fprintf(out, "  Unmatched file: %s\n", file.RelPath)
+		}
+	}
+
+	entries := processor.CueEntries(results)
+	var matched []scanner.AudioFile
+	for _, file := range files {
+		if _, ok := entries[file.Path]; ok {
+			matched = append(matched, file)
+		}
+	}
+
+	if len(results) == 0 {
+		fmt.Fprintln(out, "No cue sheets found")
+	} else if len(matched) == 0 {
+		fmt.Fprintln(out, "No files matched")
+	} else {
+		fmt.Fprintln(out)
+	}
+	return matched, entries
+}
+
+func runImport(cmd *cobra.Command, args []string) {
+	path := args[0]
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	files, entries := matchImport(files, args[1], false)
+	if len(files) == 0 {
+		return
+	}
+
+	jrnl := openJournal(outdir)
+	if jrnl != nil {
+		defer closeJournal(jrnl)
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:  outdir,
+		Threads: threads,
+		Journal: jrnl,
+		Import:  entries,
+	})
+
+	if err := proc.ProcessFiles(files, "import", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runSet(cmd *cobra.Command, args []string) {
+	path := args[0]
+	switch format {
+	case processor.FormatText, processor.FormatUnified, processor.FormatJSON:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown format %q (use text, unified or json)\n", format)
+		os.Exit(1)
+	}
+
+	spec := &processor.SetSpec{Values: make(map[string]string)}
+	for field, value := range setValues {
+		if cmd.Flags().Changed(field) {
+			spec.Values[field] = strings.TrimSpace(*value)
+		}
+	}
+	for _, field := range clears {
+		spec.Clear = append(spec.Clear, strings.ToLower(strings.TrimSpace(field)))
+	}
+	for _, r := range replaces {
+		replacement, err := processor.ParseReplacement(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		spec.Replaces = append(spec.Replaces, replacement)
+	}
+	if err := spec.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if spec.Empty() {
+		fmt.Fprintln(os.Stderr, "Error: nothing to set (use --title, --artist, --album, --genre, --comment, --year, --track, --clear or --replace)")
+		os.Exit(1)
+	}
+
+	filter := parseWhere()
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Keep JSON diffs machine-readable
+	out := os.Stdout
+	if dryRun && format == processor.FormatJSON {
+		out = os.Stderr
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(out, "No audio files found")
+		return
+	}
+
+	if filter != nil {
+		files = query.Files(selectFiles(files, filter, nil, threads, out))
+		if len(files) == 0 {
+			return
+		}
+	}
+
+	if dryRun {
+		proc := processor.New(processor.ProcessOptions{
+			Threads: threads,
+			Format:  format,
+			Set:     spec,
+		})
+		if err := proc.ProcessFiles(files, "test", threads); err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	jrnl := openJournal(outdir)
+	if jrnl != nil {
+		defer closeJournal(jrnl)
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:  outdir,
+		Threads: threads,
+		Journal: jrnl,
+		Set:     spec,
+	})
+
+	if err := proc.ProcessFiles(files, "set", threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseWhere parses the --where filter expression, nil without one
+func parseWhere() *query.Filter {
+	if where == "" {
+		return nil
+	}
+	filter, err := query.Parse(where)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return filter
+}
+
+// selectFiles evaluates a filter (nil keeps every file) and reads the preload fields with a
+// worker pool, reports files that can't be evaluated, and the match count to out when filtering
+func selectFiles(files []scanner.AudioFile, filter *query.Filter, preload []string, threads int, out *os.File) []*query.Subject {
+	subjects, errs := query.Collect(files, filter, preload, threads)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	if filter != nil {
+		fmt.Fprintf(out, "Where: %s (%d of %d files)\n\n", filter, len(subjects), len(files))
+	}
+	return subjects
+}
+
+// queryFiles applies --where, --sort and --fields to the files of scan and check. With --fields
+// it prints the table and returns nil; otherwise it returns the files to display, in order.
+func queryFiles(files []scanner.AudioFile, threads int) []scanner.AudioFile {
+	filter := parseWhere()
+	for i := range fieldNames {
+		fieldNames[i] = strings.ToLower(strings.TrimSpace(fieldNames[i]))
+	}
+	keys, err := query.ParseSort(sortBy)
+	if err == nil {
+		err = query.CheckFields(fieldNames)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if filter == nil && len(keys) == 0 && len(fieldNames) == 0 {
+		return files
+	}
+
+	// The table goes to stdout alone, so it can be piped
+	out := os.Stdout
+	if len(fieldNames) > 0 {
+		out = os.Stderr
+	}
+	preload := append([]string(nil), fieldNames...)
+	for _, key := range keys {
+		preload = append(preload, key.Field)
+	}
+	subjects := selectFiles(files, filter, preload, threads, out)
+	query.Sort(subjects, keys)
+
+	if len(fieldNames) > 0 {
+		if err := query.WriteTable(os.Stdout, subjects, fieldNames); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return nil
+	}
+	return query.Files(subjects)
+}
+
+// matchImport loads an edited tag database, matches its rows to the files and reports unknown
+// columns, invalid rows, rows for missing files and conflicts. Returns the matched files and
+// their rows. The report goes to stderr when quiet, to keep JSON output machine-readable.
+func matchImport(files []scanner.AudioFile, tablePath string, quiet bool) ([]scanner.AudioFile, map[string]processor.ImportEntry) {
+	out := os.Stdout
+	if quiet {
+		out = os.Stderr
+	}
+
+	table, err := catalog.Load(tablePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	result, err := catalog.MatchFiles(table, files, threads, force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	byHash := 0
+	for _, match := range result.Matches {
+		if match.By == catalog.ByHash {
+			byHash++
+		}
+	}
+	fmt.Fprintf(out, "Import: %s (%d rows, %d matched, %d by hash)\n", tablePath, len(table.Rows), len(result.Matches), byHash)
+	for _, column := range table.Unknown {
+		fmt.Fprintf(out, "  Unknown column: %q (ignored)\n", column)
+	}
+	for _, row := range result.Invalid {
+		fmt.Fprintf(out, "  Invalid row %d: %v\n", row.Line, row.Err)
+	}
+	for _, row := range result.Missing {
+		fmt.Fprintf(out, "  Missing file (row %d): %s\n", row.Line, describeRow(row))
+	}
+	for _, conflict := range result.Conflicts {
+		name := describeRow(conflict.Row)
+		if conflict.File != nil {
+			name = conflict.File.RelPath
+		}
+		fmt.Fprintf(out, "  Conflict (row %d): %s, %s\n", conflict.Row.Line, name, conflict.Reason)
+	}
+
+	entries := processor.ImportEntries(result)
+	var matched []scanner.AudioFile
+	for _, file := range files {
+		if _, ok := entries[file.Path]; ok {
+			matched = append(matched, file)
+		}
+	}
+
+	if len(matched) == 0 {
+		fmt.Fprintln(out, "No files matched")
+	} else {
+		fmt.Fprintln(out)
+	}
+	return matched, entries
+}
+
+// describeRow names a row by its path, or its hash when it has none
+func describeRow(row *catalog.Row) string {
+	if path := row.Values["path"]; path != "" {
+		return path
+	}
+	return "hash " + row.Values["hash"]
+}
+
+func runLyrics(cmd *cobra.Command, args []string) {
+	path := args[0]
+	if len(lang) != 3 {
+		fmt.Fprintf(os.Stderr, "Error: language must be a three-letter ISO 639-2 code, got %q\n", lang)
+		os.Exit(1)
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	command := "lyrics"
+	var jrnl *journal.Journal
+	if exportLrc {
+		// Exporting only writes .lrc files, there are no tags to journal
+		command = "lyrics-export"
+	} else {
+		jrnl = openJournal(outdir)
+		if jrnl != nil {
+			defer closeJournal(jrnl)
+		}
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:         outdir,
+		Threads:        threads,
+		Journal:        jrnl,
+		SyncedLyrics:   synced,
+		LyricsLanguage: lang,
+		ReplaceLyrics:  force,
+	})
+
+	if err := proc.ProcessFiles(files, command, threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runChapters(cmd *cobra.Command, args []string) {
+	path := args[0]
+	renamed := make(map[int]string)
+	for _, rename := range renames {
+		number, title, ok := strings.Cut(rename, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(number))
+		if !ok || err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "Error: --rename expects N=Title with N counting from 1, got %q\n", rename)
+			os.Exit(1)
+		}
+		renamed[n] = title
+	}
+	edit := importChaps || len(renamed) > 0 || shift != 0
+	if exportChaps != "" {
+		if edit {
+			fmt.Fprintln(os.Stderr, "Error: --export can't be combined with --import, --rename or --shift")
+			os.Exit(1)
+		}
+		if _, err := chapters.Format(nil, exportChaps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No audio files found")
+		return
+	}
+
+	command := "chapters"
+	var jrnl *journal.Journal
+	switch {
+	case exportChaps != "":
+		command = "chapters-export"
+	case edit:
+		command = "chapters-edit"
+		jrnl = openJournal(outdir)
+		if jrnl != nil {
+			defer closeJournal(jrnl)
+		}
+	}
+
+	proc := processor.New(processor.ProcessOptions{
+		OutDir:          outdir,
+		Threads:         threads,
+		Journal:         jrnl,
+		ImportChapters:  importChaps,
+		ChapterRenames:  renamed,
+		ChapterShift:    shift,
+		ExportChapters:  exportChaps,
+		ReplaceChapters: force,
+	})
+
+	if err := proc.ProcessFiles(files, command, threads); err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runExport writes the tag database of a directory. Progress goes to stderr so stdout stays
+// machine-readable when the database is written there.
+func runExport(cmd *cobra.Command, args []string) {
+	path := args[0]
+	if format == "" {
+		format = catalog.FormatFromPath(output)
+	}
+	if output != "" && !force {
+		if _, err := os.Stat(output); err == nil {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists (use -f to replace it)\n", output)
+			os.Exit(1)
+		}
+	}
+
+	files, err := scanner.ScanDirectory(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	exporter, err := catalog.Create(output, format, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Scanning directory: %s\n", path)
+	fmt.Fprintf(os.Stderr, "Found %d audio files\n", len(files))
+
+	records, errs := catalog.Collect(files, threads)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	charsets := make(map[string]int)
+	for _, record := range records {
+		if err := exporter.Write(record); err != nil {
+			exporter.Close()
+			fmt.Fprintf(os.Stderr, "Error: failed to export %s: %v\n", record.File.Path, err)
+			os.Exit(1)
+		}
+		if record.Charset != "" && record.Charset != "UTF-8" {
+			charsets[record.Charset]++
+		}
+	}
+	if err := exporter.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	destination := output
+	if destination == "" {
+		destination = "stdout"
+	}
+	legacy := 0
+	for _, count := range charsets {
+		legacy += count
+	}
+	fmt.Fprintln(os.Stderr, "\n---")
+	fmt.Fprintln(os.Stderr, "\nStatistics:")
+	fmt.Fprintf(os.Stderr, "  Total files: %d\n", len(files))
+	fmt.Fprintf(os.Stderr, "  Exported: %d (%s to %s)\n", len(records), format, destination)
+	fmt.Fprintf(os.Stderr, "  Legacy charsets: %d\n", legacy)
+	fmt.Fprintf(os.Stderr, "  Failed: %d\n", len(errs))
+}
+
+// loadPipeline compiles the rule pipeline from --rules and --cleanup (nil means the built-in pipeline)
+func loadPipeline() *processor.Pipeline {
+	if rules == "" && cleanup == "" {
+		return nil
+	}
+
+	config := processor.DefaultPipelineConfig()
+	if rules != "" {
+		var err error
+		config, err = processor.LoadPipelineConfig(rules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading rules: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cleanup != "" {
+		config.SetCleanupFile(cleanup)
+	}
+
+	pipeline, err := processor.CompilePipeline(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error compiling rules: %v\n", err)
+		os.Exit(1)
+	}
+	return pipeline
+}
+
+// openJournal creates an undo journal for in-place runs (nil when writing to an output directory)
+func openJournal(outputDir string) *journal.Journal {
+	if outputDir != "" {
+		return nil
+	}
+
+	jrnl, err := journal.Create(stateDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating journal: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Run ID: %s (undo with: mp3tools restore %s)\n\n", jrnl.RunID, jrnl.RunID)
+	return jrnl
+}
+
+// closeJournal closes the journal and reports where it was written
+func closeJournal(jrnl *journal.Journal) {
+	if err := jrnl.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error closing journal: %v\n", err)
+		return
+	}
+	fmt.Printf("Journal: %s\n", jrnl.Path())
 }
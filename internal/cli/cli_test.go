@@ -0,0 +1,49 @@
+package cli
+
+import "testing"
+
+// TestFlagDefaults checks where each command writes when neither -o nor -u is given.
+// The flags share variables, so this catches a command picking up another command's default.
+func TestFlagDefaults(t *testing.T) {
+	tests := map[string]struct {
+		outdir string
+		update bool
+	}{
+		"scan":     {"", false},
+		"fix":      {"output", false},
+		"tag":      {"output", true},
+		"test":     {"", true},
+		"cue":      {"", false},
+		"repair":   {"output", false},
+		"trim":     {"output", false},
+		"split":    {"output", false},
+		"merge":    {"output", false},
+		"import":   {"", false},
+		"set":      {"", false},
+		"lyrics":   {"", false},
+		"chapters": {"", false},
+	}
+
+	for _, cmd := range rootCmd.Commands() {
+		flags := cmd.Flags()
+		if flags.Lookup("outdir") == nil && flags.Lookup("update") == nil {
+			continue
+		}
+		want, ok := tests[cmd.Name()]
+		if !ok {
+			t.Errorf("%s: -o/-u defaults not covered by this test", cmd.Name())
+			continue
+		}
+
+		// Leave values another command would have set
+		outdir, update = "elsewhere", !want.update
+		resetFlagDefaults(cmd, nil)
+
+		if flags.Lookup("outdir") != nil && outdir != want.outdir {
+			t.Errorf("%s: outdir = %q, want %q", cmd.Name(), outdir, want.outdir)
+		}
+		if flags.Lookup("update") != nil && update != want.update {
+			t.Errorf("%s: update = %v, want %v", cmd.Name(), update, want.update)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxSize is the default maximum width/height of embedded covers
+const DefaultMaxSize = 800
+
+// jpegQuality is the quality used when recompressing covers
+const jpegQuality = 85
+
+// coverNames lists cover file base names in order of preference
+var coverNames = []string{"cover", "folder", "front"}
+
+// imageExtensions lists supported cover file extensions
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+}
+
+// Image is a cover prepared for embedding
+type Image struct {
+	Source   string // Path of the cover file
+	Data     []byte // Encoded image data
+	MimeType string // image/jpeg or image/png
+	Width    int
+	Height   int
+	Resized  bool // Image was scaled down and recompressed
+}
+
+// String describes the image for display
+func (img *Image) String() string {
+	desc := fmt.Sprintf("%s %dx%d (%d KB)", filepath.Base(img.Source), img.Width, img.Height, (len(img.Data)+1023)/1024)
+	if img.Resized {
+		desc += " resized"
+	}
+	return desc
+}
+
+// FindCover looks for cover.*, folder.* or front.* in a directory (case-insensitive)
+func FindCover(dir string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for _, name := range coverNames {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			base := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+			if base == name && imageExtensions[ext] {
+				return filepath.Join(dir, entry.Name()), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Prepare loads a cover image, scaling it down to fit maxSize and recompressing it as JPEG if needed.
+// Small JPEG and PNG files are embedded unchanged.
+func Prepare(path string, maxSize int) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover: %w", err)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover %s: %w", path, err)
+	}
+
+	bounds := src.Bounds()
+	img := &Image{
+		Source: path,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}
+
+	fits := maxSize <= 0 || (img.Width <= maxSize && img.Height <= maxSize)
+	if fits && (format == "jpeg" || format == "png") {
+		img.Data = data
+		img.MimeType = "image/" + format
+		return img, nil
+	}
+
+	// Scale down keeping the aspect ratio
+	if !fits {
+		if img.Width >= img.Height {
+			img.Height = max(1, img.Height*maxSize/img.Width)
+			img.Width = maxSize
+		} else {
+			img.Width = max(1, img.Width*maxSize/img.Height)
+			img.Height = maxSize
+		}
+		img.Resized = true
+	}
+
+	// JPEG has no alpha: composite transparent PNG/WebP covers onto white, as viewers show them
+	dst := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode cover: %w", err)
+	}
+	img.Data = buf.Bytes()
+	img.MimeType = "image/jpeg"
+
+	return img, nil
+}
+
+// Cache prepares the cover of each directory once, shared by all worker threads
+type Cache struct {
+	maxSize int
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry holds the prepared cover of one directory
+type cacheEntry struct {
+	once sync.Once
+	img  *Image
+	err  error
+}
+
+// NewCache creates a cover cache that scales covers to maxSize
+func NewCache(maxSize int) *Cache {
+	return &Cache{
+		maxSize: maxSize,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Get returns the prepared cover of a directory, or nil if it has none
+func (c *Cache) Get(dir string) (*Image, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[dir]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[dir] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		path, found := FindCover(dir)
+		if !found {
+			return
+		}
+		entry.img, entry.err = Prepare(path, c.maxSize)
+	})
+
+	return entry.img, entry.err
+}
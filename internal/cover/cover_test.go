@@ -0,0 +1,195 @@
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mp3tools/internal/scanner"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// writePNG writes a solid PNG image of the given size
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+}
+
+func TestFindCover(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, found := FindCover(tmpDir); found {
+		t.Error("Expected no cover in empty directory")
+	}
+
+	writePNG(t, filepath.Join(tmpDir, "Front.png"), 10, 10)
+	writePNG(t, filepath.Join(tmpDir, "folder.png"), 10, 10)
+
+	// folder.* is preferred over front.*
+	path, found := FindCover(tmpDir)
+	if !found || filepath.Base(path) != "folder.png" {
+		t.Errorf("Expected folder.png, got %q", path)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	tmpDir := t.TempDir()
+	small := filepath.Join(tmpDir, "small.png")
+	large := filepath.Join(tmpDir, "large.png")
+	writePNG(t, small, 100, 50)
+	writePNG(t, large, 400, 200)
+
+	// Small images are embedded unchanged
+	img, err := Prepare(small, 200)
+	if err != nil {
+		t.Fatalf("Failed to prepare cover: %v", err)
+	}
+	original, _ := os.ReadFile(small)
+	if img.Resized || img.MimeType != "image/png" || len(img.Data) != len(original) {
+		t.Errorf("Expected unchanged PNG, got %s %s", img.MimeType, img)
+	}
+
+	// Large images are scaled down keeping the aspect ratio
+	img, err = Prepare(large, 200)
+	if err != nil {
+		t.Fatalf("Failed to prepare cover: %v", err)
+	}
+	if !img.Resized || img.Width != 200 || img.Height != 100 || img.MimeType != "image/jpeg" {
+		t.Errorf("Expected 200x100 JPEG, got %dx%d %s", img.Width, img.Height, img.MimeType)
+	}
+}
+
+func TestPrepareTransparent(t *testing.T) {
+	// A fully transparent PNG must not turn black when recompressed as JPEG
+	path := filepath.Join(t.TempDir(), "cover.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create image: %v", err)
+	}
+	if err := png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 400, 400))); err != nil {
+		t.Fatalf("Failed to encode image: %v", err)
+	}
+	f.Close()
+
+	img, err := Prepare(path, 100)
+	if err != nil {
+		t.Fatalf("Failed to prepare cover: %v", err)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("Failed to decode prepared cover: %v", err)
+	}
+	r, g, b, _ := decoded.At(50, 50).RGBA()
+	if r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("Expected transparent areas to become white, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+// writeTrack writes an MP3 file embedding the given front cover (nil for none)
+func writeTrack(t *testing.T, path string, picture []byte) {
+	t.Helper()
+
+	tag := id3v2.NewEmptyTag()
+	tag.SetVersion(3)
+	tag.SetTitle(filepath.Base(path))
+	if picture != nil {
+		tag.AddAttachedPicture(id3v2.PictureFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			MimeType:    "image/png",
+			PictureType: id3v2.PTFrontCover,
+			Picture:     picture,
+		})
+	}
+
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write tag: %v", err)
+	}
+	// One silent MPEG-1 Layer III frame
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	buf.Write(frame)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write track: %v", err)
+	}
+}
+
+func TestSurveyAndExtract(t *testing.T) {
+	tmpDir := t.TempDir()
+	writePNG(t, filepath.Join(tmpDir, "large.png"), 400, 400)
+	writePNG(t, filepath.Join(tmpDir, "small.png"), 100, 100)
+	large, _ := os.ReadFile(filepath.Join(tmpDir, "large.png"))
+	small, _ := os.ReadFile(filepath.Join(tmpDir, "small.png"))
+
+	music := filepath.Join(tmpDir, "music")
+	for _, dir := range []string{"complete", "mixed", "none"} {
+		os.MkdirAll(filepath.Join(music, dir), 0755)
+	}
+	writeTrack(t, filepath.Join(music, "complete", "1.mp3"), large)
+	writeTrack(t, filepath.Join(music, "complete", "2.mp3"), large)
+	writeTrack(t, filepath.Join(music, "mixed", "1.mp3"), small)
+	writeTrack(t, filepath.Join(music, "mixed", "2.mp3"), large)
+	writeTrack(t, filepath.Join(music, "mixed", "3.mp3"), small)
+	writeTrack(t, filepath.Join(music, "mixed", "4.mp3"), nil)
+	writeTrack(t, filepath.Join(music, "none", "1.mp3"), nil)
+
+	files, err := scanner.ScanDirectory(music)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	reports := Survey(files, 2)
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 albums, got %d", len(reports))
+	}
+	complete, mixed, none := reports[0], reports[1], reports[2]
+
+	if complete.Missing() || complete.Partial() || complete.Inconsistent() || len(complete.Thumbnails(DefaultMinSize)) != 0 {
+		t.Errorf("Expected complete album without issues: %+v", complete)
+	}
+	if !mixed.Partial() || !mixed.Inconsistent() || len(mixed.Thumbnails(DefaultMinSize)) != 1 {
+		t.Errorf("Expected partial, inconsistent album with a thumbnail: %+v", mixed)
+	}
+	if primary := mixed.Primary(); primary.Tracks != 2 || primary.Width != 100 {
+		t.Errorf("Expected the 100x100 image in 2 tracks first, got %s in %d tracks", primary, primary.Tracks)
+	}
+	if !none.Missing() {
+		t.Errorf("Expected album without art: %+v", none)
+	}
+
+	// Extraction converts the PNG to cover.jpg and keeps existing covers
+	target, err := Extract(complete, false)
+	if err != nil {
+		t.Fatalf("Failed to extract: %v", err)
+	}
+	img, err := Prepare(target, 0)
+	if err != nil || img.MimeType != "image/jpeg" || img.Width != 400 {
+		t.Errorf("Expected 400x400 JPEG cover, got %v (%v)", img, err)
+	}
+	if _, err := Extract(complete, false); !errors.Is(err, ErrCoverExists) {
+		t.Errorf("Expected ErrCoverExists, got %v", err)
+	}
+	if _, err := Extract(none, true); err == nil {
+		t.Error("Expected error extracting from album without art")
+	}
+}
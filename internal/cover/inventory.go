@@ -0,0 +1,195 @@
+package cover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+)
+
+// DefaultMinSize is the default width/height below which embedded art counts as a thumbnail
+const DefaultMinSize = 300
+
+// ExtractName is the file name embedded art is extracted to
+const ExtractName = "cover.jpg"
+
+// ErrCoverExists is returned when extracting into a directory that already has a cover file
+var ErrCoverExists = errors.New("cover file already exists")
+
+// Embedded is one distinct image embedded in the tracks of an album
+type Embedded struct {
+	Data     []byte
+	MimeType string
+	Width    int // 0 if the image could not be decoded
+	Height   int
+	Tracks   int // Number of tracks embedding this image
+	hash     [sha256.Size]byte
+}
+
+// String describes the image for display
+func (e *Embedded) String() string {
+	size := "?x?"
+	if e.Width > 0 {
+		size = fmt.Sprintf("%dx%d", e.Width, e.Height)
+	}
+	return fmt.Sprintf("%s %s (%d KB)", size, e.MimeType, (len(e.Data)+1023)/1024)
+}
+
+// AlbumReport summarizes the embedded art of one album directory
+type AlbumReport struct {
+	Dir     string      // Absolute directory path
+	RelDir  string      // Directory relative to the scanned root
+	Tracks  int         // Number of tracks
+	WithArt int         // Tracks with embedded art
+	Images  []*Embedded // Distinct front covers, most common first
+	Errors  []error     // Tracks whose tags could not be read
+}
+
+// Missing reports whether no track of the album has art
+func (r *AlbumReport) Missing() bool {
+	return r.WithArt == 0
+}
+
+// Partial reports whether only some tracks of the album have art
+func (r *AlbumReport) Partial() bool {
+	return r.WithArt > 0 && r.WithArt < r.Tracks
+}
+
+// Inconsistent reports whether tracks embed different images
+func (r *AlbumReport) Inconsistent() bool {
+	return len(r.Images) > 1
+}
+
+// Thumbnails returns the images smaller than minSize in either dimension
+func (r *AlbumReport) Thumbnails(minSize int) []*Embedded {
+	var tiny []*Embedded
+	for _, img := range r.Images {
+		if img.Width > 0 && (img.Width < minSize || img.Height < minSize) {
+			tiny = append(tiny, img)
+		}
+	}
+	return tiny
+}
+
+// Primary returns the most common embedded image, or nil if the album has no art
+func (r *AlbumReport) Primary() *Embedded {
+	if len(r.Images) == 0 {
+		return nil
+	}
+	return r.Images[0]
+}
+
+// Survey reads the front cover of every file and groups the results by album directory.
+// Albums are returned in scan order.
+func Survey(files []scanner.AudioFile, threads int) []*AlbumReport {
+	var reports []*AlbumReport
+	byDir := make(map[string]*AlbumReport)
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		report, ok := byDir[dir]
+		if !ok {
+			report = &AlbumReport{Dir: dir, RelDir: filepath.Dir(file.RelPath)}
+			byDir[dir] = report
+			reports = append(reports, report)
+		}
+		report.Tracks++
+	}
+
+	var mu sync.Mutex
+	workers.Run(len(files), threads, func(index int) {
+		file := files[index]
+		pictures, err := tagger.ReadPictures(file.Path)
+		front := tagger.FrontCover(pictures)
+		report := byDir[filepath.Dir(file.Path)]
+
+		mu.Lock()
+		switch {
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Errorf("failed to read pictures from %s: %w", file.Path, err))
+		case front != nil:
+			report.WithArt++
+			report.add(front)
+		}
+		mu.Unlock()
+	})
+
+	for _, report := range reports {
+		report.sort()
+	}
+	return reports
+}
+
+// add counts a track's front cover, keeping the data of each distinct image once
+func (r *AlbumReport) add(pic *tagger.Picture) {
+	hash := sha256.Sum256(pic.Data)
+	for _, img := range r.Images {
+		if img.hash == hash {
+			img.Tracks++
+			return
+		}
+	}
+
+	img := &Embedded{
+		Data:     pic.Data,
+		MimeType: pic.MimeType,
+		Tracks:   1,
+		hash:     hash,
+	}
+	if config, format, err := image.DecodeConfig(bytes.NewReader(pic.Data)); err == nil {
+		img.Width = config.Width
+		img.Height = config.Height
+		if img.MimeType == "" {
+			img.MimeType = "image/" + format
+		}
+	}
+	r.Images = append(r.Images, img)
+}
+
+// sort orders images by the number of tracks embedding them, most common first
+func (r *AlbumReport) sort() {
+	sort.SliceStable(r.Images, func(i, j int) bool {
+		return r.Images[i].Tracks > r.Images[j].Tracks
+	})
+}
+
+// Extract writes the album's most common image to cover.jpg in its directory,
+// converting other formats to JPEG. An existing cover file is only replaced if overwrite is set.
+func Extract(report *AlbumReport, overwrite bool) (string, error) {
+	img := report.Primary()
+	if img == nil {
+		return "", errors.New("album has no embedded art")
+	}
+
+	target := filepath.Join(report.Dir, ExtractName)
+	if existing, found := FindCover(report.Dir); found && !overwrite {
+		return existing, ErrCoverExists
+	}
+
+	data := img.Data
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "jpeg" {
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode embedded art: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return "", fmt.Errorf("failed to encode cover: %w", err)
+		}
+		data = buf.Bytes()
+	}
+
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write cover: %w", err)
+	}
+	return target, nil
+}
@@ -0,0 +1,379 @@
+package cue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/encoder"
+	"mp3tools/internal/scanner"
+)
+
+// Sheet is a parsed cue sheet
+type Sheet struct {
+	Path      string
+	Charset   string // Charset the file was converted from (UTF-8 if unchanged)
+	Title     string // Album title
+	Performer string // Album artist
+	Date      string // REM DATE
+	Genre     string // REM GENRE
+	Tracks    []Track
+}
+
+// Track is one TRACK entry of a cue sheet
+type Track struct {
+	Number    int
+	Title     string
+	Performer string        // Track performer, falls back to the album performer
+	File      string        // FILE the track belongs to
+	Start     time.Duration // INDEX 01 position within the file
+}
+
+// Match pairs a cue track with an audio file
+type Match struct {
+	Track Track
+	File  scanner.AudioFile
+	By    string // How the file was matched: file, number, title or order
+}
+
+// Result is the outcome of matching one cue sheet against the audio files of its directory
+type Result struct {
+	Sheet           *Sheet
+	Matches         []Match
+	UnmatchedTracks []Track
+	UnmatchedFiles  []scanner.AudioFile
+}
+
+// Match methods, strongest first
+const (
+	ByFile   = "file"
+	ByNumber = "number"
+	ByTitle  = "title"
+	ByOrder  = "order"
+)
+
+// LoadFile reads and parses a cue sheet, converting it to UTF-8
+func LoadFile(path string) (*Sheet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cue sheet: %w", err)
+	}
+
+	// Cue sheets are usually GBK
+	text, charset, err := encoder.DecodeText(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cue sheet %s: %w", path, err)
+	}
+
+	sheet, err := Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cue sheet %s: %w", path, err)
+	}
+	sheet.Path = path
+	sheet.Charset = charset
+	return sheet, nil
+}
+
+// Parse parses cue sheet text
+func Parse(text string) (*Sheet, error) {
+	sheet := &Sheet{}
+	var track *Track
+	file := ""
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for n, line := range strings.Split(text, "\n") {
+		fields := splitFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		command := strings.ToUpper(fields[0])
+		arg := ""
+		if len(fields) > 1 {
+			arg = fields[1]
+		}
+
+		switch command {
+		case "REM":
+			if len(fields) > 2 {
+				switch strings.ToUpper(arg) {
+				case "DATE":
+					sheet.Date = fields[2]
+				case "GENRE":
+					sheet.Genre = fields[2]
+				}
+			}
+		case "FILE":
+			file = arg
+		case "TRACK":
+			number, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid track number %q", n+1, arg)
+			}
+			sheet.Tracks = append(sheet.Tracks, Track{Number: number, File: file})
+			track = &sheet.Tracks[len(sheet.Tracks)-1]
+		case "TITLE":
+			if track != nil {
+				track.Title = arg
+			} else {
+				sheet.Title = arg
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = arg
+			} else {
+				sheet.Performer = arg
+			}
+		case "INDEX":
+			if track != nil && arg == "01" && len(fields) > 2 {
+				start, err := parseIndex(fields[2])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", n+1, err)
+				}
+				track.Start = start
+			}
+		}
+	}
+
+	if len(sheet.Tracks) == 0 {
+		return nil, fmt.Errorf("no tracks")
+	}
+	for i := range sheet.Tracks {
+		if sheet.Tracks[i].Performer == "" {
+			sheet.Tracks[i].Performer = sheet.Performer
+		}
+	}
+	return sheet, nil
+}
+
+// splitFields splits a cue line into its command and arguments, honouring double quotes
+func splitFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				// Unterminated quote: take the rest of the line
+				fields = append(fields, line[1:])
+				break
+			}
+			fields = append(fields, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			fields = append(fields, line)
+			break
+		}
+		fields = append(fields, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	return fields
+}
+
+// parseIndex parses an mm:ss:ff index position (75 frames per second)
+func parseIndex(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid index %q", value)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index %q", value)
+		}
+		numbers[i] = n
+	}
+	frames := (numbers[0]*60+numbers[1])*75 + numbers[2]
+	return time.Duration(frames) * time.Second / 75, nil
+}
+
+// leadingNumber matches the track number at the start of a file name ("01 - Title", "1.Title")
+var leadingNumber = regexp.MustCompile(`^(\d+)`)
+
+// trailingNumber matches the track number at the end of a file name ("白眉大侠12")
+var trailingNumber = regexp.MustCompile(`(\d+)$`)
+
+// Scan finds the cue sheets in the directories of the audio files and matches their tracks.
+// Directories without a cue sheet are skipped; cue sheets that fail to load are returned as errors.
+func Scan(files []scanner.AudioFile) ([]*Result, []error) {
+	byDir := make(map[string][]scanner.AudioFile)
+	var dirs []string
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		if _, ok := byDir[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], file)
+	}
+
+	var results []*Result
+	var errs []error
+	for _, dir := range dirs {
+		remaining := byDir[dir]
+		var last *Result
+		for _, path := range findSheets(dir) {
+			sheet, err := LoadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			// A file can only belong to one sheet; files left over are reported by the last sheet
+			if last != nil {
+				last.UnmatchedFiles = nil
+			}
+			last = MatchFiles(sheet, remaining)
+			remaining = last.UnmatchedFiles
+			results = append(results, last)
+		}
+	}
+	return results, errs
+}
+
+// FindImage finds the cue sheet in the directory of an audio file that describes the file
+// as an image of several tracks (a FILE with the same base name), and returns its tracks.
+// The sheet is nil if there is none.
+func FindImage(path string) (*Sheet, []Track, error) {
+	for _, sheetPath := range findSheets(filepath.Dir(path)) {
+		sheet, err := LoadFile(sheetPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		var tracks []Track
+		for _, track := range sheet.Tracks {
+			if strings.EqualFold(baseName(track.File), baseName(path)) {
+				tracks = append(tracks, track)
+			}
+		}
+		if len(tracks) > 1 {
+			return sheet, tracks, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// findSheets lists the .cue files of a directory in name order
+func findSheets(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var sheets []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".cue") {
+			sheets = append(sheets, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return sheets
+}
+
+// MatchFiles pairs the tracks of a sheet with audio files: by the track's FILE name,
+// then by the number in the file name, then by title, and finally by order if the
+// remaining tracks and files line up one to one.
+func MatchFiles(sheet *Sheet, files []scanner.AudioFile) *Result {
+	result := &Result{Sheet: sheet}
+	tracks := append([]Track(nil), sheet.Tracks...)
+	remaining := append([]scanner.AudioFile(nil), files...)
+	sort.SliceStable(remaining, func(i, j int) bool {
+		return remaining[i].Path < remaining[j].Path
+	})
+
+	match := func(by string, same func(track Track, name string) bool) {
+		var unmatched []Track
+		for _, track := range tracks {
+			found := -1
+			for i, file := range remaining {
+				if same(track, baseName(file.Path)) {
+					if found >= 0 {
+						// Ambiguous, leave it to a later method
+						found = -1
+						break
+					}
+					found = i
+				}
+			}
+			if found < 0 {
+				unmatched = append(unmatched, track)
+				continue
+			}
+			result.Matches = append(result.Matches, Match{Track: track, File: remaining[found], By: by})
+			remaining = append(remaining[:found], remaining[found+1:]...)
+		}
+		tracks = unmatched
+	}
+
+	// Tracks of one FILE each are already split: the FILE names the track
+	match(ByFile, func(track Track, name string) bool {
+		return track.File != "" && countFile(sheet, track.File) == 1 && strings.EqualFold(baseName(track.File), name)
+	})
+	match(ByNumber, func(track Track, name string) bool {
+		number, ok := fileNumber(name)
+		return ok && number == track.Number
+	})
+	match(ByTitle, func(track Track, name string) bool {
+		title := normalize(track.Title)
+		return len([]rune(title)) >= 2 && strings.Contains(normalize(name), title)
+	})
+	if len(tracks) == len(remaining) {
+		for i, track := range tracks {
+			result.Matches = append(result.Matches, Match{Track: track, File: remaining[i], By: ByOrder})
+		}
+		tracks, remaining = nil, nil
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Track.Number < result.Matches[j].Track.Number
+	})
+	result.UnmatchedTracks = tracks
+	result.UnmatchedFiles = remaining
+	return result
+}
+
+// countFile counts the tracks belonging to a FILE
+func countFile(sheet *Sheet, file string) int {
+	count := 0
+	for _, track := range sheet.Tracks {
+		if track.File == file {
+			count++
+		}
+	}
+	return count
+}
+
+// fileNumber extracts the track number from the start or end of a file name
+func fileNumber(name string) (int, bool) {
+	match := leadingNumber.FindString(name)
+	if match == "" {
+		match = trailingNumber.FindString(name)
+	}
+	if match == "" {
+		return 0, false
+	}
+	number, err := strconv.Atoi(match)
+	return number, err == nil
+}
+
+// baseName returns the file name without directory and extension
+func baseName(path string) string {
+	name := filepath.Base(strings.ReplaceAll(path, "\\", "/"))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// normalize lower-cases text and drops spaces and punctuation for fuzzy title matching
+func normalize(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ' || r == '\t' || r == '_' || r == '-' || r == '.' || r == '(' || r == ')':
+			return -1
+		}
+		return r
+	}, strings.ToLower(text))
+}
@@ -0,0 +1,107 @@
+package cue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mp3tools/internal/scanner"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+const testSheet = `REM DATE 1995
+PERFORMER "单田芳"
+TITLE "白眉大侠"
+FILE "白眉大侠.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "第一回 徐良出世"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "第二回"
+    PERFORMER "单田芳 王刚"
+    INDEX 01 25:10:30
+  TRACK 07 AUDIO
+    TITLE "第三回 出世"
+    INDEX 01 50:00:00
+  TRACK 08 AUDIO
+    TITLE "第八回 结局"
+`
+
+func TestParse(t *testing.T) {
+	sheet, err := Parse(testSheet)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if sheet.Title != "白眉大侠" || sheet.Performer != "单田芳" || sheet.Date != "1995" || len(sheet.Tracks) != 4 {
+		t.Fatalf("Unexpected sheet: %+v", sheet)
+	}
+
+	second := sheet.Tracks[1]
+	if second.Number != 2 || second.Performer != "单田芳 王刚" || second.File != "白眉大侠.wav" {
+		t.Errorf("Unexpected track: %+v", second)
+	}
+	if expected := 25*time.Minute + 10*time.Second + 400*time.Millisecond; second.Start != expected {
+		t.Errorf("Expected start %v, got %v", expected, second.Start)
+	}
+	if sheet.Tracks[0].Performer != "单田芳" {
+		t.Errorf("Expected album performer fallback, got %q", sheet.Tracks[0].Performer)
+	}
+
+	if _, err := Parse("TITLE \"empty\"\n"); err == nil {
+		t.Error("Expected error for sheet without tracks")
+	}
+}
+
+func TestScan(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"01 track.mp3", "2.mp3", "白眉大侠 第三回 出世.mp3", "bonus.mp3", "extra.mp3"} {
+		os.WriteFile(filepath.Join(tmpDir, name), nil, 0644)
+	}
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String(testSheet)
+	os.WriteFile(filepath.Join(tmpDir, "album.cue"), []byte(gbk), 0644)
+
+	files, err := scanner.ScanDirectory(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	results, errs := Scan(files)
+	if len(errs) != 0 || len(results) != 1 {
+		t.Fatalf("Expected one result, got %d (%v)", len(results), errs)
+	}
+	result := results[0]
+
+	if result.Sheet.Charset == "UTF-8" || result.Sheet.Title != "白眉大侠" {
+		t.Errorf("Expected GBK sheet converted to UTF-8, got %q from %s", result.Sheet.Title, result.Sheet.Charset)
+	}
+
+	// Two files are left for one track, so order matching does not apply
+	expected := map[int]string{1: "01 track.mp3", 2: "2.mp3", 7: "白眉大侠 第三回 出世.mp3"}
+	if len(result.Matches) != len(expected) {
+		t.Fatalf("Expected %d matches, got %+v", len(expected), result.Matches)
+	}
+	for _, match := range result.Matches {
+		if filepath.Base(match.File.Path) != expected[match.Track.Number] {
+			t.Errorf("Track %d matched %s", match.Track.Number, match.File.Path)
+		}
+	}
+	if len(result.UnmatchedTracks) != 1 || result.UnmatchedTracks[0].Number != 8 || len(result.UnmatchedFiles) != 2 {
+		t.Errorf("Expected track 8 and two files unmatched, got %+v %+v", result.UnmatchedTracks, result.UnmatchedFiles)
+	}
+}
+
+func TestFindImage(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "album.cue"), []byte(testSheet), 0644)
+
+	sheet, tracks, err := FindImage(filepath.Join(tmpDir, "白眉大侠.mp3"))
+	if err != nil || sheet == nil || len(tracks) != 4 || tracks[1].Start != 25*time.Minute+10*time.Second+400*time.Millisecond {
+		t.Errorf("Expected the sheet's four tracks for the image, got %+v (%v)", tracks, err)
+	}
+
+	if sheet, _, err := FindImage(filepath.Join(tmpDir, "01.mp3")); sheet != nil || err != nil {
+		t.Errorf("Expected no sheet for another file, got %v (%v)", sheet, err)
+	}
+}
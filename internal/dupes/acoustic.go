@@ -0,0 +1,78 @@
+package dupes
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"mp3tools/internal/fingerprint"
+	"mp3tools/internal/scanner"
+)
+
+// DefaultSimilarity is the fingerprint similarity from which two files are near-duplicates.
+// Unrelated audio scores about 0.5, re-encodes of the same audio well above 0.9.
+const DefaultSimilarity = 0.85
+
+// Files whose durations differ by more than this (or 1% of the longer one) are never compared
+const durationTolerance = 2 * time.Second
+
+// FindAcoustic fingerprints files (through the index, which is not saved) and clusters those
+// whose fingerprints are at least threshold similar, so re-encodes of the same audio match.
+// Clusters are transitive: A~B and B~C put A, B and C in one group.
+func FindAcoustic(files []scanner.AudioFile, threads int, index *fingerprint.Index, threshold float64) ([]*Group, []error) {
+	var errs []error
+	var mu sync.Mutex
+	entries := collect(files, threads, &errs, &mu, func(entry *Entry) error {
+		fp, _, err := index.Lookup(entry.File.Path, fingerprint.DefaultLength)
+		if err != nil {
+			return err
+		}
+		entry.Duration = fp.Duration
+		entry.fingerprint = fp.Values
+		return entry.load()
+	})
+
+	// Compare each file with those of similar duration
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Duration < entries[j].Duration })
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, a := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			b := entries[j]
+			if b.Duration-a.Duration > max(durationTolerance, b.Duration/100) {
+				break
+			}
+			score := fingerprint.Similarity(a.fingerprint, b.fingerprint)
+			if score < threshold {
+				continue
+			}
+			a.Similarity = max(a.Similarity, score)
+			b.Similarity = max(b.Similarity, score)
+			parent[find(i)] = find(j)
+		}
+	}
+
+	byRoot := make(map[int]*Group)
+	var groups []*Group
+	for i, entry := range entries {
+		root := find(i)
+		group, ok := byRoot[root]
+		if !ok {
+			group = &Group{Similarity: 1}
+			byRoot[root] = group
+			groups = append(groups, group)
+		}
+		group.Entries = append(group.Entries, entry)
+		group.Similarity = min(group.Similarity, entry.Similarity)
+	}
+	return sortGroups(groups), errs
+}
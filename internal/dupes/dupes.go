@@ -0,0 +1,315 @@
+package dupes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+)
+
+// Keep policies choosing which copy of a group survives
+const (
+	KeepLongestTag = "longest-tag" // Copy whose tags carry the most text
+	KeepNewest     = "newest"      // Most recently modified copy
+	KeepPath       = "path"        // First copy under a preferred path
+)
+
+// Actions applied to the extra copies of a group
+const (
+	ActionDelete   = "delete"
+	ActionHardlink = "hardlink" // Replace extras with hard links to the kept copy
+	ActionMove     = "move"     // Move extras to another directory, preserving their relative paths
+)
+
+// ErrUnknownPolicy is returned for keep policies other than the Keep* values
+var ErrUnknownPolicy = errors.New("unknown keep policy")
+
+// Entry is one file of a duplicate group
+type Entry struct {
+	File      scanner.AudioFile
+	Hash      string // SHA-256 of the MPEG audio payload (tags excluded)
+	AudioSize int64
+	Size      int64
+	ModTime   time.Time
+	Meta      *tagger.Metadata // nil if the tags could not be read
+
+	// Acoustic matching (FindAcoustic only)
+	Duration    time.Duration
+	Similarity  float64 // Best similarity to another copy in the group
+	fingerprint []uint32
+}
+
+// TagLength returns the amount of tag text of the entry, used by the longest-tag policy
+func (e *Entry) TagLength() int {
+	if e.Meta == nil {
+		return 0
+	}
+	length := 0
+	for _, value := range []string{e.Meta.Title, e.Meta.Artist, e.Meta.Album, e.Meta.Genre, e.Meta.Comment} {
+		length += utf8.RuneCountInString(value)
+	}
+	if e.Meta.Year != 0 {
+		length += len(strconv.Itoa(e.Meta.Year))
+	}
+	if e.Meta.Track != 0 {
+		length += len(strconv.Itoa(e.Meta.Track))
+	}
+	return length
+}
+
+// Group is a set of files with the same audio payload
+type Group struct {
+	Hash       string   // Empty for acoustic groups
+	Similarity float64  // Lowest entry similarity (1 for identical payloads)
+	Entries    []*Entry // Sorted by relative path
+}
+
+// Wasted returns the bytes taken by the copies other than keep
+func (g *Group) Wasted(keep *Entry) int64 {
+	var wasted int64
+	for _, entry := range g.Entries {
+		if entry != keep {
+			wasted += entry.Size
+		}
+	}
+	return wasted
+}
+
+// Find hashes the audio payload of files whose payload sizes collide and returns the groups
+// of identical payloads, largest first. Files that fail to read are returned as errors.
+func Find(files []scanner.AudioFile, threads int) ([]*Group, []error) {
+	var errs []error
+	var mu sync.Mutex
+
+	// Only files sharing a payload size can be duplicates, so hash those alone
+	entries := collect(files, threads, &errs, &mu, func(entry *Entry) error {
+		layout, err := mpeg.ReadFileLayout(entry.File.Path)
+		if err != nil {
+			return err
+		}
+		entry.AudioSize = layout.AudioEnd - layout.AudioStart
+		return nil
+	})
+	bySize := make(map[int64][]scanner.AudioFile)
+	for _, entry := range entries {
+		bySize[entry.AudioSize] = append(bySize[entry.AudioSize], entry.File)
+	}
+	var candidates []scanner.AudioFile
+	for _, entry := range entries {
+		if len(bySize[entry.AudioSize]) > 1 {
+			candidates = append(candidates, entry.File)
+		}
+	}
+
+	hashed := collect(candidates, threads, &errs, &mu, func(entry *Entry) error {
+		if err := entry.hash(); err != nil {
+			return err
+		}
+		return entry.load()
+	})
+
+	byHash := make(map[string]*Group)
+	var groups []*Group
+	for _, entry := range hashed {
+		group, ok := byHash[entry.Hash]
+		if !ok {
+			group = &Group{Hash: entry.Hash, Similarity: 1}
+			byHash[entry.Hash] = group
+			groups = append(groups, group)
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+
+	for _, entry := range hashed {
+		entry.Similarity = 1
+	}
+	return sortGroups(groups), errs
+}
+
+// sortGroups drops single-file groups, sorts each group by relative path and puts the largest groups first
+func sortGroups(groups []*Group) []*Group {
+	var result []*Group
+	for _, group := range groups {
+		if len(group.Entries) < 2 {
+			continue
+		}
+		sort.Slice(group.Entries, func(i, j int) bool {
+			return group.Entries[i].File.RelPath < group.Entries[j].File.RelPath
+		})
+		result = append(result, group)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if len(result[i].Entries) != len(result[j].Entries) {
+			return len(result[i].Entries) > len(result[j].Entries)
+		}
+		return result[i].Entries[0].File.RelPath < result[j].Entries[0].File.RelPath
+	})
+	return result
+}
+
+// load reads the size, modification time and tags of an entry
+func (e *Entry) load() error {
+	info, err := os.Stat(e.File.Path)
+	if err != nil {
+		return err
+	}
+	e.Size = info.Size()
+	e.ModTime = info.ModTime()
+	if meta, err := tagger.ReadTags(e.File.Path); err == nil {
+		e.Meta = meta
+	}
+	return nil
+}
+
+// collect runs fn over files with a worker pool and returns the entries it succeeded on, in file order
+func collect(files []scanner.AudioFile, threads int, errs *[]error, mu *sync.Mutex, fn func(*Entry) error) []*Entry {
+	entries := make([]*Entry, len(files))
+	workers.Run(len(files), threads, func(index int) {
+		entry := &Entry{File: files[index]}
+		if err := fn(entry); err != nil {
+			mu.Lock()
+			*errs = append(*errs, fmt.Errorf("failed to read %s: %w", files[index].Path, err))
+			mu.Unlock()
+			return
+		}
+		entries[index] = entry
+	})
+
+	var result []*Entry
+	for _, entry := range entries {
+		if entry != nil {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// hash computes the SHA-256 of the audio payload between the leading and trailing tags
+func (e *Entry) hash() error {
+	hash, size, err := mpeg.HashAudio(e.File.Path)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	e.AudioSize = size
+	return nil
+}
+
+// Keeper returns the copy of a group to keep under a policy.
+// For KeepPath, the first preferred path containing a copy wins; groups without one fall back to KeepLongestTag.
+// Ties keep the first copy by relative path.
+func (g *Group) Keeper(policy string, preferred []string) (*Entry, error) {
+	switch policy {
+	case KeepLongestTag:
+		return g.best(func(a, b *Entry) bool { return a.TagLength() > b.TagLength() }), nil
+	case KeepNewest:
+		return g.best(func(a, b *Entry) bool { return a.ModTime.After(b.ModTime) }), nil
+	case KeepPath:
+		for _, prefix := range preferred {
+			for _, entry := range g.Entries {
+				if underPath(entry.File, prefix) {
+					return entry, nil
+				}
+			}
+		}
+		return g.Keeper(KeepLongestTag, nil)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPolicy, policy)
+	}
+}
+
+// best returns the first entry no other entry is better than
+func (g *Group) best(better func(a, b *Entry) bool) *Entry {
+	keep := g.Entries[0]
+	for _, entry := range g.Entries[1:] {
+		if better(entry, keep) {
+			keep = entry
+		}
+	}
+	return keep
+}
+
+// underPath reports whether a file is under a path, given relative to the scan root or absolute
+func underPath(file scanner.AudioFile, prefix string) bool {
+	if !filepath.IsAbs(prefix) {
+		prefix = filepath.Join(file.BasePath, prefix)
+	}
+	prefix = filepath.Clean(prefix)
+	return file.Path == prefix || strings.HasPrefix(file.Path, prefix+string(filepath.Separator))
+}
+
+// Resolve applies an action to an extra copy: delete it, replace it with a hard link to keep,
+// or move it to moveDir under its relative path. Returns the path the copy ended up at (empty if deleted).
+func Resolve(keep, extra *Entry, action, moveDir string) (string, error) {
+	switch action {
+	case ActionDelete:
+		if err := os.Remove(extra.File.Path); err != nil {
+			return "", fmt.Errorf("failed to delete %s: %w", extra.File.Path, err)
+		}
+		return "", nil
+	case ActionHardlink:
+		// Link next to the extra first, so a failed link leaves the extra in place
+		tmp := extra.File.Path + ".dupes-link"
+		if err := os.Link(keep.File.Path, tmp); err != nil {
+			return "", fmt.Errorf("failed to link %s: %w", extra.File.Path, err)
+		}
+		if err := os.Rename(tmp, extra.File.Path); err != nil {
+			os.Remove(tmp)
+			return "", fmt.Errorf("failed to replace %s: %w", extra.File.Path, err)
+		}
+		return extra.File.Path, nil
+	case ActionMove:
+		target := filepath.Join(moveDir, extra.File.RelPath)
+		if _, err := os.Stat(target); err == nil {
+			return "", fmt.Errorf("failed to move %s: %s already exists", extra.File.Path, target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err)
+		}
+		if err := moveFile(extra.File.Path, target); err != nil {
+			return "", fmt.Errorf("failed to move %s: %w", extra.File.Path, err)
+		}
+		return target, nil
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+// moveFile renames a file, copying it when the target is on another device
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
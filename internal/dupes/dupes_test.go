@@ -0,0 +1,113 @@
+package dupes
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mp3tools/internal/scanner"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// writeTrack writes an MP3 file with the given title and frames whose payload byte is fill
+func writeTrack(t *testing.T, path, title string, fill byte) {
+	t.Helper()
+
+	tag := id3v2.NewEmptyTag()
+	tag.SetDefaultEncoding(id3v2.EncodingUTF8)
+	tag.SetTitle(title)
+	var buf bytes.Buffer
+	if _, err := tag.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write tag: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		frame := bytes.Repeat([]byte{fill}, 417)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x40})
+		buf.Write(frame)
+	}
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write track: %v", err)
+	}
+}
+
+func TestFindAndKeep(t *testing.T) {
+	root := t.TempDir()
+	writeTrack(t, filepath.Join(root, "a", "05.mp3"), "05", 1)
+	writeTrack(t, filepath.Join(root, "b", "05.mp3"), "05 白眉大侠", 1)
+	writeTrack(t, filepath.Join(root, "c", "chapter5.mp3"), "", 1)
+	writeTrack(t, filepath.Join(root, "c", "06.mp3"), "06", 2)
+	newest := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "c", "chapter5.mp3"), newest, newest)
+
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	groups, errs := Find(files, 2)
+	if len(errs) != 0 || len(groups) != 1 || len(groups[0].Entries) != 3 {
+		t.Fatalf("Expected one group of 3 copies, got %d groups (%v)", len(groups), errs)
+	}
+	group := groups[0]
+
+	for _, tc := range []struct {
+		policy    string
+		preferred []string
+		want      string
+	}{
+		{KeepLongestTag, nil, "b/05.mp3"},
+		{KeepNewest, nil, "c/chapter5.mp3"},
+		{KeepPath, []string{"x", "a"}, "a/05.mp3"},
+		{KeepPath, []string{"x"}, "b/05.mp3"},
+	} {
+		keep, err := group.Keeper(tc.policy, tc.preferred)
+		if err != nil || keep.File.RelPath != filepath.FromSlash(tc.want) {
+			t.Errorf("%s %v: expected %s, got %v (%v)", tc.policy, tc.preferred, tc.want, keep, err)
+		}
+	}
+	if _, err := group.Keeper("largest", nil); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"keep.mp3", "link.mp3", "move/me.mp3", "delete.mp3"} {
+		writeTrack(t, filepath.Join(root, name), name, 1)
+	}
+	files, _ := scanner.ScanDirectory(root)
+	entries := make(map[string]*Entry)
+	for _, file := range files {
+		entries[filepath.ToSlash(file.RelPath)] = &Entry{File: file}
+	}
+	keep := entries["keep.mp3"]
+
+	if _, err := Resolve(keep, entries["link.mp3"], ActionHardlink, ""); err != nil {
+		t.Fatalf("Failed to hardlink: %v", err)
+	}
+	keepInfo, _ := os.Stat(keep.File.Path)
+	linkInfo, _ := os.Stat(entries["link.mp3"].File.Path)
+	if !os.SameFile(keepInfo, linkInfo) {
+		t.Error("Expected link.mp3 to be a hard link to keep.mp3")
+	}
+
+	moveDir := filepath.Join(t.TempDir(), "extras")
+	target, err := Resolve(keep, entries["move/me.mp3"], ActionMove, moveDir)
+	if err != nil || target != filepath.Join(moveDir, "move", "me.mp3") {
+		t.Fatalf("Failed to move: %s (%v)", target, err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("Expected moved file: %v", err)
+	}
+
+	if _, err := Resolve(keep, entries["delete.mp3"], ActionDelete, ""); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := os.Stat(entries["delete.mp3"].File.Path); !os.IsNotExist(err) {
+		t.Error("Expected delete.mp3 to be removed")
+	}
+}
@@ -1,6 +1,7 @@
 package encoder
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/saintfish/chardet"
@@ -71,6 +72,28 @@ func ConvertStringToUTF8(str string) (string, string, error) {
 	return utf8Str, charset, nil
 }
 
+// DecodeText converts the content of a text file (lyrics, cue sheets) to UTF-8,
+// honouring byte order marks and detecting legacy encodings such as GBK otherwise.
+// Returns the text and the charset it was converted from (UTF-8 if unchanged).
+func DecodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), "UTF-8", nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to decode UTF-16: %w", err)
+		}
+		return string(decoded), "UTF-16", nil
+	}
+
+	fixed, charset, changed := FixEncoding(string(data))
+	if !changed {
+		charset = "UTF-8"
+	}
+	return fixed, charset, nil
+}
+
 // NeedsEncodingFix checks if the string needs encoding conversion
 func NeedsEncodingFix(str string) bool {
 	if str == "" {
@@ -89,8 +112,11 @@ func NeedsEncodingFix(str string) bool {
 // getDecoder returns the appropriate decoder for the given charset
 func getDecoder(charset string) *encoding.Decoder {
 	switch charset {
-	case "GB2312", "GB-2312", "GBK", "GB18030":
+	case "GB2312", "GB-2312", "GBK":
 		return simplifiedchinese.GBK.NewDecoder()
+	case "GB18030", "GB-18030":
+		// chardet reports GBK text as GB-18030
+		return simplifiedchinese.GB18030.NewDecoder()
 	case "Big5", "BIG5":
 		return traditionalchinese.Big5.NewDecoder()
 	case "UTF-16LE":
@@ -0,0 +1,51 @@
+package encoder
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestConvertGB18030(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("白眉大侠")
+	if err != nil {
+		t.Fatalf("Failed to encode GBK: %v", err)
+	}
+	// U+20000 only exists in GB18030, as a four-byte sequence
+	fourByte := string([]byte{0x95, 0x32, 0x82, 0x36})
+
+	tests := []struct {
+		charset string
+		input   string
+		want    string
+	}{
+		{"GBK", gbk, "白眉大侠"},
+		{"GB18030", gbk, "白眉大侠"},
+		// chardet's name for GBK text; it used to be left unconverted
+		{"GB-18030", gbk, "白眉大侠"},
+		{"GB-18030", gbk + fourByte, "白眉大侠\U00020000"},
+	}
+	for _, tt := range tests {
+		got, err := ConvertToUTF8([]byte(tt.input), tt.charset)
+		if err != nil || got != tt.want {
+			t.Errorf("ConvertToUTF8(%q, %s) = %q, %v, want %q", tt.input, tt.charset, got, err, tt.want)
+		}
+	}
+}
+
+func TestFixEncodingGBK(t *testing.T) {
+	// A GBK title as found in ID3v1 and Latin-1 ID3v2 frames of Chinese CD rips
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("话说大宋年间，天下太平，白眉大侠徐良出世")
+	if err != nil {
+		t.Fatalf("Failed to encode GBK: %v", err)
+	}
+
+	fixed, charset, changed := FixEncoding(gbk)
+	if !changed || fixed != "话说大宋年间，天下太平，白眉大侠徐良出世" {
+		t.Errorf("FixEncoding = %q (%s, changed %v), want the UTF-8 text", fixed, charset, changed)
+	}
+
+	if _, _, changed := FixEncoding("白眉大侠"); changed {
+		t.Error("Expected UTF-8 text to be left alone")
+	}
+}
@@ -0,0 +1,238 @@
+package fingerprint
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"time"
+
+	"mp3tools/internal/pcm"
+)
+
+// Analysis parameters, close to chromaprint's: 11025 Hz mono, 4096-sample frames, 1/3 overlap
+const (
+	SampleRate = 11025
+	frameSize  = 4096
+	hopSize    = frameSize / 3
+	minFreq    = 28.0
+	maxFreq    = 3520.0
+
+	smoothFrames = 4 // Chroma frames averaged per sub-fingerprint
+)
+
+// DefaultLength is how much audio is fingerprinted from the start of each file (as fpcalc)
+const DefaultLength = 120 * time.Second
+
+// maxShift is how many frames two fingerprints may be offset by (encoder delay, leading silence)
+const maxShift = 24
+
+// ErrTooShort is returned for files too short to fingerprint
+var ErrTooShort = errors.New("audio too short to fingerprint")
+
+// Fingerprint is a chromaprint-like acoustic fingerprint: one 32-bit sub-fingerprint per frame
+type Fingerprint struct {
+	Duration time.Duration // Duration of the whole file
+	Values   []uint32
+}
+
+// ComputeFile decodes up to length of audio from an MP3 file and fingerprints it
+func ComputeFile(path string, length time.Duration) (*Fingerprint, error) {
+	decoder, err := pcm.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	samples, err := decoder.ReadMono(int(int64(decoder.SampleRate) * int64(length) / int64(time.Second)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := Compute(samples, decoder.SampleRate)
+	if len(values) == 0 {
+		return nil, ErrTooShort
+	}
+	return &Fingerprint{Duration: decoder.Properties.Duration, Values: values}, nil
+}
+
+// Compute fingerprints mono samples at the given sample rate
+func Compute(samples []float32, rate int) []uint32 {
+	samples = resample(samples, rate)
+	if len(samples) < frameSize {
+		return nil
+	}
+
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1))
+	}
+	notes := chromaBins()
+
+	re := make([]float64, frameSize)
+	im := make([]float64, frameSize)
+	var values []uint32
+	var history [][12]float64 // Normalized chroma of the last smoothFrames frames
+	var smoothed [][12]float64
+	for start := 0; start+frameSize <= len(samples); start += hopSize {
+		for i := range re {
+			re[i] = float64(samples[start+i]) * window[i]
+			im[i] = 0
+		}
+		fft(re, im)
+
+		var chroma [12]float64
+		for bin, note := range notes {
+			if note >= 0 {
+				chroma[note] += re[bin]*re[bin] + im[bin]*im[bin]
+			}
+		}
+		normalize(&chroma)
+
+		// Smooth over time, so offsets that are not a whole hop barely change the bits
+		history = append(history, chroma)
+		if len(history) > smoothFrames {
+			history = history[1:]
+		}
+		var avg [12]float64
+		for _, frame := range history {
+			for i, v := range frame {
+				avg[i] += v / float64(len(history))
+			}
+		}
+		smoothed = append(smoothed, avg)
+		if n := len(smoothed); n > smoothFrames {
+			values = append(values, subFingerprint(&smoothed[n-1], &smoothed[n-1-smoothFrames/2]))
+		}
+	}
+	return values
+}
+
+// resample converts samples to SampleRate by averaging (rates below SampleRate are repeated)
+func resample(samples []float32, rate int) []float32 {
+	if rate == SampleRate {
+		return samples
+	}
+	out := make([]float32, 0, int64(len(samples))*SampleRate/int64(rate)+1)
+	var sum float32
+	count, phase := 0, 0
+	for _, sample := range samples {
+		sum += sample
+		count++
+		phase += SampleRate
+		if phase < rate {
+			continue
+		}
+		for ; phase >= rate; phase -= rate {
+			out = append(out, sum/float32(count))
+		}
+		sum, count = 0, 0
+	}
+	return out
+}
+
+// chromaBins maps every FFT bin to its pitch class (0 = A), or -1 outside the analysed range
+func chromaBins() []int {
+	notes := make([]int, frameSize/2)
+	for bin := range notes {
+		freq := float64(bin) * SampleRate / frameSize
+		if freq < minFreq || freq > maxFreq {
+			notes[bin] = -1
+			continue
+		}
+		note := int(math.Round(12 * math.Log2(freq/440)))
+		notes[bin] = (note%12 + 12) % 12
+	}
+	return notes
+}
+
+// normalize scales a chroma vector to unit length (silence stays zero)
+func normalize(chroma *[12]float64) {
+	var sum float64
+	for _, v := range chroma {
+		sum += v * v
+	}
+	if sum < 1e-10 {
+		*chroma = [12]float64{}
+		return
+	}
+	norm := math.Sqrt(sum)
+	for i := range chroma {
+		chroma[i] /= norm
+	}
+}
+
+// subFingerprint encodes how a chroma frame relates to an earlier frame and to itself:
+// 12 bits of change over time, 12 bits of neighbouring pitch classes, 8 bits of thirds
+func subFingerprint(chroma, prev *[12]float64) uint32 {
+	var value uint32
+	for i := 0; i < 12; i++ {
+		if chroma[i] > prev[i] {
+			value |= 1 << i
+		}
+		if chroma[i] > chroma[(i+1)%12] {
+			value |= 1 << (12 + i)
+		}
+		if i < 8 && chroma[i] > chroma[(i+4)%12] {
+			value |= 1 << (24 + i)
+		}
+	}
+	return value
+}
+
+// fft computes an in-place radix-2 FFT; the length must be a power of two
+func fft(re, im []float64) {
+	n := len(re)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		angle := -2 * math.Pi / float64(size)
+		wRe, wIm := math.Cos(angle), math.Sin(angle)
+		for start := 0; start < n; start += size {
+			uRe, uIm := 1.0, 0.0
+			for k := 0; k < size/2; k++ {
+				a, b := start+k, start+k+size/2
+				tRe := re[b]*uRe - im[b]*uIm
+				tIm := re[b]*uIm + im[b]*uRe
+				re[b], im[b] = re[a]-tRe, im[a]-tIm
+				re[a], im[a] = re[a]+tRe, im[a]+tIm
+				uRe, uIm = uRe*wRe-uIm*wIm, uRe*wIm+uIm*wRe
+			}
+		}
+	}
+}
+
+// Similarity compares two fingerprints and returns the share of matching bits (0.5 for unrelated
+// audio, 1 for identical) at the best alignment within a few seconds. At least half of the shorter
+// fingerprint must overlap.
+func Similarity(a, b []uint32) float64 {
+	shorter := min(len(a), len(b))
+	if shorter == 0 {
+		return 0
+	}
+
+	best := 0.0
+	for shift := -maxShift; shift <= maxShift; shift++ {
+		startA, startB := max(0, shift), max(0, -shift)
+		n := min(len(a)-startA, len(b)-startB)
+		if n <= 0 || n*2 < shorter {
+			continue
+		}
+		diff := 0
+		for i := 0; i < n; i++ {
+			diff += bits.OnesCount32(a[startA+i] ^ b[startB+i])
+		}
+		if score := 1 - float64(diff)/float64(32*n); score > best {
+			best = score
+		}
+	}
+	return best
+}
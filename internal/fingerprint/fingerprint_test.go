@@ -0,0 +1,95 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// melody synthesizes a sequence of half-second tones picked by seed
+func melody(seed int64, rate int, seconds int) []float32 {
+	r := rand.New(rand.NewSource(seed))
+	samples := make([]float32, rate*seconds)
+	var freq float64
+	for i := range samples {
+		if i%(rate/2) == 0 {
+			freq = 220 * math.Pow(2, float64(r.Intn(24))/12)
+		}
+		t := float64(i) / float64(rate)
+		samples[i] = float32(0.3*math.Sin(2*math.Pi*freq*t) + 0.1*math.Sin(4*math.Pi*freq*t))
+	}
+	return samples
+}
+
+func TestSimilarity(t *testing.T) {
+	original := Compute(melody(1, 44100, 30), 44100)
+	if len(original) == 0 {
+		t.Fatal("Expected a fingerprint")
+	}
+	if score := Similarity(original, original); score != 1 {
+		t.Errorf("Expected identical fingerprints to score 1, got %.3f", score)
+	}
+
+	// A noisy 22050 Hz copy starting 0.3 s late still matches
+	r := rand.New(rand.NewSource(2))
+	source := melody(1, 44100, 30)
+	var degraded []float32
+	for i := 13230; i+1 < len(source); i += 2 {
+		degraded = append(degraded, (source[i]+source[i+1])/2+float32(r.NormFloat64()*0.02))
+	}
+	if score := Similarity(original, Compute(degraded, 22050)); score < 0.85 {
+		t.Errorf("Expected re-encoded copy to score at least 0.85, got %.3f", score)
+	}
+
+	// A different melody doesn't
+	if score := Similarity(original, Compute(melody(3, 44100, 30), 44100)); score > 0.75 {
+		t.Errorf("Expected different audio to score below 0.75, got %.3f", score)
+	}
+	if score := Similarity(original, nil); score != 0 {
+		t.Errorf("Expected empty fingerprint to score 0, got %.3f", score)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	audio := filepath.Join(dir, "a.mp3")
+	os.WriteFile(audio, []byte("audio"), 0644)
+	info, _ := os.Stat(audio)
+	fp := &Fingerprint{Duration: 90 * time.Second, Values: []uint32{1, 0xFFFFFFFF, 42}}
+
+	path := filepath.Join(dir, "state", "fingerprints.jsonl")
+	index, err := OpenIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	index.Put(audio, info, DefaultLength, fp)
+	index.Put(filepath.Join(dir, "gone.mp3"), info, DefaultLength, fp)
+	if err := index.Save(); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	index, err = OpenIndex(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen index: %v", err)
+	}
+	got, ok := index.Get(audio, info, DefaultLength)
+	if !ok || got.Duration != fp.Duration || len(got.Values) != 3 || got.Values[1] != 0xFFFFFFFF {
+		t.Errorf("Expected stored fingerprint, got %+v", got)
+	}
+	if _, ok := index.Get(filepath.Join(dir, "gone.mp3"), info, DefaultLength); ok {
+		t.Error("Expected missing files to be dropped on save")
+	}
+	if _, ok := index.Get(audio, info, time.Minute); ok {
+		t.Error("Expected fingerprints of another length to be ignored")
+	}
+
+	// Changed files are fingerprinted again
+	os.WriteFile(audio, []byte("re-encoded"), 0644)
+	info, _ = os.Stat(audio)
+	if _, ok := index.Get(audio, info, DefaultLength); ok {
+		t.Error("Expected changed file to miss the index")
+	}
+}
@@ -0,0 +1,179 @@
+package fingerprint
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// indexRecord is one line of the index file
+type indexRecord struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mtime"`       // Unix nanoseconds
+	Duration    int64  `json:"duration_ms"` // Whole file
+	Length      int64  `json:"length_ms"`   // Audio fingerprinted
+	Fingerprint string `json:"fingerprint"` // Base64 of little-endian uint32 values
+}
+
+// Index caches fingerprints by file path, size and modification time
+type Index struct {
+	path    string
+	records map[string]indexRecord
+	dirty   bool
+	mu      sync.Mutex
+}
+
+// DefaultIndexPath returns the default index file
+func DefaultIndexPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".mp3tools", "fingerprints.jsonl")
+	}
+	return filepath.Join(home, ".mp3tools", "fingerprints.jsonl")
+}
+
+// OpenIndex loads an index file (JSON Lines); a missing file gives an empty index
+func OpenIndex(path string) (*Index, error) {
+	if path == "" {
+		path = DefaultIndexPath()
+	}
+	index := &Index{path: path, records: make(map[string]indexRecord)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record indexRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid index line %d in %s: %w", line, path, err)
+		}
+		index.records[record.Path] = record
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	return index, nil
+}
+
+// Get returns the fingerprint of a file if the index holds one for its current size and
+// modification time, computed over the same length
+func (x *Index) Get(path string, info os.FileInfo, length time.Duration) (*Fingerprint, bool) {
+	x.mu.Lock()
+	record, ok := x.records[path]
+	x.mu.Unlock()
+	if !ok || record.Size != info.Size() || record.ModTime != info.ModTime().UnixNano() || record.Length != length.Milliseconds() {
+		return nil, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(record.Fingerprint)
+	if err != nil || len(data)%4 != 0 {
+		return nil, false
+	}
+	values := make([]uint32, len(data)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	return &Fingerprint{Duration: time.Duration(record.Duration) * time.Millisecond, Values: values}, true
+}
+
+// Put stores the fingerprint of a file
+func (x *Index) Put(path string, info os.FileInfo, length time.Duration, fp *Fingerprint) {
+	data := make([]byte, len(fp.Values)*4)
+	for i, value := range fp.Values {
+		binary.LittleEndian.PutUint32(data[i*4:], value)
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.records[path] = indexRecord{
+		Path:        path,
+		Size:        info.Size(),
+		ModTime:     info.ModTime().UnixNano(),
+		Duration:    fp.Duration.Milliseconds(),
+		Length:      length.Milliseconds(),
+		Fingerprint: base64.StdEncoding.EncodeToString(data),
+	}
+	x.dirty = true
+}
+
+// Lookup returns the fingerprint of a file from the index, computing and storing it if needed.
+// cached reports whether the index already had it.
+func (x *Index) Lookup(path string, length time.Duration) (fp *Fingerprint, cached bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if fp, ok := x.Get(path, info, length); ok {
+		return fp, true, nil
+	}
+
+	fp, err = ComputeFile(path, length)
+	if err != nil {
+		return nil, false, err
+	}
+	x.Put(path, info, length, fp)
+	return fp, false, nil
+}
+
+// Save writes the index back if it changed, dropping files that no longer exist
+func (x *Index) Save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.dirty {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(x.path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), ".fingerprints-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	paths := make([]string, 0, len(x.records))
+	for path := range x.records {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, path := range paths {
+		if err := enc.Encode(x.records[path]); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), x.path); err != nil {
+		return fmt.Errorf("failed to replace index: %w", err)
+	}
+	x.dirty = false
+	return nil
+}
@@ -0,0 +1,212 @@
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mp3tools/internal/tagger"
+)
+
+// ErrAudioChanged is returned when a file's audio data no longer matches the journal
+var ErrAudioChanged = errors.New("audio data changed since run")
+
+// Entry records the original tag of a file before it was modified
+type Entry struct {
+	RunID     string    `json:"run_id"`
+	Path      string    `json:"path"`
+	AudioHash string    `json:"audio_hash"` // SHA-256 of the data following the ID3v2 tag
+	OldTag    []byte    `json:"old_tag"`    // Raw ID3v2 tag bytes (empty if the file had no tag)
+	Time      time.Time `json:"time"`
+}
+
+// Journal records the original tags of files modified during one run
+type Journal struct {
+	RunID string
+	path  string
+	file  *os.File
+	enc   *json.Encoder
+	mu    sync.Mutex
+}
+
+// DefaultDir returns the default state directory for journals
+func DefaultDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".mp3tools", "journal")
+	}
+	return filepath.Join(home, ".mp3tools", "journal")
+}
+
+// NewRunID generates a new run ID (timestamp plus random suffix)
+func NewRunID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return time.Now().Format("20060102-150405")
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// Create creates a new journal for a run in the given state directory
+func Create(stateDir string) (*Journal, error) {
+	if stateDir == "" {
+		stateDir = DefaultDir()
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	runID := NewRunID()
+	path := journalPath(stateDir, runID)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+
+	return &Journal{
+		RunID: runID,
+		path:  path,
+		file:  file,
+		enc:   json.NewEncoder(file),
+	}, nil
+}
+
+// Record saves the current tag and audio hash of a file before it is modified
+func (j *Journal) Record(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	tag, audio := tagger.SplitID3v2(data)
+	entry := Entry{
+		RunID:     j.RunID,
+		Path:      filePath,
+		AudioHash: hashAudio(audio),
+		OldTag:    tag,
+		Time:      time.Now(),
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.enc.Encode(&entry); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	// Flush to disk before the file is modified
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+
+	return nil
+}
+
+// Path returns the journal file path
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Load reads all entries of a run from the state directory
+func Load(stateDir, runID string) ([]Entry, error) {
+	if stateDir == "" {
+		stateDir = DefaultDir()
+	}
+
+	file, err := os.Open(journalPath(stateDir, runID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal for run %s: %w", runID, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // Tags with cover art can be large
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse journal entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// RestoreEntry writes the recorded tag back to the file.
+// Returns ErrAudioChanged if the audio data was modified since the entry was recorded.
+func RestoreEntry(entry Entry) error {
+	data, err := os.ReadFile(entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	_, audio := tagger.SplitID3v2(data)
+	if hashAudio(audio) != entry.AudioHash {
+		return ErrAudioChanged
+	}
+
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	// Write to a temporary file and rename, so a failure never leaves a half-written file
+	tmp, err := os.CreateTemp(filepath.Dir(entry.Path), ".mp3tools-restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(entry.OldTag); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tag: %w", err)
+	}
+	if _, err := tmp.Write(audio); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write audio: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := os.Rename(tmpPath, entry.Path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	return nil
+}
+
+// journalPath returns the journal file path for a run
+func journalPath(stateDir, runID string) string {
+	return filepath.Join(stateDir, runID+".jsonl")
+}
+
+// hashAudio returns the hex SHA-256 of audio data
+func hashAudio(audio []byte) string {
+	sum := sha256.Sum256(audio)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,83 @@
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.mp3")
+
+	oldTag := []byte("ID3\x04\x00\x00\x00\x00\x00\x02ab")
+	audio := []byte{0xFF, 0xFB, 0x90, 0x64, 0x00, 0x00}
+	original := append(append([]byte{}, oldTag...), audio...)
+	if err := os.WriteFile(testFile, original, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	j, err := Create(filepath.Join(tmpDir, "state"))
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	if err := j.Record(testFile); err != nil {
+		t.Fatalf("Failed to record file: %v", err)
+	}
+	j.Close()
+
+	// Simulate a tag rewrite that keeps the audio data
+	if err := os.WriteFile(testFile, append([]byte("ID3\x04\x00\x00\x00\x00\x00\x01x"), audio...), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	entries, err := Load(filepath.Join(tmpDir, "state"), j.RunID)
+	if err != nil {
+		t.Fatalf("Failed to load journal: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+
+	if err := RestoreEntry(entries[0]); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	restored, _ := os.ReadFile(testFile)
+	if !bytes.Equal(restored, original) {
+		t.Errorf("Expected restored file %x, got %x", original, restored)
+	}
+}
+
+func TestRestoreRefusesChangedAudio(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.mp3")
+
+	if err := os.WriteFile(testFile, []byte{0xFF, 0xFB, 0x90, 0x64}, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	j, err := Create(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	if err := j.Record(testFile); err != nil {
+		t.Fatalf("Failed to record file: %v", err)
+	}
+	j.Close()
+
+	if err := os.WriteFile(testFile, []byte{0xFF, 0xFB, 0x90, 0x64, 0x01}, 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	entries, err := Load(tmpDir, j.RunID)
+	if err != nil {
+		t.Fatalf("Failed to load journal: %v", err)
+	}
+
+	if err := RestoreEntry(entries[0]); !errors.Is(err, ErrAudioChanged) {
+		t.Errorf("Expected ErrAudioChanged, got %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package loudness
+
+import (
+	"io"
+	"math"
+
+	"mp3tools/internal/pcm"
+)
+
+// ReplayGain 2.0 reference loudness in LUFS
+const ReplayGainReference = -18.0
+
+// EBU R128 gating
+const (
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the absolute-gated loudness
+)
+
+// Result is the loudness analysis of one file or album
+type Result struct {
+	Loudness float64 // Integrated loudness in LUFS (-Inf for silence)
+	TruePeak float64 // Linear true peak (1.0 = 0 dBTP)
+	Blocks   []float64
+}
+
+// Gain returns the ReplayGain 2.0 gain in dB (0 for silence)
+func (r *Result) Gain() float64 {
+	if math.IsInf(r.Loudness, -1) {
+		return 0
+	}
+	return ReplayGainReference - r.Loudness
+}
+
+// PeakDB returns the true peak in dBTP
+func (r *Result) PeakDB() float64 {
+	return 20 * math.Log10(r.TruePeak)
+}
+
+// AnalyzeFile decodes an MP3 file and measures its loudness
+func AnalyzeFile(path string) (*Result, error) {
+	decoder, err := pcm.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	meter := NewMeter(decoder.SampleRate, decoder.Channels)
+	left := make([]float32, 8192)
+	right := make([]float32, 8192)
+	for {
+		n, err := decoder.Read(left, right)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		meter.Add(left[:n], right[:n])
+	}
+	return meter.Result(), nil
+}
+
+// Album combines track results: loudness over all gated blocks, the highest peak
+func Album(tracks []*Result) *Result {
+	album := &Result{}
+	for _, track := range tracks {
+		album.Blocks = append(album.Blocks, track.Blocks...)
+		album.TruePeak = max(album.TruePeak, track.TruePeak)
+	}
+	album.Loudness = Integrated(album.Blocks)
+	return album
+}
+
+// Integrated computes the gated integrated loudness (BS.1770-4) of 400 ms block energies
+func Integrated(blocks []float64) float64 {
+	mean := func(threshold float64) float64 {
+		sum, n := 0.0, 0
+		for _, energy := range blocks {
+			if energy > threshold {
+				sum += energy
+				n++
+			}
+		}
+		if n == 0 {
+			return 0
+		}
+		return sum / float64(n)
+	}
+
+	absolute := mean(energy(absoluteGate))
+	if absolute == 0 {
+		return math.Inf(-1)
+	}
+	gated := mean(energy(loudness(absolute) + relativeGate))
+	return loudness(gated)
+}
+
+// loudness converts a mean square energy to LUFS
+func loudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// energy converts LUFS to a mean square energy
+func energy(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// Meter measures K-weighted loudness in 400 ms blocks overlapping by 75%, and true peak
+type Meter struct {
+	channels int
+	step     int // Samples per 100 ms
+	filters  [2][2]biquad
+	peaks    [2]*truePeak
+
+	sub      [4]float64 // Energy of the last four 100 ms steps
+	subIndex int
+	subCount int
+	acc      float64
+	accN     int
+	blocks   []float64
+}
+
+// NewMeter creates a meter for the given sample rate and channel count (1 or 2)
+func NewMeter(rate, channels int) *Meter {
+	m := &Meter{channels: channels, step: rate / 10}
+	for ch := 0; ch < channels; ch++ {
+		m.filters[ch] = kWeighting(float64(rate))
+		m.peaks[ch] = newTruePeak()
+	}
+	return m
+}
+
+// Add feeds samples to the meter; right is ignored for mono
+func (m *Meter) Add(left, right []float32) {
+	for i := range left {
+		sum := 0.0
+		for ch := 0; ch < m.channels; ch++ {
+			x := float64(left[i])
+			if ch == 1 {
+				x = float64(right[i])
+			}
+			m.peaks[ch].add(x)
+			y := m.filters[ch][1].process(m.filters[ch][0].process(x))
+			sum += y * y
+		}
+		m.acc += sum
+		m.accN++
+
+		if m.accN == m.step {
+			m.sub[m.subIndex] = m.acc
+			m.subIndex = (m.subIndex + 1) % 4
+			m.subCount++
+			m.acc, m.accN = 0, 0
+			if m.subCount >= 4 {
+				m.blocks = append(m.blocks, (m.sub[0]+m.sub[1]+m.sub[2]+m.sub[3])/float64(4*m.step))
+			}
+		}
+	}
+}
+
+// Result returns the integrated loudness and true peak of everything added
+func (m *Meter) Result() *Result {
+	peak := 0.0
+	for ch := 0; ch < m.channels; ch++ {
+		peak = max(peak, m.peaks[ch].peak)
+	}
+	return &Result{Loudness: Integrated(m.blocks), TruePeak: peak, Blocks: m.blocks}
+}
+
+// biquad is a second-order IIR filter (direct form I)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the BS.1770 pre-filter (high shelf) and RLB high-pass for a sample rate
+func kWeighting(rate float64) [2]biquad {
+	// High shelf
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// High-pass
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// True peak oversampling (BS.1770-4 Annex 2): 4x with a 48-tap interpolation filter
+const (
+	oversample = 4
+	phaseTaps  = 12
+)
+
+// interpolation holds the polyphase filter coefficients, phase by phase
+var interpolation = func() [oversample][phaseTaps]float64 {
+	var phases [oversample][phaseTaps]float64
+	taps := oversample * phaseTaps
+	center := float64(taps-1) / 2
+	for i := 0; i < taps; i++ {
+		t := (float64(i) - center) / oversample
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(taps-1))
+		phases[i%oversample][i/oversample] = sinc * window
+	}
+	// Unity gain for every phase
+	for p := range phases {
+		sum := 0.0
+		for _, c := range phases[p] {
+			sum += c
+		}
+		for i := range phases[p] {
+			phases[p][i] /= sum
+		}
+	}
+	return phases
+}()
+
+// truePeak tracks the peak of a 4x oversampled channel
+type truePeak struct {
+	history [2 * phaseTaps]float64 // Newest sample first, stored twice so every window is contiguous
+	pos     int
+	peak    float64
+}
+
+func newTruePeak() *truePeak {
+	return &truePeak{}
+}
+
+func (t *truePeak) add(x float64) {
+	t.pos = (t.pos + phaseTaps - 1) % phaseTaps
+	t.history[t.pos] = x
+	t.history[t.pos+phaseTaps] = x
+	window := t.history[t.pos : t.pos+phaseTaps]
+
+	peak := math.Abs(x)
+	for p := range interpolation {
+		phase := &interpolation[p]
+		y := 0.0
+		for k, c := range phase {
+			y += c * window[k]
+		}
+		peak = max(peak, math.Abs(y))
+	}
+	t.peak = max(t.peak, peak)
+}
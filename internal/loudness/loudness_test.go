@@ -0,0 +1,78 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+)
+
+// sine returns seconds of a sine wave
+func sine(rate int, freq, amplitude, phase float64, seconds float64) []float32 {
+	samples := make([]float32, int(float64(rate)*seconds))
+	for i := range samples {
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)+phase))
+	}
+	return samples
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	// EBU Tech 3341: a 1 kHz stereo sine at -23 dBFS measures -23 LUFS
+	for _, rate := range []int{44100, 48000, 22050} {
+		signal := sine(rate, 1000, math.Pow(10, -23.0/20), 0, 20)
+		meter := NewMeter(rate, 2)
+		meter.Add(signal, signal)
+		result := meter.Result()
+		if math.Abs(result.Loudness+23) > 0.1 {
+			t.Errorf("%d Hz: expected -23 LUFS, got %.2f", rate, result.Loudness)
+		}
+		if math.Abs(result.Gain()-5) > 0.1 {
+			t.Errorf("%d Hz: expected +5 dB gain, got %.2f", rate, result.Gain())
+		}
+	}
+
+	// Mono counts the channel once
+	signal := sine(48000, 1000, math.Pow(10, -23.0/20), 0, 10)
+	meter := NewMeter(48000, 1)
+	meter.Add(signal, nil)
+	if loudness := meter.Result().Loudness; math.Abs(loudness+26.01) > 0.1 {
+		t.Errorf("Expected mono -26 LUFS, got %.2f", loudness)
+	}
+
+	// Silence is gated out entirely
+	meter = NewMeter(48000, 2)
+	silence := make([]float32, 48000*5)
+	meter.Add(silence, silence)
+	if result := meter.Result(); !math.IsInf(result.Loudness, -1) || result.Gain() != 0 {
+		t.Errorf("Expected -Inf LUFS and no gain for silence, got %.2f", result.Loudness)
+	}
+}
+
+func TestAlbumGating(t *testing.T) {
+	loud := sine(48000, 1000, math.Pow(10, -13.0/20), 0, 10)
+	quiet := sine(48000, 1000, math.Pow(10, -33.0/20), 0, 10)
+	var tracks []*Result
+	for _, signal := range [][]float32{loud, quiet} {
+		meter := NewMeter(48000, 2)
+		meter.Add(signal, signal)
+		tracks = append(tracks, meter.Result())
+	}
+
+	// The quiet track is 20 LU below, so the relative gate drops it from the album
+	album := Album(tracks)
+	if math.Abs(album.Loudness+13) > 0.1 {
+		t.Errorf("Expected album loudness -13 LUFS, got %.2f", album.Loudness)
+	}
+	if album.TruePeak != tracks[0].TruePeak {
+		t.Errorf("Expected album peak %.3f, got %.3f", tracks[0].TruePeak, album.TruePeak)
+	}
+}
+
+func TestTruePeak(t *testing.T) {
+	// A sine at a quarter of the sample rate sampled 45° off its peaks: sample peak 0.707, true peak 1
+	signal := sine(48000, 12000, 1, math.Pi/4, 1)
+	meter := NewMeter(48000, 1)
+	meter.Add(signal, nil)
+	peak := meter.Result().TruePeak
+	if math.Abs(20*math.Log10(peak)) > 0.5 {
+		t.Errorf("Expected true peak near 0 dBTP, got %.2f dBTP", 20*math.Log10(peak))
+	}
+}
@@ -0,0 +1,134 @@
+package loudness
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/pcm"
+)
+
+// Silence detection defaults
+const (
+	DefaultSilenceThreshold = -50.0 // dBFS
+	DefaultMinSilence       = 500 * time.Millisecond
+)
+
+// Region is a silent stretch of audio frames [FirstFrame, EndFrame); the Xing frame is not counted
+type Region struct {
+	Start, End           time.Duration
+	FirstFrame, EndFrame int
+}
+
+// Duration returns the length of the region
+func (r Region) Duration() time.Duration {
+	return r.End - r.Start
+}
+
+// Silence lists the silent regions of a file
+type Silence struct {
+	Frames        int // Audio frames
+	FrameDuration time.Duration
+	Regions       []Region
+}
+
+// Duration returns the decoded length of the file
+func (s *Silence) Duration() time.Duration {
+	return time.Duration(s.Frames) * s.FrameDuration
+}
+
+// Leading returns the silent region at the start, if any
+func (s *Silence) Leading() (Region, bool) {
+	if len(s.Regions) > 0 && s.Regions[0].FirstFrame == 0 {
+		return s.Regions[0], true
+	}
+	return Region{}, false
+}
+
+// Trailing returns the silent region at the end, if any
+func (s *Silence) Trailing() (Region, bool) {
+	if n := len(s.Regions); n > 0 && s.Regions[n-1].EndFrame == s.Frames {
+		return s.Regions[n-1], true
+	}
+	return Region{}, false
+}
+
+// DetectSilence decodes a file and finds the regions of at least minDuration whose frames
+// all have an RMS level below threshold dBFS (in any channel)
+func DetectSilence(path string, threshold float64, minDuration time.Duration) (*Silence, error) {
+	decoder, err := pcm.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	samplesPerFrame := 1152
+	if decoder.Properties.Version != mpeg.Version1 {
+		samplesPerFrame = 576
+	}
+	// The decoder outputs the Xing/Info/VBRI frame as an extra silent frame
+	skip := 0
+	switch decoder.Properties.Source {
+	case mpeg.SourceXing, mpeg.SourceInfo, mpeg.SourceVBRI:
+		skip = 1
+	}
+
+	silence := &Silence{
+		FrameDuration: time.Duration(samplesPerFrame) * time.Second / time.Duration(decoder.SampleRate),
+	}
+	limit := math.Pow(10, threshold/20)
+	minFrames := int((minDuration + silence.FrameDuration - 1) / silence.FrameDuration)
+
+	left := make([]float32, samplesPerFrame)
+	right := make([]float32, samplesPerFrame)
+	start := -1
+	closeRegion := func(end int) {
+		if start >= 0 && end-start >= max(1, minFrames) {
+			silence.Regions = append(silence.Regions, Region{
+				Start:      time.Duration(start) * silence.FrameDuration,
+				End:        time.Duration(end) * silence.FrameDuration,
+				FirstFrame: start,
+				EndFrame:   end,
+			})
+		}
+		start = -1
+	}
+
+	for decoded := 0; ; decoded++ {
+		n, err := decoder.Read(left, right)
+		if err == io.EOF || (err != nil && silence.Frames > 0) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if decoded < skip {
+			continue
+		}
+
+		frame := silence.Frames
+		silence.Frames++
+		if rms(left[:n]) < limit && rms(right[:n]) < limit {
+			if start < 0 {
+				start = frame
+			}
+		} else {
+			closeRegion(frame)
+		}
+	}
+	closeRegion(silence.Frames)
+	return silence, nil
+}
+
+// rms returns the root mean square level of samples
+func rms(samples []float32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
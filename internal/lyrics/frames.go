@@ -0,0 +1,148 @@
+package lyrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// SYLT header values (ID3v2.4 section 4.9)
+const (
+	syltTimeMillis   = 2 // Absolute time in milliseconds
+	syltTypeLyrics   = 1
+	syltEncodingUTF8 = 3
+)
+
+// ErrNoLyrics is returned when a file has no embedded lyrics
+var ErrNoLyrics = errors.New("no embedded lyrics")
+
+// EncodeSYLT builds the body of a SYLT frame with millisecond timestamps in UTF-8
+func EncodeSYLT(lyrics *Lyrics, language string) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(syltEncodingUTF8)
+	buf.WriteString(language)
+	buf.WriteByte(syltTimeMillis)
+	buf.WriteByte(syltTypeLyrics)
+	buf.WriteByte(0) // Empty content descriptor
+
+	var stamp [4]byte
+	for _, line := range lyrics.Lines {
+		buf.WriteString(line.Text)
+		buf.WriteByte(0)
+		binary.BigEndian.PutUint32(stamp[:], uint32(line.Time.Milliseconds()))
+		buf.Write(stamp[:])
+	}
+	return buf.Bytes()
+}
+
+// DecodeSYLT parses the body of a SYLT frame. Only millisecond timestamps are supported.
+func DecodeSYLT(body []byte) (*Lyrics, error) {
+	if len(body) < 6 {
+		return nil, errors.New("SYLT frame too short")
+	}
+	encoding := body[0]
+	if body[4] != syltTimeMillis {
+		return nil, fmt.Errorf("unsupported SYLT timestamp format %d (only milliseconds)", body[4])
+	}
+
+	rest := body[6:]
+	if _, n := splitTerminated(rest, encoding); n > 0 {
+		rest = rest[n:] // Skip the content descriptor
+	}
+
+	lyrics := &Lyrics{Tags: make(map[string]string), Synced: true}
+	for len(rest) > 0 {
+		text, n := splitTerminated(rest, encoding)
+		if n == 0 || len(rest) < n+4 {
+			return nil, errors.New("SYLT frame truncated")
+		}
+		stamp := binary.BigEndian.Uint32(rest[n : n+4])
+		rest = rest[n+4:]
+
+		decoded, err := decodeFrameText(text, encoding)
+		if err != nil {
+			return nil, err
+		}
+		// Some taggers start each line with a newline
+		lyrics.Lines = append(lyrics.Lines, Line{
+			Time: time.Duration(stamp) * time.Millisecond,
+			Text: strings.TrimSpace(decoded),
+		})
+	}
+	return lyrics, nil
+}
+
+// splitTerminated returns the text before the terminator and the number of bytes consumed,
+// or 0 if there is no terminator
+func splitTerminated(data []byte, encoding byte) ([]byte, int) {
+	if encoding == 1 || encoding == 2 {
+		// UTF-16: two zero bytes on an even offset
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return data[:i], i + 2
+			}
+		}
+		return nil, 0
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return data[:i], i + 1
+	}
+	return nil, 0
+}
+
+// decodeFrameText converts text of an ID3v2 text encoding to UTF-8
+func decodeFrameText(text []byte, encoding byte) (string, error) {
+	var err error
+	var decoded []byte
+	switch encoding {
+	case 0:
+		decoded, err = charmap.ISO8859_1.NewDecoder().Bytes(text)
+	case 1:
+		decoded, err = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().Bytes(text)
+	case 2:
+		decoded, err = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().Bytes(text)
+	default:
+		decoded = text
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to decode SYLT text: %w", err)
+	}
+	return string(decoded), nil
+}
+
+// ReadEmbedded reads the lyrics embedded in an audio file, preferring synchronised lyrics.
+// Unsynchronised lyrics holding LRC text keep their timestamps.
+func ReadEmbedded(filePath string) (*Lyrics, error) {
+	tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	defer tag.Close()
+
+	for _, frame := range tag.GetFrames("SYLT") {
+		if unknown, ok := frame.(id3v2.UnknownFrame); ok {
+			lyrics, err := DecodeSYLT(unknown.Body)
+			if err != nil {
+				return nil, err
+			}
+			if len(lyrics.Lines) > 0 {
+				return lyrics, nil
+			}
+		}
+	}
+
+	for _, frame := range tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription")) {
+		if uslt, ok := frame.(id3v2.UnsynchronisedLyricsFrame); ok && strings.TrimSpace(uslt.Lyrics) != "" {
+			return Parse(uslt.Lyrics), nil
+		}
+	}
+
+	return nil, ErrNoLyrics
+}
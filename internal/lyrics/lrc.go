@@ -0,0 +1,208 @@
+package lyrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/encoder"
+)
+
+// Line is one lyrics line, with its start time if the lyrics are synchronised
+type Line struct {
+	Time time.Duration
+	Text string
+}
+
+// Lyrics holds the lines and metadata tags ([ti:], [ar:], ...) of a lyrics file
+type Lyrics struct {
+	Tags   map[string]string // Metadata tags, keys in lower case
+	Lines  []Line
+	Synced bool // Lines carry timestamps
+}
+
+// timestampPattern matches [mm:ss], [mm:ss.xx] and [mm:ss:xx] timestamps
+var timestampPattern = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+// tagPattern matches metadata tags like [ti:Title]
+var tagPattern = regexp.MustCompile(`^\[([a-zA-Z]+):(.*)\]$`)
+
+// tagOrder lists the metadata tags written first when formatting, in this order
+var tagOrder = []string{"ti", "ar", "al", "au", "by", "re", "ve"}
+
+// Parse parses LRC text. Lines without timestamps are kept as plain lines.
+func Parse(text string) *Lyrics {
+	lyrics := &Lyrics{Tags: make(map[string]string)}
+	var offset time.Duration
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+
+		// Collect all leading timestamps: [00:12.00][01:30.00]text
+		var times []time.Duration
+		for {
+			match := timestampPattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			times = append(times, parseTimestamp(match[1], match[2], match[3]))
+			line = line[len(match[0]):]
+		}
+
+		if len(times) == 0 {
+			if match := tagPattern.FindStringSubmatch(line); match != nil {
+				key := strings.ToLower(match[1])
+				value := strings.TrimSpace(match[2])
+				if key == "offset" {
+					if ms, err := strconv.Atoi(value); err == nil {
+						offset = time.Duration(ms) * time.Millisecond
+					}
+					continue
+				}
+				lyrics.Tags[key] = value
+				continue
+			}
+			if line != "" {
+				lyrics.Lines = append(lyrics.Lines, Line{Text: line})
+			}
+			continue
+		}
+
+		lyrics.Synced = true
+		for _, t := range times {
+			lyrics.Lines = append(lyrics.Lines, Line{Time: t, Text: strings.TrimSpace(line)})
+		}
+	}
+
+	if lyrics.Synced {
+		// A positive offset shows lyrics earlier
+		for i := range lyrics.Lines {
+			lyrics.Lines[i].Time = max(0, lyrics.Lines[i].Time-offset)
+		}
+		sort.SliceStable(lyrics.Lines, func(i, j int) bool {
+			return lyrics.Lines[i].Time < lyrics.Lines[j].Time
+		})
+	}
+
+	return lyrics
+}
+
+// parseTimestamp converts the minute, second and fraction parts of a timestamp
+func parseTimestamp(min, sec, frac string) time.Duration {
+	minutes, _ := strconv.Atoi(min)
+	seconds, _ := strconv.Atoi(sec)
+	t := time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+
+	if frac != "" {
+		// .x is tenths, .xx hundredths and .xxx milliseconds
+		value, _ := strconv.Atoi(frac)
+		for i := len(frac); i < 3; i++ {
+			value *= 10
+		}
+		t += time.Duration(value) * time.Millisecond
+	}
+	return t
+}
+
+// Plain returns the lyrics text without timestamps, one line per lyrics line
+func (l *Lyrics) Plain() string {
+	lines := make([]string, 0, len(l.Lines))
+	for _, line := range l.Lines {
+		lines = append(lines, line.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Format renders the lyrics as LRC text
+func (l *Lyrics) Format() string {
+	var b strings.Builder
+
+	written := make(map[string]bool)
+	for _, key := range tagOrder {
+		if value, ok := l.Tags[key]; ok {
+			fmt.Fprintf(&b, "[%s:%s]\n", key, value)
+			written[key] = true
+		}
+	}
+	var others []string
+	for key := range l.Tags {
+		if !written[key] {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+	for _, key := range others {
+		fmt.Fprintf(&b, "[%s:%s]\n", key, l.Tags[key])
+	}
+
+	for _, line := range l.Lines {
+		if l.Synced {
+			b.WriteString(formatTimestamp(line.Time))
+		}
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatTimestamp renders a time as [mm:ss.xx]
+func formatTimestamp(t time.Duration) string {
+	centis := t.Milliseconds() / 10
+	return fmt.Sprintf("[%02d:%02d.%02d]", centis/6000, centis/100%60, centis%100)
+}
+
+// LoadFile reads a lyrics file, converting it to UTF-8.
+// Returns the parsed lyrics and the charset the file was converted from (UTF-8 if unchanged).
+func LoadFile(path string) (*Lyrics, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read lyrics: %w", err)
+	}
+
+	// LRC files are usually GBK
+	text, charset, err := encoder.DecodeText(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode lyrics %s: %w", path, err)
+	}
+	return Parse(text), charset, nil
+}
+
+// SaveFile writes the lyrics to an LRC file in UTF-8
+func SaveFile(path string, lyrics *Lyrics) error {
+	if err := os.WriteFile(path, []byte(lyrics.Format()), 0644); err != nil {
+		return fmt.Errorf("failed to write lyrics: %w", err)
+	}
+	return nil
+}
+
+// FindSidecar looks for a .lrc file with the same base name as the audio file (case-insensitive)
+func FindSidecar(audioPath string) (string, bool) {
+	dir := filepath.Dir(audioPath)
+	base := strings.TrimSuffix(filepath.Base(audioPath), filepath.Ext(audioPath))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(name), ".lrc") {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(name, filepath.Ext(name)), base) {
+			return filepath.Join(dir, name), true
+		}
+	}
+	return "", false
+}
+
+// SidecarPath returns the .lrc path lyrics of an audio file are exported to
+func SidecarPath(audioPath string) string {
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".lrc"
+}
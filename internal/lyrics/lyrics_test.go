@@ -0,0 +1,83 @@
+package lyrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestParse(t *testing.T) {
+	lyrics := Parse("[ti:白眉大侠]\r\n[offset:500]\r\n[00:12.34][01:00]话说大宋年间\r\n[00:01.5]第一回\r\n")
+
+	if lyrics.Tags["ti"] != "白眉大侠" || !lyrics.Synced {
+		t.Fatalf("Unexpected lyrics: %+v", lyrics)
+	}
+
+	// Sorted by time, offset applied, repeated lines expanded
+	expected := []Line{
+		{Time: 1000 * time.Millisecond, Text: "第一回"},
+		{Time: 11840 * time.Millisecond, Text: "话说大宋年间"},
+		{Time: 59500 * time.Millisecond, Text: "话说大宋年间"},
+	}
+	if len(lyrics.Lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %+v", len(expected), lyrics.Lines)
+	}
+	for i, line := range expected {
+		if lyrics.Lines[i] != line {
+			t.Errorf("Line %d: expected %+v, got %+v", i, line, lyrics.Lines[i])
+		}
+	}
+
+	formatted := "[ti:白眉大侠]\n[00:01.00]第一回\n[00:11.84]话说大宋年间\n[00:59.50]话说大宋年间\n"
+	if got := lyrics.Format(); got != formatted {
+		t.Errorf("Expected %q, got %q", formatted, got)
+	}
+
+	plain := Parse("第一行\n\n第二行\n")
+	if plain.Synced || plain.Plain() != "第一行\n第二行" {
+		t.Errorf("Unexpected plain lyrics: %+v", plain)
+	}
+}
+
+func TestSYLTRoundTrip(t *testing.T) {
+	lyrics := Parse("[00:01.00]第一回\n[00:11.84]话说大宋年间\n")
+
+	decoded, err := DecodeSYLT(EncodeSYLT(lyrics, "chi"))
+	if err != nil {
+		t.Fatalf("Failed to decode SYLT: %v", err)
+	}
+	if decoded.Format() != lyrics.Format() {
+		t.Errorf("Expected %q, got %q", lyrics.Format(), decoded.Format())
+	}
+
+	if _, err := DecodeSYLT(EncodeSYLT(lyrics, "chi")[:12]); err == nil {
+		t.Error("Expected error for truncated SYLT frame")
+	}
+}
+
+func TestLoadFileAndSidecar(t *testing.T) {
+	tmpDir := t.TempDir()
+	audio := filepath.Join(tmpDir, "01 第一回.mp3")
+	gbk, _ := simplifiedchinese.GBK.NewEncoder().String("[00:01.00]话说大宋年间，天下太平，白眉大侠徐良出世\n")
+	os.WriteFile(filepath.Join(tmpDir, "01 第一回.LRC"), []byte(gbk), 0644)
+
+	path, found := FindSidecar(audio)
+	if !found {
+		t.Fatal("Expected sidecar .LRC to be found")
+	}
+
+	lyrics, charset, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to load lyrics: %v", err)
+	}
+	if charset == "UTF-8" || lyrics.Lines[0].Text != "话说大宋年间，天下太平，白眉大侠徐良出世" {
+		t.Errorf("Expected GBK converted to UTF-8, got %q from %s", lyrics.Lines[0].Text, charset)
+	}
+
+	if SidecarPath(audio) != filepath.Join(tmpDir, "01 第一回.lrc") {
+		t.Errorf("Unexpected sidecar path: %s", SidecarPath(audio))
+	}
+}
@@ -0,0 +1,206 @@
+package mpeg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// GainStep is the gain change of one global_gain step in dB (2^(1/4) in amplitude)
+const GainStep = 1.5
+
+// ErrNotLayer3 is returned when adjusting the gain of a stream that isn't MPEG Layer III
+var ErrNotLayer3 = errors.New("not an MPEG Layer III stream")
+
+// globalGainOffsets returns the bit offsets of every global_gain field within the side information
+func globalGainOffsets(h Header) []int {
+	channels := 2
+	if h.ChannelMode == Mono {
+		channels = 1
+	}
+
+	var offsets []int
+	if h.Version == Version1 {
+		// main_data_begin (9), private bits (5 mono, 3 stereo), scfsi (4 per channel)
+		pos := 9 + 3 + 4*channels
+		if channels == 1 {
+			pos = 9 + 5 + 4
+		}
+		// Per granule and channel: part2_3_length (12) and big_values (9) precede global_gain; 59 bits in all
+		for gr := 0; gr < 2; gr++ {
+			for ch := 0; ch < channels; ch++ {
+				offsets = append(offsets, pos+21)
+				pos += 59
+			}
+		}
+		return offsets
+	}
+
+	// MPEG-2/2.5: main_data_begin (8), private bits (1 mono, 2 stereo), one granule of 63 bits per channel
+	pos := 8 + channels
+	for ch := 0; ch < channels; ch++ {
+		offsets = append(offsets, pos+21)
+		pos += 63
+	}
+	return offsets
+}
+
+// getByte reads 8 bits starting at a bit offset (global_gain never ends on the last side info byte)
+func getByte(b []byte, bit int) int {
+	v := uint16(b[bit/8])<<8 | uint16(b[bit/8+1])
+	return int(v>>(8-bit%8)) & 0xFF
+}
+
+// setByte writes 8 bits starting at a bit offset
+func setByte(b []byte, bit int, value int) {
+	shift := 8 - bit%8
+	v := uint16(b[bit/8])<<8 | uint16(b[bit/8+1])
+	v = v&^(0xFF<<shift) | uint16(value)<<shift
+	b[bit/8], b[bit/8+1] = byte(v>>8), byte(v)
+}
+
+// AdjustGain changes the global_gain of every granule of a Layer III file in place by steps
+// (GainStep dB each), without re-encoding. The steps are reduced as needed so that no granule's
+// gain leaves 0-255. Returns the steps applied. Protected frames get a new CRC; a leading Xing/Info
+// or VBRI frame is skipped.
+func AdjustGain(path string, steps int) (int, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	// First pass: gain range of the stream
+	low, high := 255, 0
+	err = eachSideInfo(f, layout, func(offset int64, frame *Frame, sideInfo []byte) error {
+		for _, bit := range globalGainOffsets(frame.Header) {
+			gain := getByte(sideInfo, bit)
+			low, high = min(low, gain), max(high, gain)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	steps = max(-low, min(255-high, steps))
+	if steps == 0 {
+		return 0, nil
+	}
+
+	// Second pass: rewrite the side information (and CRC)
+	err = eachSideInfo(f, layout, func(offset int64, frame *Frame, sideInfo []byte) error {
+		for _, bit := range globalGainOffsets(frame.Header) {
+			setByte(sideInfo, bit, getByte(sideInfo, bit)+steps)
+		}
+		if frame.Header.Protected {
+			crc := crc16(crc16(0xFFFF, frame.Data[2:4]), sideInfo)
+			if _, err := f.WriteAt([]byte{byte(crc >> 8), byte(crc)}, frame.Offset+HeaderSize); err != nil {
+				return err
+			}
+		}
+		_, err := f.WriteAt(sideInfo, offset)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return steps, nil
+}
+
+// AdjustGainFile adjusts the global_gain like AdjustGain on a temporary copy of path, calls tag
+// with the copy and the steps applied so the tags (e.g. MP3GAIN_UNDO) can be written to it, and
+// then replaces path with the copy. An interrupted run leaves the file as it was, never adjusted
+// audio without the tag recording the adjustment.
+func AdjustGainFile(path string, steps int, tag func(tmp string, applied int) error) (int, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gain-*.mp3")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, src); err != nil {
+		return 0, fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	applied, err := AdjustGain(tmp.Name(), steps)
+	if err != nil {
+		return 0, err
+	}
+	if err := tag(tmp.Name(), applied); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return applied, nil
+}
+
+// eachSideInfo calls fn with a copy of the side information of every audio frame and its file offset
+func eachSideInfo(f *os.File, layout Layout, fn func(offset int64, frame *Frame, sideInfo []byte) error) error {
+	fr := NewFrameReader(f, layout.AudioStart, layout.AudioEnd)
+	for first := true; ; {
+		frame, err := fr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if frame.Header.Layer != 3 {
+			return ErrNotLayer3
+		}
+		if frame.Truncated {
+			continue
+		}
+		if first {
+			// The Xing/Info or VBRI header frame carries no audio
+			first = false
+			if _, ok := ParseXing(frame.Data, frame.Header); ok {
+				continue
+			}
+			if _, ok := ParseVBRI(frame.Data); ok {
+				continue
+			}
+		}
+
+		start := HeaderSize
+		if frame.Header.Protected {
+			start += 2
+		}
+		end := start + frame.Header.SideInfoSize()
+		if end > len(frame.Data) {
+			continue
+		}
+		sideInfo := append([]byte(nil), frame.Data[start:end]...)
+		if err := fn(frame.Offset+int64(start), frame, sideInfo); err != nil {
+			return err
+		}
+	}
+}
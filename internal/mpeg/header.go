@@ -0,0 +1,212 @@
+package mpeg
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version is the MPEG audio version
+type Version int
+
+// MPEG audio versions
+const (
+	Version1  Version = 1
+	Version2  Version = 2
+	Version25 Version = 25 // Unofficial MPEG-2.5 extension for low sample rates
+)
+
+// String returns the version name, e.g. "MPEG-1"
+func (v Version) String() string {
+	switch v {
+	case Version1:
+		return "MPEG-1"
+	case Version2:
+		return "MPEG-2"
+	case Version25:
+		return "MPEG-2.5"
+	default:
+		return "unknown"
+	}
+}
+
+// ChannelMode is the channel mode of a frame
+type ChannelMode int
+
+// Channel modes in header order
+const (
+	Stereo ChannelMode = iota
+	JointStereo
+	DualChannel
+	Mono
+)
+
+// String returns the channel mode name
+func (m ChannelMode) String() string {
+	switch m {
+	case Stereo:
+		return "Stereo"
+	case JointStereo:
+		return "Joint stereo"
+	case DualChannel:
+		return "Dual channel"
+	case Mono:
+		return "Mono"
+	default:
+		return "unknown"
+	}
+}
+
+// HeaderSize is the size of an MPEG audio frame header
+const HeaderSize = 4
+
+// ErrInvalidHeader is returned for bytes that are not a valid frame header
+var ErrInvalidHeader = errors.New("invalid MPEG frame header")
+
+// Header is a decoded MPEG audio frame header
+type Header struct {
+	Version     Version
+	Layer       int  // 1, 2 or 3
+	Protected   bool // A CRC-16 follows the header
+	Bitrate     int  // kbit/s
+	SampleRate  int  // Hz
+	Padding     bool
+	ChannelMode ChannelMode
+	ModeExt     int
+	Copyright   bool
+	Original    bool
+	Emphasis    int
+}
+
+// bitrates holds the bitrate tables in kbit/s, indexed by [MPEG-1?][layer-1][index]
+var bitrates = [2][3][16]int{
+	// MPEG-2 and MPEG-2.5
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+	// MPEG-1
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+}
+
+// sampleRates holds the sample rates in Hz per version
+var sampleRates = map[Version][3]int{
+	Version1:  {44100, 48000, 32000},
+	Version2:  {22050, 24000, 16000},
+	Version25: {11025, 12000, 8000},
+}
+
+// ParseHeader decodes the 4-byte frame header at the start of b.
+// Free-format frames (bitrate index 0) are not supported.
+func ParseHeader(b []byte) (Header, error) {
+	var h Header
+	if len(b) < HeaderSize || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return h, ErrInvalidHeader
+	}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.Version = Version25
+	case 2:
+		h.Version = Version2
+	case 3:
+		h.Version = Version1
+	default:
+		return h, ErrInvalidHeader
+	}
+
+	layer := (b[1] >> 1) & 0x03
+	if layer == 0 {
+		return h, ErrInvalidHeader
+	}
+	h.Layer = 4 - int(layer)
+	h.Protected = b[1]&0x01 == 0
+
+	bitrateIndex := b[2] >> 4
+	sampleRateIndex := (b[2] >> 2) & 0x03
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return h, ErrInvalidHeader
+	}
+	mpeg1 := 0
+	if h.Version == Version1 {
+		mpeg1 = 1
+	}
+	h.Bitrate = bitrates[mpeg1][h.Layer-1][bitrateIndex]
+	h.SampleRate = sampleRates[h.Version][sampleRateIndex]
+	h.Padding = b[2]&0x02 != 0
+
+	h.ChannelMode = ChannelMode(b[3] >> 6)
+	h.ModeExt = int(b[3]>>4) & 0x03
+	h.Copyright = b[3]&0x08 != 0
+	h.Original = b[3]&0x04 != 0
+	h.Emphasis = int(b[3] & 0x03)
+	if h.Emphasis == 2 {
+		return h, ErrInvalidHeader
+	}
+
+	return h, nil
+}
+
+// Samples returns the number of samples per channel in a frame
+func (h Header) Samples() int {
+	switch {
+	case h.Layer == 1:
+		return 384
+	case h.Layer == 3 && h.Version != Version1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// FrameSize returns the size of the frame in bytes, header included
+func (h Header) FrameSize() int {
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+	if h.Layer == 1 {
+		return (12*h.Bitrate*1000/h.SampleRate + padding) * 4
+	}
+	return h.Samples()/8*h.Bitrate*1000/h.SampleRate + padding
+}
+
+// Duration returns the playing time of the frame
+func (h Header) Duration() time.Duration {
+	return time.Duration(h.Samples()) * time.Second / time.Duration(h.SampleRate)
+}
+
+// SideInfoSize returns the size of the Layer III side information following the header (and CRC)
+func (h Header) SideInfoSize() int {
+	if h.Layer != 3 {
+		return 0
+	}
+	mono := h.ChannelMode == Mono
+	switch {
+	case h.Version == Version1 && mono:
+		return 17
+	case h.Version == Version1:
+		return 32
+	case mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// Compatible reports whether two headers belong to the same stream
+// (same version, layer and sample rate); bitrate and padding may differ
+func (h Header) Compatible(other Header) bool {
+	return h.Version == other.Version && h.Layer == other.Layer && h.SampleRate == other.SampleRate
+}
+
+// String describes the stream format, e.g. "MPEG-1 Layer III, 44100 Hz, Joint stereo"
+func (h Header) String() string {
+	layers := [...]string{"", "I", "II", "III"}
+	return fmt.Sprintf("%s Layer %s, %d Hz, %s", h.Version, layers[h.Layer], h.SampleRate, h.ChannelMode)
+}
@@ -0,0 +1,139 @@
+package mpeg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Tag sizes
+const (
+	id3v2HeaderSize = 10
+	id3v1Size       = 128
+	apeFooterSize   = 32
+)
+
+// Layout locates the audio stream between the tags of an MP3 file
+type Layout struct {
+	Size       int64 // File size
+	ID3v2Size  int64 // Leading ID3v2 tag, header and footer included
+	AudioStart int64 // First byte after the leading tag
+	AudioEnd   int64 // First byte of the trailing tags
+	ID3v1      bool  // File ends with a 128-byte ID3v1 tag
+	APESize    int64 // Trailing APEv2 tag size, header and footer included
+}
+
+// ID3v2Size returns the full size of the ID3v2 tag at the start of data,
+// including header and footer, or 0 if data does not start with a tag
+func ID3v2Size(data []byte) int {
+	if len(data) < id3v2HeaderSize || string(data[:3]) != "ID3" {
+		return 0
+	}
+
+	return int(min(id3v2Extent(data), int64(len(data))))
+}
+
+// ReadLayout locates the leading ID3v2 tag and the trailing ID3v1 and APEv2 tags
+func ReadLayout(r io.ReaderAt, size int64) (Layout, error) {
+	layout := Layout{Size: size, AudioEnd: size}
+
+	header := make([]byte, id3v2HeaderSize)
+	n, err := r.ReadAt(header, 0)
+	if n < len(header) {
+		if err != nil && err != io.EOF {
+			return layout, fmt.Errorf("failed to read header: %w", err)
+		}
+		// Too small for a tag: the whole file is audio
+		return layout, nil
+	}
+	if string(header[:3]) == "ID3" {
+		layout.ID3v2Size = min(id3v2Extent(header), size)
+		layout.AudioStart = layout.ID3v2Size
+	}
+
+	// ID3v1 tag: "TAG" 128 bytes before the end
+	end := size
+	if end-id3v1Size >= layout.AudioStart {
+		tail := make([]byte, 3)
+		if _, err := r.ReadAt(tail, end-id3v1Size); err == nil && string(tail) == "TAG" {
+			layout.ID3v1 = true
+			end -= id3v1Size
+		}
+	}
+
+	// APEv2 tag: 32-byte footer "APETAGEX" before ID3v1 or the end
+	if end-apeFooterSize >= layout.AudioStart {
+		footer := make([]byte, apeFooterSize)
+		if _, err := r.ReadAt(footer, end-apeFooterSize); err == nil && bytes.HasPrefix(footer, []byte("APETAGEX")) {
+			// Size counts items and footer; the optional header adds another 32 bytes
+			apeSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+			flags := binary.LittleEndian.Uint32(footer[20:24])
+			if flags&(1<<31) != 0 {
+				apeSize += apeFooterSize
+			}
+			if apeSize >= apeFooterSize && end-apeSize >= layout.AudioStart {
+				layout.APESize = apeSize
+				end -= apeSize
+			}
+		}
+	}
+
+	layout.AudioEnd = end
+	return layout, nil
+}
+
+// id3v2Extent returns the size of the tag described by an ID3v2 header
+func id3v2Extent(header []byte) int64 {
+	// Tag size is stored as a 28-bit synchsafe integer, plus the footer if flagged
+	size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+	size += id3v2HeaderSize
+	if header[5]&0x10 != 0 {
+		size += id3v2HeaderSize
+	}
+	return size
+}
+
+// ReadFileLayout opens a file and locates its tags
+func ReadFileLayout(path string) (Layout, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Layout{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Layout{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return ReadLayout(f, info.Size())
+}
+
+// HashAudio returns the hex SHA-256 of the audio payload of a file (leading and trailing tags excluded)
+// and the payload size, so copies that differ only in their tags hash the same
+func HashAudio(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return "", 0, err
+	}
+
+	size := layout.AudioEnd - layout.AudioStart
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, layout.AudioStart, size)); err != nil {
+		return "", 0, fmt.Errorf("failed to read audio: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,78 @@
+package mpeg
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MergeResult describes the file written by MergeFiles
+type MergeResult struct {
+	Frames   int
+	Duration time.Duration
+	Starts   []time.Duration // Offset of each source in the merged file
+	Lengths  []time.Duration // Length of each source
+}
+
+// MergeFiles joins the audio frames of srcs into dst, without tags, under a fresh Xing/Info
+// header. The sources must share MPEG version, layer, sample rate and channel mode; their tags, Xing/Info/VBRI
+// frames, junk and partial frames are left out.
+func MergeFiles(srcs []string, dst string) (*MergeResult, error) {
+	streams := make([]*stream, 0, len(srcs))
+	for _, src := range srcs {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		defer f.Close()
+
+		s, err := readStream(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src, err)
+		}
+		if len(s.frames) == 0 {
+			return nil, fmt.Errorf("%s: %w", src, ErrNoFrames)
+		}
+		// Players pick the channel count from the first frame, so a mono part in a stereo file would play wrong
+		if len(streams) > 0 && (!streams[0].header.Compatible(s.header) || s.header.ChannelMode != streams[0].header.ChannelMode) {
+			return nil, fmt.Errorf("%s is %s, not %s like %s", src, s.header, streams[0].header, srcs[0])
+		}
+		streams = append(streams, s)
+	}
+	if len(streams) == 0 {
+		return nil, ErrNoFrames
+	}
+
+	result := &MergeResult{}
+	var frames []streamFrame
+	vbr := false
+	for _, s := range streams {
+		var length time.Duration
+		for _, frame := range s.frames {
+			frames = append(frames, frame.streamFrame)
+			vbr = vbr || frame.bitrate != frames[0].bitrate
+			length += samplesDuration(int64(frame.samples), s.header.SampleRate)
+		}
+		result.Starts = append(result.Starts, result.Duration)
+		result.Lengths = append(result.Lengths, length)
+		result.Duration += length
+	}
+	result.Frames = len(frames)
+
+	// The sources' LAME tags (encoder delay and padding) don't apply to the joined stream
+	xing := buildXing(streams[0].header, frames, vbr, nil)
+	err := writeFile(dst, func(w *bufio.Writer) error {
+		w.Write(xing)
+		for _, s := range streams {
+			if err := s.copyFrames(w, 0, len(s.frames)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,621 @@
+package mpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame builds an MPEG-1 Layer III joint stereo 44.1 kHz frame with the given bitrate index
+func frame(bitrateIndex byte) []byte {
+	header := []byte{0xFF, 0xFB, bitrateIndex << 4, 0x40}
+	h, _ := ParseHeader(header)
+	data := make([]byte, h.FrameSize())
+	copy(data, header)
+	return data
+}
+
+// xingFrame builds an Xing/Info frame with a frame count and the LAME extension
+func xingFrame(tag string, frames, size int) []byte {
+	data := frame(9)
+	h, _ := ParseHeader(data)
+	pos := xingOffset(h)
+	copy(data[pos:], tag)
+	binary.BigEndian.PutUint32(data[pos+4:], xingFrames|xingBytes)
+	binary.BigEndian.PutUint32(data[pos+8:], uint32(frames))
+	binary.BigEndian.PutUint32(data[pos+12:], uint32(size))
+	copy(data[pos+16:], "LAME3.100")
+	return data
+}
+
+func TestParseHeader(t *testing.T) {
+	h, err := ParseHeader([]byte{0xFF, 0xFB, 0x90, 0x64})
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	if h.Version != Version1 || h.Layer != 3 || h.Bitrate != 128 || h.SampleRate != 44100 || h.ChannelMode != JointStereo {
+		t.Errorf("Unexpected header: %+v", h)
+	}
+	if h.FrameSize() != 417 || h.Samples() != 1152 {
+		t.Errorf("Expected 417 bytes and 1152 samples, got %d and %d", h.FrameSize(), h.Samples())
+	}
+
+	// MPEG-2 Layer III mono 22.05 kHz at 64 kbit/s
+	h, _ = ParseHeader([]byte{0xFF, 0xF3, 0x80, 0xC0})
+	if h.Version != Version2 || h.Samples() != 576 || h.FrameSize() != 208 || h.SideInfoSize() != 9 {
+		t.Errorf("Unexpected MPEG-2 header: %+v size %d", h, h.FrameSize())
+	}
+
+	for _, invalid := range [][]byte{{0xFF, 0xFB, 0xF0, 0x00}, {0xFF, 0xF9, 0x90, 0x00}, {0x49, 0x44, 0x33, 0x03}} {
+		if _, err := ParseHeader(invalid); err == nil {
+			t.Errorf("Expected %x to be invalid", invalid)
+		}
+	}
+}
+
+func TestFrameReaderJunk(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write([]byte("junk\xFF\xFBjunk"))
+	stream.Write(frame(9))
+	stream.Write(frame(9))
+	stream.Write([]byte("garbage"))
+	stream.Write(frame(10))
+	stream.Write(frame(9)[:100])
+
+	fr := NewFrameReader(bytes.NewReader(stream.Bytes()), 0, int64(stream.Len()))
+	var frames []Frame
+	for {
+		f, err := fr.Next()
+		if err == io.EOF {
+			break
+		}
+		frames = append(frames, *f)
+	}
+
+	if len(frames) != 4 {
+		t.Fatalf("Expected 4 frames, got %d", len(frames))
+	}
+	if frames[0].Offset != 10 || frames[0].Skipped != 10 {
+		t.Errorf("Expected first frame at 10 after 10 junk bytes, got %d/%d", frames[0].Offset, frames[0].Skipped)
+	}
+	if frames[2].Skipped != 7 || frames[2].Header.Bitrate != 160 {
+		t.Errorf("Expected 7 junk bytes before the 160 kbps frame, got %+v", frames[2])
+	}
+	if !frames[3].Truncated || len(frames[3].Data) != 100 {
+		t.Errorf("Expected truncated final frame of 100 bytes, got %+v", frames[3])
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	// CBR stream without header: frames are walked
+	var cbr bytes.Buffer
+	for i := 0; i < 100; i++ {
+		cbr.Write(frame(9))
+	}
+	props, err := Analyze(bytes.NewReader(cbr.Bytes()), Layout{AudioEnd: int64(cbr.Len())})
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	expected := 100 * 1152 * time.Second / 44100
+	if props.Source != SourceFrames || props.Frames != 100 || props.VBR || props.Bitrate != 128 || props.Duration != expected {
+		t.Errorf("Unexpected CBR properties: %+v", props)
+	}
+
+	// VBR stream with Xing header: the header's frame count is used
+	var vbr bytes.Buffer
+	body := append(frame(9), frame(10)...)
+	vbr.Write(xingFrame("Xing", 1000, 0))
+	vbr.Write(body)
+	props, err = Analyze(bytes.NewReader(vbr.Bytes()), Layout{AudioEnd: int64(vbr.Len())})
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	if props.Source != SourceXing || !props.VBR || props.Frames != 1000 || props.Encoder != "LAME3.100" {
+		t.Errorf("Unexpected VBR properties: %+v", props)
+	}
+
+	if _, err := Analyze(bytes.NewReader([]byte("not audio")), Layout{AudioEnd: 9}); err != ErrNoFrames {
+		t.Errorf("Expected ErrNoFrames, got %v", err)
+	}
+}
+
+func TestReadLayout(t *testing.T) {
+	var file bytes.Buffer
+	file.Write([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 10})
+	file.Write(make([]byte, 10))
+	file.Write(frame(9))
+
+	ape := make([]byte, apeFooterSize)
+	copy(ape, "APETAGEX")
+	binary.LittleEndian.PutUint32(ape[12:], apeFooterSize+8)
+	file.Write(make([]byte, 8))
+	file.Write(ape)
+
+	id3v1 := make([]byte, id3v1Size)
+	copy(id3v1, "TAG")
+	file.Write(id3v1)
+
+	layout, err := ReadLayout(bytes.NewReader(file.Bytes()), int64(file.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read layout: %v", err)
+	}
+	if layout.AudioStart != 20 || layout.AudioEnd != 20+417 || !layout.ID3v1 || layout.APESize != 40 {
+		t.Errorf("Unexpected layout: %+v", layout)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write([]byte("junk"))
+	stream.Write(xingFrame("Info", 5, 0))
+	stream.Write(frame(9))
+	stream.Write([]byte("lost"))
+	stream.Write(frame(9))
+	stream.Write(frame(9)[:50])
+
+	report, err := Validate(bytes.NewReader(stream.Bytes()), Layout{AudioEnd: int64(stream.Len())})
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+
+	expected := []struct {
+		offset int64
+		kind   string
+	}{
+		{0, IssueJunkPrefix},
+		{4 + 417*2, IssueLostSync},
+		{4 + 417*3 + 4, IssueTruncated},
+		{0, IssueFrameCount},
+	}
+	if len(report.Issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), report.Issues)
+	}
+	for i, want := range expected {
+		if got := report.Issues[i]; got.Offset != want.offset || got.Kind != want.kind {
+			t.Errorf("Issue %d: expected %s at %d, got %+v", i, want.kind, want.offset, got)
+		}
+	}
+	if report.Status() != SeverityError || report.Frames != 4 {
+		t.Errorf("Expected error status with 4 frames, got %s with %d", report.Status(), report.Frames)
+	}
+}
+
+func TestCheckCRC(t *testing.T) {
+	data := frame(9)
+	data[1] = 0xFA // Protected
+	h, _ := ParseHeader(data)
+	data[HeaderSize+2] = 0x5A // Some side information
+
+	crc := crc16(crc16(0xFFFF, data[2:4]), data[HeaderSize+2:HeaderSize+2+h.SideInfoSize()])
+	data[4], data[5] = byte(crc>>8), byte(crc)
+	if ok, checked := CheckCRC(data, h); !ok || !checked {
+		t.Errorf("Expected valid CRC, got ok=%v checked=%v", ok, checked)
+	}
+
+	data[HeaderSize+3] ^= 0xFF
+	if ok, _ := CheckCRC(data, h); ok {
+		t.Error("Expected CRC mismatch after corrupting side information")
+	}
+}
+
+// id3v2Tag returns an empty ID3v2.3 tag with the given padding
+func id3v2Tag(padding int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, byte(padding >> 7), byte(padding & 0x7F)}
+	return append(tag, make([]byte, padding)...)
+}
+
+func TestRepairFile(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(id3v2Tag(20))
+	stream.Write(id3v2Tag(30)) // Stacked duplicate tag
+	stream.Write([]byte("junk"))
+	stream.Write(frame(9))
+	stream.Write(frame(10))
+	stream.Write([]byte("lost"))
+	stream.Write(frame(9))
+	stream.Write(frame(10)[:50])
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+	stream.Write(id3v1)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "broken.mp3")
+	dst := filepath.Join(dir, "out", "broken.mp3")
+	if err := os.WriteFile(src, stream.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	result, err := RepairFile(src, dst)
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if result.Frames != 3 || len(result.Actions) != 5 {
+		t.Errorf("Expected 3 frames and 5 actions, got %d: %q", result.Frames, result.Actions)
+	}
+
+	report, err := ValidateFile(dst)
+	if err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if report.Status() != "ok" {
+		t.Errorf("Expected clean stream, got %+v", report.Issues)
+	}
+
+	data, _ := os.ReadFile(dst)
+	if !bytes.Equal(data[:30], id3v2Tag(20)) || !bytes.Equal(data[len(data)-128:], id3v1) {
+		t.Error("Expected leading ID3v2 and trailing ID3v1 tags to be kept")
+	}
+	layout, _ := ReadLayout(bytes.NewReader(data), int64(len(data)))
+	h, _ := ParseHeader(data[layout.AudioStart:])
+	xing, ok := ParseXing(data[layout.AudioStart:], h)
+	if !ok || xing.Tag != "Xing" || xing.Frames != 3 || xing.TOC == nil || xing.Bytes != int(layout.AudioEnd-layout.AudioStart) {
+		t.Errorf("Expected Xing header for 3 VBR frames, got %+v", xing)
+	}
+
+	// A repaired file is left alone
+	result, err = RepairFile(dst, dst)
+	if err != nil || result.Changed() {
+		t.Errorf("Expected repaired file to be unchanged, got %q (%v)", result.Actions, err)
+	}
+}
+
+func TestRepairFileVBRI(t *testing.T) {
+	vbriFrame := func(frames int) []byte {
+		data := frame(9)
+		copy(data[vbriOffset:], "VBRI")
+		binary.BigEndian.PutUint32(data[vbriOffset+14:], uint32(frames))
+		return data
+	}
+	dir := t.TempDir()
+	write := func(name string, parts ...[]byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, bytes.Join(parts, nil), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return path
+	}
+
+	// A correct VBRI header is kept
+	clean := write("clean.mp3", vbriFrame(3), frame(9), frame(10), frame(9))
+	result, err := RepairFile(clean, clean)
+	if err != nil || result.Changed() || result.Frames != 3 {
+		t.Errorf("Expected a correct VBRI header to be kept, got %d frames %q (%v)", result.Frames, result.Actions, err)
+	}
+
+	// Dropping junk makes the count stale, and a wrong count is stale from the start
+	for name, parts := range map[string][][]byte{
+		"junk.mp3":  {vbriFrame(3), frame(9), []byte("junk"), frame(10), frame(9)},
+		"stale.mp3": {vbriFrame(5), frame(9), frame(10), frame(9)},
+	} {
+		path := write(name, parts...)
+		result, err := RepairFile(path, path)
+		if err != nil {
+			t.Fatalf("%s: failed to repair: %v", name, err)
+		}
+		if result.Frames != 3 || !strings.Contains(strings.Join(result.Actions, "; "), "replaced VBRI header with Xing header (3 frames)") {
+			t.Errorf("%s: expected the VBRI header replaced for 3 frames, got %d %q", name, result.Frames, result.Actions)
+		}
+		props, err := AnalyzeFile(path)
+		if err != nil || props.Source != SourceXing || props.Frames != 3 {
+			t.Errorf("%s: expected an Xing header for 3 frames, got %+v (%v)", name, props, err)
+		}
+	}
+}
+
+func TestRepairFileKeepsMode(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write([]byte("junk"))
+	stream.Write(frame(9))
+	stream.Write(frame(9))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "private.mp3")
+	if err := os.WriteFile(path, stream.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+
+	// In place the file keeps its permissions, a new file gets 0644
+	result, err := RepairFile(path, path)
+	if err != nil || !result.Changed() {
+		t.Fatalf("Expected the junk to be dropped, got %+v (%v)", result, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 after repairing in place, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	dst := filepath.Join(dir, "out", "private.mp3")
+	if _, err := RepairFile(path, dst); err != nil {
+		t.Fatalf("Failed to repair to a copy: %v", err)
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected 0644 for a new file, got %v (%v)", info.Mode().Perm(), err)
+	}
+}
+
+func TestAdjustGain(t *testing.T) {
+	protected := frame(9)
+	protected[1] = 0xFA
+	var stream bytes.Buffer
+	stream.Write(xingFrame("Info", 3, 0))
+	stream.Write(frame(9))
+	stream.Write(frame(10))
+	stream.Write(protected)
+	path := filepath.Join(t.TempDir(), "gain.mp3")
+	if err := os.WriteFile(path, stream.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	gains := func() []int {
+		data, _ := os.ReadFile(path)
+		var gains []int
+		for pos := 417; pos < len(data); {
+			h, _ := ParseHeader(data[pos:])
+			start := pos + HeaderSize
+			if h.Protected {
+				start += 2
+				if ok, _ := CheckCRC(data[pos:], h); !ok {
+					t.Errorf("Bad CRC after adjusting frame at %d", pos)
+				}
+			}
+			for _, bit := range globalGainOffsets(h) {
+				gains = append(gains, getByte(data[start:], bit))
+			}
+			pos += h.FrameSize()
+		}
+		return gains
+	}
+
+	for _, tc := range []struct{ steps, applied, gain int }{
+		{3, 3, 3},
+		{-1, -1, 2},
+		{300, 253, 255}, // Limited so no granule passes 255
+		{-1000, -255, 0},
+	} {
+		applied, err := AdjustGain(path, tc.steps)
+		if err != nil || applied != tc.applied {
+			t.Fatalf("Adjusting by %d: expected %d steps, got %d (%v)", tc.steps, tc.applied, applied, err)
+		}
+		for i, gain := range gains() {
+			if gain != tc.gain {
+				t.Errorf("Adjusting by %d: expected global_gain %d in granule %d, got %d", tc.steps, tc.gain, i, gain)
+				break
+			}
+		}
+	}
+
+	// The Xing frame is left alone
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data[:417], xingFrame("Info", 3, 0)) {
+		t.Error("Expected Info frame to be unchanged")
+	}
+}
+
+func TestAdjustGainFile(t *testing.T) {
+	vbri := frame(9)
+	copy(vbri[vbriOffset:], "VBRI")
+	binary.BigEndian.PutUint32(vbri[vbriOffset+14:], 2)
+	original := append(append(append([]byte(nil), vbri...), frame(9)...), frame(9)...)
+	path := filepath.Join(t.TempDir(), "gain.mp3")
+	if err := os.WriteFile(path, original, 0640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// A failing tag write leaves the file as it was
+	_, err := AdjustGainFile(path, 2, func(tmp string, applied int) error {
+		return io.ErrUnexpectedEOF
+	})
+	if err == nil {
+		t.Fatal("Expected the tag error to be returned")
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, original) {
+		t.Error("Expected the file to be unchanged after a failed tag write")
+	}
+
+	applied, err := AdjustGainFile(path, 2, func(tmp string, applied int) error {
+		// Tags go to the adjusted copy before it replaces the file
+		f, err := os.OpenFile(tmp, os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.WriteString("TAG")
+		return err
+	})
+	if err != nil || applied != 2 {
+		t.Fatalf("Expected 2 steps, got %d (%v)", applied, err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data[:417], vbri) {
+		t.Error("Expected the VBRI frame to be left alone")
+	}
+	h, _ := ParseHeader(data[417:])
+	for _, bit := range globalGainOffsets(h) {
+		if gain := getByte(data[417+HeaderSize:], bit); gain != 2 {
+			t.Errorf("Expected global_gain 2, got %d", gain)
+		}
+	}
+	if !bytes.HasSuffix(data, []byte("TAG")) {
+		t.Error("Expected the tags written to the copy")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected permissions to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestTrimFile(t *testing.T) {
+	// reservoir builds a frame whose main data starts the given number of bytes back
+	reservoir := func(bitrateIndex byte, mainDataBegin int) []byte {
+		data := frame(bitrateIndex)
+		data[HeaderSize] = byte(mainDataBegin >> 1)
+		data[HeaderSize+1] = byte(mainDataBegin&1) << 7
+		return data
+	}
+
+	var stream bytes.Buffer
+	stream.Write(id3v2Tag(20))
+	stream.Write(xingFrame("Info", 6, 0))
+	stream.Write(reservoir(9, 0))
+	stream.Write(reservoir(9, 450)) // More than the first frame holds
+	stream.Write(reservoir(9, 200))
+	stream.Write(reservoir(9, 500)) // Needs the main data of the two frames before it
+	stream.Write(reservoir(10, 0))
+	stream.Write(reservoir(9, 0))
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "silence.mp3")
+	if err := os.WriteFile(src, stream.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		first, end              int
+		kept, frames, reservoir int
+		complete                bool
+	}{
+		{3, 5, 1, 4, 2, true},
+		{1, 6, 0, 6, 1, false},
+		{0, 2, 0, 2, 0, true},
+	} {
+		dst := filepath.Join(dir, "out.mp3")
+		result, err := TrimFile(src, dst, tc.first, tc.end)
+		if err != nil {
+			t.Fatalf("Trimming %d-%d: %v", tc.first, tc.end, err)
+		}
+		if result.First != tc.kept || result.Frames != tc.frames || result.Reservoir != tc.reservoir || result.Complete != tc.complete {
+			t.Errorf("Trimming %d-%d: expected first %d, %d frames, reservoir %d, complete %v, got %+v",
+				tc.first, tc.end, tc.kept, tc.frames, tc.reservoir, tc.complete, result)
+		}
+
+		props, err := AnalyzeFile(dst)
+		if err != nil || props.Frames != tc.frames || props.Source != SourceInfo && props.Source != SourceXing {
+			t.Errorf("Trimming %d-%d: expected rebuilt header for %d frames, got %+v (%v)", tc.first, tc.end, tc.frames, props, err)
+		}
+		data, _ := os.ReadFile(dst)
+		if !bytes.Equal(data[:30], id3v2Tag(20)) {
+			t.Errorf("Trimming %d-%d: expected leading ID3v2 tag to be kept", tc.first, tc.end)
+		}
+	}
+
+	if _, err := TrimFile(src, filepath.Join(dir, "empty.mp3"), 4, 4); err == nil {
+		t.Error("Expected an error when nothing is left to keep")
+	}
+}
+
+func TestSplitFile(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(id3v2Tag(20))
+	stream.Write(frame(9))
+	stream.Write(frame(9))
+	stream.Write([]byte("junk")) // Dropped from the part it falls into
+	stream.Write(frame(10))
+	stream.Write(frame(9))
+	stream.Write(frame(9))
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "book.mp3")
+	if err := os.WriteFile(src, stream.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	parts := []Part{
+		{First: 0, End: 2, Path: filepath.Join(dir, "parts", "01.mp3")},
+		{First: 2, End: 1000, Path: filepath.Join(dir, "parts", "02.mp3")},
+	}
+	results, err := SplitFile(src, parts)
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	for i, expected := range []int{2, 3} {
+		if results[i].Frames != expected {
+			t.Errorf("Part %d: expected %d frames, got %+v", i+1, expected, results[i])
+		}
+		report, err := ValidateFile(parts[i].Path)
+		if err != nil || report.Status() != "ok" {
+			t.Errorf("Part %d: expected a clean stream, got %+v (%v)", i+1, report, err)
+		}
+	}
+
+	// Parts have no tags; the VBR part gets a Xing header
+	data, _ := os.ReadFile(parts[0].Path)
+	if len(data) != 2*len(frame(9)) {
+		t.Errorf("Expected two bare CBR frames in the first part, got %d bytes", len(data))
+	}
+	props, err := AnalyzeFile(parts[1].Path)
+	if err != nil || props.Source != SourceXing || props.Frames != 3 {
+		t.Errorf("Expected Xing header for 3 frames in the second part, got %+v (%v)", props, err)
+	}
+
+	// A part past the end of the stream fails the split before any part is written
+	invalid := []Part{
+		{First: 0, End: 2, Path: filepath.Join(dir, "invalid", "01.mp3")},
+		{First: 7, End: 1000, Path: filepath.Join(dir, "invalid", "02.mp3")},
+	}
+	if _, err := SplitFile(src, invalid); err == nil {
+		t.Error("Expected a part past the end to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "invalid")); !os.IsNotExist(err) {
+		t.Errorf("Expected no parts written, got %v", err)
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, parts ...[]byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, bytes.Join(parts, nil), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		return path
+	}
+	first := write("01.mp3", id3v2Tag(20), xingFrame("Info", 2, 0), frame(9), frame(9))
+	second := write("02.mp3", frame(10), frame(10), frame(10), make([]byte, 128))
+
+	dst := filepath.Join(dir, "out", "book.mp3")
+	result, err := MergeFiles([]string{first, second}, dst)
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+	frameDuration := Header{Version: Version1, Layer: 3, SampleRate: 44100}.Duration()
+	if result.Frames != 5 || result.Starts[1] != 2*frameDuration || result.Lengths[1] != 3*frameDuration {
+		t.Errorf("Expected 5 frames with the second file at 2 frames, got %+v", result)
+	}
+
+	props, err := AnalyzeFile(dst)
+	if err != nil || props.Source != SourceXing || props.Frames != 5 {
+		t.Errorf("Expected fresh Xing header for 5 frames, got %+v (%v)", props, err)
+	}
+	data, _ := os.ReadFile(dst)
+	h, _ := ParseHeader(data)
+	if len(data) != h.FrameSize()+2*len(frame(9))+3*len(frame(10)) {
+		t.Errorf("Expected tags and old Info frame to be dropped, got %d bytes", len(data))
+	}
+
+	// Other sample rates can't be joined
+	mpeg2 := frame(9)
+	mpeg2[1] = 0xF3
+	other := write("03.mp3", mpeg2)
+	if _, err := MergeFiles([]string{first, other}, dst); err == nil {
+		t.Error("Expected an error for incompatible streams")
+	}
+
+	// Nor can mono and stereo
+	mono := frame(9)
+	mono[3] = 0xC0
+	monoPath := write("04.mp3", mono, mono)
+	_, err = MergeFiles([]string{first, monoPath}, dst)
+	if err == nil || !strings.Contains(err.Error(), "Mono") {
+		t.Errorf("Expected an error naming the channel mode, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package mpeg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Sources of the stream length in Properties.Source
+const (
+	SourceXing   = "Xing"
+	SourceInfo   = "Info"
+	SourceVBRI   = "VBRI"
+	SourceFrames = "frames"
+)
+
+// ErrNoFrames is returned when a file contains no MPEG audio frames
+var ErrNoFrames = errors.New("no MPEG audio frames found")
+
+// Properties are the technical properties of an MP3 stream
+type Properties struct {
+	Version     Version
+	Layer       int
+	SampleRate  int // Hz
+	ChannelMode ChannelMode
+	Bitrate     int  // Average bitrate in kbit/s
+	VBR         bool // Variable bitrate
+	Duration    time.Duration
+	Frames      int    // Number of audio frames
+	Encoder     string // Encoder version from the LAME extension, if any
+	Source      string // Where frame count and length come from: Xing, Info, VBRI or frames
+}
+
+// String describes the properties, e.g. "MPEG-1 Layer III, 44100 Hz, Joint stereo, 128 kbps CBR, 3:25.120"
+func (p *Properties) String() string {
+	mode := "CBR"
+	if p.VBR {
+		mode = "VBR"
+	}
+	format := Header{Version: p.Version, Layer: p.Layer, SampleRate: p.SampleRate, ChannelMode: p.ChannelMode}
+	return fmt.Sprintf("%s, %d kbps %s, %s", format, p.Bitrate, mode, FormatDuration(p.Duration))
+}
+
+// FrameDuration returns the playing time of one frame
+func (p *Properties) FrameDuration() time.Duration {
+	return Header{Version: p.Version, Layer: p.Layer, SampleRate: p.SampleRate}.Duration()
+}
+
+// FormatDuration formats a duration as [h:]mm:ss.mmm
+func FormatDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	hours, minutes, seconds := ms/3600000, ms/60000%60, ms/1000%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d.%03d", hours, minutes, seconds, ms%1000)
+	}
+	return fmt.Sprintf("%d:%02d.%03d", minutes, seconds, ms%1000)
+}
+
+// AnalyzeFile reads the technical properties of an MP3 file
+func AnalyzeFile(path string) (*Properties, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return Analyze(f, layout)
+}
+
+// Analyze reads the technical properties of the audio stream of a file.
+// Frame count and length come from a Xing/Info or VBRI header when present,
+// otherwise every frame is walked.
+func Analyze(r io.ReaderAt, layout Layout) (*Properties, error) {
+	fr := NewFrameReader(r, layout.AudioStart, layout.AudioEnd)
+	first, err := fr.Next()
+	if err == io.EOF {
+		return nil, ErrNoFrames
+	}
+
+	h := first.Header
+	props := &Properties{
+		Version:     h.Version,
+		Layer:       h.Layer,
+		SampleRate:  h.SampleRate,
+		ChannelMode: h.ChannelMode,
+	}
+	streamBytes := layout.AudioEnd - first.Offset
+
+	xing, hasXing := ParseXing(first.Data, h)
+	if hasXing && xing.HasFrame && xing.Frames > 0 {
+		props.Source = xing.Tag
+		props.VBR = xing.Tag == SourceXing
+		props.Frames = xing.Frames
+		props.Encoder = xing.Encoder
+		samples := int64(xing.Frames)*int64(h.Samples()) - int64(xing.Delay+xing.Padding)
+		props.Duration = samplesDuration(max(samples, 0), h.SampleRate)
+		if xing.Bytes > 0 {
+			streamBytes = int64(xing.Bytes)
+		}
+		// The Xing frame itself carries no audio, and its bitrate may differ from the stream's
+		props.Bitrate = averageBitrate(streamBytes-int64(len(first.Data)), props.Duration)
+		return props, nil
+	}
+
+	if vbri, ok := ParseVBRI(first.Data); ok && vbri.Frames > 0 {
+		props.Source = SourceVBRI
+		props.VBR = true
+		props.Frames = vbri.Frames
+		props.Duration = samplesDuration(int64(vbri.Frames)*int64(h.Samples()), h.SampleRate)
+		if vbri.Bytes > 0 {
+			streamBytes = int64(vbri.Bytes)
+		}
+		props.Bitrate = averageBitrate(streamBytes-int64(len(first.Data)), props.Duration)
+		return props, nil
+	}
+
+	// No usable header: walk all frames
+	props.Source = SourceFrames
+	if hasXing {
+		props.Encoder = xing.Encoder
+	}
+	var samples, audioBytes int64
+	bitrates := make(map[int]bool)
+	for frame := first; ; {
+		// An Xing/Info frame without frame count is not audio
+		if frame != first || !hasXing {
+			props.Frames++
+			samples += int64(frame.Header.Samples())
+			audioBytes += int64(len(frame.Data))
+			bitrates[frame.Header.Bitrate] = true
+		}
+
+		frame, err = fr.Next()
+		if err == io.EOF {
+			break
+		}
+	}
+	props.VBR = len(bitrates) > 1
+	props.Duration = samplesDuration(samples, h.SampleRate)
+	props.Bitrate = averageBitrate(audioBytes, props.Duration)
+	if !props.VBR {
+		for bitrate := range bitrates {
+			props.Bitrate = bitrate
+		}
+	}
+	return props, nil
+}
+
+// samplesDuration converts a sample count to a duration
+func samplesDuration(samples int64, sampleRate int) time.Duration {
+	// Split whole seconds off first so long audiobooks don't overflow
+	rate := int64(sampleRate)
+	return time.Duration(samples/rate)*time.Second + time.Duration(samples%rate)*time.Second/time.Duration(rate)
+}
+
+// averageBitrate returns the average bitrate in kbit/s, rounded
+func averageBitrate(bytes int64, d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((float64(bytes)*8/d.Seconds() + 500) / 1000)
+}
@@ -0,0 +1,108 @@
+package mpeg
+
+import (
+	"bufio"
+	"io"
+)
+
+// maxFrameSize bounds the largest frame (MPEG-2 Layer II at 160 kbit/s and 8 kHz is 2881 bytes)
+const maxFrameSize = 2900
+
+// Frame is one MPEG audio frame of a stream
+type Frame struct {
+	Offset    int64 // Absolute offset of the frame header
+	Header    Header
+	Data      []byte // Frame bytes, header included; only valid until the next call to Next
+	Skipped   int64  // Non-frame bytes skipped right before this frame
+	Truncated bool   // The stream ends inside this frame; Data holds what is left
+}
+
+// FrameReader walks the frames of an audio stream, resynchronising over junk
+type FrameReader struct {
+	br       *bufio.Reader
+	offset   int64 // Absolute offset of the next unread byte
+	end      int64
+	ref      *Header // First frame, later frames must be compatible with it
+	synced   bool    // The previous frame ended where the next header starts
+	buf      []byte
+	trailing int64
+}
+
+// NewFrameReader reads the frames between start and end
+func NewFrameReader(r io.ReaderAt, start, end int64) *FrameReader {
+	return &FrameReader{
+		br:     bufio.NewReaderSize(io.NewSectionReader(r, start, end-start), 4*maxFrameSize),
+		offset: start,
+		end:    end,
+	}
+}
+
+// Trailing returns the number of non-frame bytes after the last frame, once Next has returned io.EOF
+func (fr *FrameReader) Trailing() int64 {
+	return fr.trailing
+}
+
+// Next returns the next frame, or io.EOF at the end of the stream.
+// A candidate header only counts as a frame if it is compatible with the stream and,
+// after junk, if another frame header follows it, so sync words inside junk are skipped.
+func (fr *FrameReader) Next() (*Frame, error) {
+	var skipped int64
+	for {
+		b, _ := fr.br.Peek(HeaderSize)
+		if len(b) < HeaderSize {
+			fr.trailing = skipped + fr.end - fr.offset
+			fr.offset = fr.end
+			return nil, io.EOF
+		}
+
+		if h, err := ParseHeader(b); err == nil && (fr.ref == nil || h.Compatible(*fr.ref)) {
+			size := h.FrameSize()
+			data, _ := fr.br.Peek(size + HeaderSize)
+			switch {
+			case len(data) < size:
+				// The stream ends inside the frame; only trust it if we were in sync
+				if fr.synced {
+					return fr.take(h, len(data), skipped, true), nil
+				}
+			case len(data) == size:
+				// Last frame of the stream
+				return fr.take(h, size, skipped, false), nil
+			case fr.synced && skipped == 0:
+				return fr.take(h, size, skipped, false), nil
+			default:
+				if next, err := ParseHeader(data[size:]); err == nil && next.Compatible(h) {
+					return fr.take(h, size, skipped, false), nil
+				}
+			}
+		}
+
+		// Not a frame: skip a byte and search for the next sync word
+		fr.br.Discard(1)
+		fr.offset++
+		skipped++
+		fr.synced = false
+	}
+}
+
+// take consumes a frame of n bytes
+func (fr *FrameReader) take(h Header, n int, skipped int64, truncated bool) *Frame {
+	if cap(fr.buf) < n {
+		fr.buf = make([]byte, n, maxFrameSize)
+	}
+	fr.buf = fr.buf[:n]
+	io.ReadFull(fr.br, fr.buf)
+
+	frame := &Frame{
+		Offset:    fr.offset,
+		Header:    h,
+		Data:      fr.buf,
+		Skipped:   skipped,
+		Truncated: truncated,
+	}
+	fr.offset += int64(n)
+	fr.synced = true
+	if fr.ref == nil {
+		fr.ref = &h
+	}
+	return frame
+}
@@ -0,0 +1,413 @@
+package mpeg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Xing header layout written by buildXing: all four optional fields, then the LAME extension
+const (
+	xingFieldsSize = 8 + 4 + 4 + 100 + 4
+	lameSize       = 36
+	lameCRCOffset  = 34 // Info tag CRC within the LAME extension
+)
+
+// RepairResult describes what Repair changed
+type RepairResult struct {
+	Frames  int      // Audio frames written
+	Actions []string // Human-readable changes, empty if the stream was already clean
+}
+
+// Changed reports whether the repaired file differs from the original
+func (r *RepairResult) Changed() bool {
+	return len(r.Actions) > 0
+}
+
+// streamFrame is a frame kept by the first repair pass
+type streamFrame struct {
+	size    int
+	samples int
+	bitrate int
+}
+
+// RepairFile repairs the stream of src and writes the result to dst (which may be src).
+// Junk and stacked ID3v2 tags between frames, a partial last frame and data after the
+// last frame are dropped, and the Xing/Info header is rebuilt when it is missing (VBR),
+// wrong, or stale because frames were dropped; a stale VBRI header is replaced by a rebuilt
+// Xing/Info header. The leading ID3v2 tag and trailing ID3v1/APE tags are kept. Nothing is written if dst is src and nothing changed.
+func RepairFile(src, dst string) (*RepairResult, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	// First pass: find the frames to keep and what needs fixing
+	result := &RepairResult{}
+	var frames []streamFrame
+	var first *Frame
+	var oldXing *XingHeader
+	var oldVBRI *VBRIHeader
+	var firstData []byte
+	fr := NewFrameReader(f, layout.AudioStart, layout.AudioEnd)
+	for {
+		frame, err := fr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if frame.Skipped > 0 {
+			result.Actions = append(result.Actions, describeSkipped(f, frame.Offset-frame.Skipped, frame.Offset)...)
+		}
+		if frame.Truncated {
+			result.Actions = append(result.Actions, fmt.Sprintf("dropped partial last frame (%d of %d bytes) at %d", len(frame.Data), frame.Header.FrameSize(), frame.Offset))
+			continue
+		}
+
+		if first == nil {
+			copied := *frame
+			first = &copied
+			firstData = append([]byte(nil), frame.Data...)
+			if xing, ok := ParseXing(frame.Data, frame.Header); ok {
+				oldXing = xing
+				continue
+			}
+			// The VBRI header frame carries no audio either
+			if vbri, ok := ParseVBRI(frame.Data); ok {
+				oldVBRI = vbri
+				continue
+			}
+		}
+		frames = append(frames, streamFrame{size: len(frame.Data), samples: frame.Header.Samples(), bitrate: frame.Header.Bitrate})
+	}
+	if first == nil {
+		return nil, ErrNoFrames
+	}
+	if trailing := fr.Trailing(); trailing > 0 {
+		result.Actions = append(result.Actions, fmt.Sprintf("dropped %d bytes after the last frame at %d", trailing, layout.AudioEnd-trailing))
+	}
+	result.Frames = len(frames)
+
+	// Rebuild the Xing/Info header if it is missing on a VBR stream, wrong, or the stream changed
+	vbr := false
+	for _, frame := range frames {
+		if frame.bitrate != frames[0].bitrate {
+			vbr = true
+			break
+		}
+	}
+	var xing []byte
+	switch {
+	case len(frames) == 0:
+	case oldXing != nil && (result.Changed() || !xingMatches(oldXing, frames, vbr)):
+		xing = buildXing(first.Header, frames, vbr, firstData)
+		result.Actions = append(result.Actions, fmt.Sprintf("rebuilt %s header (%d frames)", xingTag(vbr), len(frames)))
+	case oldVBRI != nil && (result.Changed() || oldVBRI.Frames != len(frames)):
+		// Players trust the VBRI frame count for the duration, so a stale one is replaced
+		xing = buildXing(first.Header, frames, vbr, nil)
+		result.Actions = append(result.Actions, fmt.Sprintf("replaced VBRI header with %s header (%d frames)", xingTag(vbr), len(frames)))
+	case oldXing == nil && oldVBRI == nil && vbr:
+		xing = buildXing(first.Header, frames, vbr, nil)
+		result.Actions = append(result.Actions, fmt.Sprintf("added %s header (%d frames)", xingTag(vbr), len(frames)))
+	case oldXing != nil || oldVBRI != nil:
+		// Keep the existing header
+		xing = firstData
+	}
+
+	if !result.Changed() && dst == src {
+		return result, nil
+	}
+
+	skipOldHeader := oldXing != nil || oldVBRI != nil
+	keep := func(frame *Frame) bool {
+		skip := frame.Truncated || skipOldHeader
+		skipOldHeader = false
+		return !skip
+	}
+	if err := rewriteStream(f, layout, xing, keep, dst); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// describeSkipped lists the stacked ID3v2 tags and junk in a skipped range
+func describeSkipped(r io.ReaderAt, start, end int64) []string {
+	var actions []string
+	header := make([]byte, id3v2HeaderSize)
+	for start < end {
+		if _, err := r.ReadAt(header, start); err == nil && string(header[:3]) == "ID3" {
+			if size := id3v2Extent(header); start+size <= end {
+				actions = append(actions, fmt.Sprintf("removed stacked ID3v2 tag (%d bytes) at %d", size, start))
+				start += size
+				continue
+			}
+		}
+		actions = append(actions, fmt.Sprintf("dropped %d junk bytes at %d", end-start, start))
+		break
+	}
+	return actions
+}
+
+// xingTag returns the header tag for a stream: Xing for VBR, Info for CBR
+func xingTag(vbr bool) string {
+	if vbr {
+		return "Xing"
+	}
+	return "Info"
+}
+
+// xingMatches checks an existing header against the stream
+func xingMatches(xing *XingHeader, frames []streamFrame, vbr bool) bool {
+	if !xing.HasFrame || xing.Frames != len(frames) || (vbr && xing.TOC == nil) {
+		return false
+	}
+	if xing.Bytes > 0 {
+		total := 0
+		for _, frame := range frames {
+			total += frame.size
+		}
+		// Some encoders count the Xing frame, others don't
+		return xing.Bytes >= total && xing.Bytes-total <= maxFrameSize
+	}
+	return true
+}
+
+// buildXing builds an Xing (VBR) or Info (CBR) frame for the given audio frames, with frame count,
+// byte count and a 100-entry seek table. The LAME extension of old (the previous header frame) is kept.
+func buildXing(h Header, frames []streamFrame, vbr bool, old []byte) []byte {
+	// Smallest bitrate whose frame fits the header
+	h.Padding = false
+	offset := xingOffset(h)
+	mpeg1 := 0
+	if h.Version == Version1 {
+		mpeg1 = 1
+	}
+	index := 1
+	for ; index < 15; index++ {
+		h.Bitrate = bitrates[mpeg1][h.Layer-1][index]
+		if h.FrameSize() >= offset+xingFieldsSize+lameSize {
+			break
+		}
+	}
+
+	data := make([]byte, h.FrameSize())
+	data[0] = 0xFF
+	data[1] = 0xE0 | versionBits(h.Version)<<3 | byte(4-h.Layer)<<1 | 1 // No CRC
+	data[2] = byte(index)<<4 | sampleRateIndex(h)<<2
+	data[3] = byte(h.ChannelMode)<<6 | byte(h.ModeExt)<<4 | byte(h.Emphasis)
+	if h.Copyright {
+		data[3] |= 0x08
+	}
+	if h.Original {
+		data[3] |= 0x04
+	}
+	h.Protected = false
+	offset = xingOffset(h)
+
+	total := len(data)
+	for _, frame := range frames {
+		total += frame.size
+	}
+
+	copy(data[offset:], xingTag(vbr))
+	binary.BigEndian.PutUint32(data[offset+4:], xingFrames|xingBytes|xingTOC|xingQuality)
+	binary.BigEndian.PutUint32(data[offset+8:], uint32(len(frames)))
+	binary.BigEndian.PutUint32(data[offset+12:], uint32(total))
+	copy(data[offset+16:], buildTOC(frames, len(data), total))
+
+	lame := offset + xingFieldsSize
+	if oldXing, ok := ParseXing(old, mustParseHeader(old)); ok && oldXing.Encoder != "" {
+		// Keep quality and the LAME extension (encoder, delay/padding), with a fresh Info tag CRC
+		binary.BigEndian.PutUint32(data[offset+116:], uint32(oldXing.Quality))
+		if start := findLAME(old); start >= 0 && start+lameSize <= len(old) {
+			copy(data[lame:lame+lameSize], old[start:start+lameSize])
+			crc := lameCRC(data[:lame+lameCRCOffset])
+			binary.BigEndian.PutUint16(data[lame+lameCRCOffset:], crc)
+		}
+	}
+	return data
+}
+
+// buildTOC computes the Xing seek table: for each percent of the duration,
+// the byte position in the stream scaled to 0-255
+func buildTOC(frames []streamFrame, headerSize, total int) []byte {
+	toc := make([]byte, 100)
+	var samples int64
+	for _, frame := range frames {
+		samples += int64(frame.samples)
+	}
+
+	pos, index := headerSize, 0
+	var elapsed int64
+	for i := range toc {
+		target := samples * int64(i) / 100
+		for index < len(frames) && elapsed+int64(frames[index].samples) <= target {
+			elapsed += int64(frames[index].samples)
+			pos += frames[index].size
+			index++
+		}
+		toc[i] = byte(min(255, int64(pos)*256/int64(total)))
+	}
+	return toc
+}
+
+// findLAME returns the position of the LAME extension in an Xing frame, or -1
+func findLAME(frame []byte) int {
+	h, err := ParseHeader(frame)
+	if err != nil {
+		return -1
+	}
+	offset := xingOffset(h)
+	if len(frame) < offset+8 {
+		return -1
+	}
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	pos := offset + 8
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{xingFrames, 4}, {xingBytes, 4}, {xingTOC, 100}, {xingQuality, 4}} {
+		if flags&field.flag != 0 {
+			pos += field.size
+		}
+	}
+	if pos+9 > len(frame) || !isEncoderString(frame[pos:pos+9]) {
+		return -1
+	}
+	return pos
+}
+
+// mustParseHeader parses a frame header, returning the zero header for invalid data
+func mustParseHeader(frame []byte) Header {
+	h, _ := ParseHeader(frame)
+	return h
+}
+
+// versionBits returns the header bits of a version
+func versionBits(v Version) byte {
+	switch v {
+	case Version1:
+		return 3
+	case Version2:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// sampleRateIndex returns the header index of the sample rate
+func sampleRateIndex(h Header) byte {
+	for i, rate := range sampleRates[h.Version] {
+		if rate == h.SampleRate {
+			return byte(i)
+		}
+	}
+	return 0
+}
+
+// lameCRC computes the LAME Info tag CRC (CRC-16/ARC)
+func lameCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// rewriteStream writes the leading tag, the Xing frame and the frames accepted by keep, then the
+// trailing tags. The file is written to a temporary file next to dst and renamed, so dst may be the source.
+func rewriteStream(f *os.File, layout Layout, xing []byte, keep func(frame *Frame) bool, dst string) error {
+	return writeFile(dst, func(w *bufio.Writer) error {
+		copyRange := func(start, end int64) error {
+			_, err := io.Copy(w, io.NewSectionReader(f, start, end-start))
+			return err
+		}
+
+		if err := copyRange(0, layout.AudioStart); err != nil {
+			return fmt.Errorf("failed to copy tag: %w", err)
+		}
+		w.Write(xing)
+
+		fr := NewFrameReader(f, layout.AudioStart, layout.AudioEnd)
+		for {
+			frame, err := fr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !keep(frame) {
+				continue
+			}
+			if _, err := w.Write(frame.Data); err != nil {
+				return fmt.Errorf("failed to write frames: %w", err)
+			}
+		}
+
+		if err := copyRange(layout.AudioEnd, layout.Size); err != nil {
+			return fmt.Errorf("failed to copy trailing tags: %w", err)
+		}
+		return nil
+	})
+}
+
+// writeFile writes dst through a temporary file in the same directory that is renamed once
+// complete, so dst may be the file being read and is never left half-written
+func writeFile(dst string, write func(w *bufio.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".rewrite-*.mp3")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	// Rewriting in place keeps the file's permissions, new files get 0644
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(dst); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package mpeg
+
+import (
+	"fmt"
+	"os"
+)
+
+// Part is a range of audio frames [First, End) written by SplitFile
+type Part struct {
+	First, End int
+	Path       string
+}
+
+// SplitFile writes each part of src to its own file, without tags, reading the stream once.
+// Nothing is written unless every part is valid.
+// Frames are counted without the Xing/Info/VBRI frame; each part starts with the frames its
+// bit reservoir needs and gets its own Xing/Info header.
+func SplitFile(src string, parts []Part) ([]*TrimResult, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	s, err := readStream(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cut every part before writing any, so invalid parts leave no partial output
+	results := make([]*TrimResult, 0, len(parts))
+	for _, part := range parts {
+		result, err := s.cut(part.First, part.End)
+		if err != nil {
+			return nil, fmt.Errorf("part %s: %w", part.Path, err)
+		}
+		results = append(results, result)
+	}
+	for i, result := range results {
+		if err := s.writePart(result, parts[i].Path); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,207 @@
+package mpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// TrimResult describes the frames kept by TrimFile, or one part written by SplitFile
+type TrimResult struct {
+	Frames    int           // Audio frames written
+	First     int           // First audio frame kept, including the bit reservoir lead-in
+	End       int           // One past the last audio frame kept
+	Reservoir int           // Frames kept before the requested start to preserve the bit reservoir
+	Complete  bool          // The bit reservoir of the first requested frame is fully preserved
+	Duration  time.Duration // Length of the kept audio
+}
+
+// trimFrame is an audio frame seen by the first trim pass
+type trimFrame struct {
+	streamFrame
+	offset        int64
+	mainDataBegin int // Bytes of main data taken from earlier frames
+	mainDataSize  int // Bytes of main data stored in this frame
+}
+
+// stream is the frame list of a file, without the Xing/Info/VBRI frame
+type stream struct {
+	f       *os.File
+	layout  Layout
+	header  Header
+	oldXing []byte // Xing/Info frame of the file, if any
+	frames  []trimFrame
+}
+
+// TrimFile keeps the audio frames [first, end) of src and writes the result to dst (which
+// may be src). Frames are counted without the Xing/Info/VBRI frame. Earlier frames are kept
+// as needed so the first requested frame still finds its bit reservoir. The Xing/Info header
+// is rebuilt, and the leading ID3v2 tag and trailing ID3v1/APE tags are kept.
+func TrimFile(src, dst string, first, end int) (*TrimResult, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	s, err := readStream(f)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.cut(first, end)
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset := s.frames[result.First].offset
+	endOffset := s.layout.AudioEnd
+	if result.End < len(s.frames) {
+		endOffset = s.frames[result.End].offset
+	}
+	keep := func(frame *Frame) bool {
+		return !frame.Truncated && frame.Offset >= startOffset && frame.Offset < endOffset
+	}
+	if err := rewriteStream(f, s.layout, s.xing(result), keep, dst); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readStream collects the audio frames of a file
+func readStream(f *os.File) (*stream, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	s := &stream{f: f, layout: layout}
+	found := false
+	fr := NewFrameReader(f, layout.AudioStart, layout.AudioEnd)
+	for n := 0; ; n++ {
+		frame, err := fr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if frame.Truncated {
+			continue
+		}
+		if n == 0 {
+			s.header = frame.Header
+			found = true
+			if _, ok := ParseXing(frame.Data, frame.Header); ok {
+				s.oldXing = append([]byte(nil), frame.Data...)
+				continue
+			}
+			if _, ok := ParseVBRI(frame.Data); ok {
+				continue
+			}
+		}
+		s.frames = append(s.frames, newTrimFrame(frame))
+	}
+	if !found {
+		return nil, ErrNoFrames
+	}
+	return s, nil
+}
+
+// cut selects the audio frames [first, end), stepping back over earlier frames until
+// their main data covers the bit reservoir of the first frame
+func (s *stream) cut(first, end int) (*TrimResult, error) {
+	first, end = max(first, 0), min(end, len(s.frames))
+	if first >= end {
+		return nil, fmt.Errorf("nothing left to keep: frames %d-%d of %d", first, end, len(s.frames))
+	}
+
+	result := &TrimResult{First: first, End: end, Complete: true}
+	for need := s.frames[first].mainDataBegin; need > 0; need -= s.frames[result.First].mainDataSize {
+		if result.First == 0 {
+			result.Complete = false
+			break
+		}
+		result.First--
+	}
+	result.Reservoir = first - result.First
+	result.Frames = end - result.First
+	for _, frame := range s.frames[result.First:end] {
+		result.Duration += samplesDuration(int64(frame.samples), s.header.SampleRate)
+	}
+	return result, nil
+}
+
+// xing builds the Xing/Info frame for the frames of a cut, or nil for a CBR stream
+// that had none
+func (s *stream) xing(result *TrimResult) []byte {
+	kept := make([]streamFrame, 0, result.Frames)
+	vbr := false
+	for _, frame := range s.frames[result.First:result.End] {
+		kept = append(kept, frame.streamFrame)
+		vbr = vbr || frame.bitrate != kept[0].bitrate
+	}
+	if s.oldXing == nil && !vbr {
+		return nil
+	}
+	return buildXing(s.header, kept, vbr, s.oldXing)
+}
+
+// writePart writes the Xing frame and the frames of a cut to dst, without tags
+func (s *stream) writePart(result *TrimResult, dst string) error {
+	return writeFile(dst, func(w *bufio.Writer) error {
+		w.Write(s.xing(result))
+		return s.copyFrames(w, result.First, result.End)
+	})
+}
+
+// copyFrames copies the audio frames [first, end), a run of adjacent frames at a time
+func (s *stream) copyFrames(w io.Writer, first, end int) error {
+	frames := s.frames[first:end]
+	for i := 0; i < len(frames); {
+		j := i + 1
+		for j < len(frames) && frames[j].offset == frames[j-1].offset+int64(frames[j-1].size) {
+			j++
+		}
+		size := frames[j-1].offset + int64(frames[j-1].size) - frames[i].offset
+		if _, err := io.Copy(w, io.NewSectionReader(s.f, frames[i].offset, size)); err != nil {
+			return fmt.Errorf("failed to write frames: %w", err)
+		}
+		i = j
+	}
+	return nil
+}
+
+// newTrimFrame reads the bit reservoir fields of a Layer III frame
+func newTrimFrame(frame *Frame) trimFrame {
+	h := frame.Header
+	tf := trimFrame{
+		streamFrame: streamFrame{size: len(frame.Data), samples: h.Samples(), bitrate: h.Bitrate},
+		offset:      frame.Offset,
+	}
+	if h.Layer != 3 {
+		return tf
+	}
+
+	start := HeaderSize
+	if h.Protected {
+		start += 2
+	}
+	end := start + h.SideInfoSize()
+	if end+1 > len(frame.Data) {
+		return tf
+	}
+	// main_data_begin is 9 bits for MPEG-1 and 8 bits for MPEG-2/2.5
+	if h.Version == Version1 {
+		tf.mainDataBegin = int(frame.Data[start])<<1 | int(frame.Data[start+1]>>7)
+	} else {
+		tf.mainDataBegin = int(frame.Data[start])
+	}
+	tf.mainDataSize = len(frame.Data) - end
+	return tf
+}
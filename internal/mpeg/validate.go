@@ -0,0 +1,186 @@
+package mpeg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Issue severities
+const (
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Issue kinds
+const (
+	IssueNoFrames      = "no-frames"
+	IssueJunkPrefix    = "junk-prefix"
+	IssueLostSync      = "lost-sync"
+	IssueTruncated     = "truncated-frame"
+	IssueBadCRC        = "bad-crc"
+	IssueTrailer       = "trailer"
+	IssueFrameCount    = "frame-count"
+	IssueEmbeddedID3v2 = "embedded-id3v2"
+)
+
+// Issue is one integrity problem found in a stream
+type Issue struct {
+	Offset   int64  `json:"offset"` // Byte offset in the file
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	Message  string `json:"message"`
+}
+
+// Report is the result of validating a stream
+type Report struct {
+	Frames int     `json:"frames"`
+	Issues []Issue `json:"issues"`
+}
+
+// Status returns "ok", or the highest severity among the issues
+func (r *Report) Status() string {
+	status := "ok"
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return SeverityError
+		}
+		status = SeverityWarning
+	}
+	return status
+}
+
+// add records an issue
+func (r *Report) add(offset int64, severity, kind, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{
+		Offset:   offset,
+		Severity: severity,
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateFile checks the integrity of the audio stream of an MP3 file
+func ValidateFile(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := ReadLayout(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return Validate(f, layout)
+}
+
+// Validate walks every frame after the ID3v2 tag, reporting junk before the first frame,
+// lost sync between frames, CRC mismatches, a truncated final frame, data appended after
+// the last frame, and an Xing frame count that does not match the stream
+func Validate(r io.ReaderAt, layout Layout) (*Report, error) {
+	report := &Report{Issues: []Issue{}}
+	fr := NewFrameReader(r, layout.AudioStart, layout.AudioEnd)
+
+	var xing *XingHeader
+	for {
+		frame, err := fr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if frame.Skipped > 0 {
+			start := frame.Offset - frame.Skipped
+			switch {
+			case isID3v2At(r, start):
+				report.add(start, SeverityWarning, IssueEmbeddedID3v2, "%d bytes holding another ID3v2 tag before frame %d", frame.Skipped, report.Frames+1)
+			case report.Frames == 0:
+				report.add(start, SeverityWarning, IssueJunkPrefix, "%d bytes of junk before the first frame", frame.Skipped)
+			default:
+				report.add(start, SeverityError, IssueLostSync, "lost sync after frame %d: %d bytes of junk", report.Frames, frame.Skipped)
+			}
+		}
+
+		if report.Frames == 0 {
+			xing, _ = ParseXing(frame.Data, frame.Header)
+		}
+		report.Frames++
+
+		if frame.Truncated {
+			report.add(frame.Offset, SeverityError, IssueTruncated, "last frame truncated: %d of %d bytes", len(frame.Data), frame.Header.FrameSize())
+			continue
+		}
+		if ok, checked := CheckCRC(frame.Data, frame.Header); checked && !ok {
+			report.add(frame.Offset, SeverityError, IssueBadCRC, "CRC mismatch in frame %d", report.Frames)
+		}
+	}
+
+	if report.Frames == 0 {
+		report.add(layout.AudioStart, SeverityError, IssueNoFrames, "no MPEG audio frames found")
+		return report, nil
+	}
+
+	if trailing := fr.Trailing(); trailing > 0 {
+		start := layout.AudioEnd - trailing
+		if isID3v2At(r, start) {
+			report.add(start, SeverityWarning, IssueEmbeddedID3v2, "%d bytes holding an ID3v2 tag after the last frame", trailing)
+		} else {
+			report.add(start, SeverityWarning, IssueTrailer, "%d bytes of non-audio data after the last frame", trailing)
+		}
+	}
+
+	// The Xing/Info frame carries no audio and is not counted by its own header
+	if xing != nil && xing.HasFrame && xing.Frames != report.Frames-1 {
+		report.add(layout.AudioStart, SeverityWarning, IssueFrameCount, "%s header counts %d frames, stream has %d", xing.Tag, xing.Frames, report.Frames-1)
+	}
+
+	return report, nil
+}
+
+// isID3v2At reports whether an ID3v2 tag header starts at offset
+func isID3v2At(r io.ReaderAt, offset int64) bool {
+	b := make([]byte, 3)
+	_, err := r.ReadAt(b, offset)
+	return err == nil && bytes.Equal(b, []byte("ID3"))
+}
+
+// CheckCRC verifies the CRC-16 of a protected Layer III frame.
+// checked is false for unprotected frames and other layers, whose CRC coverage depends on bit allocation.
+func CheckCRC(frame []byte, h Header) (ok bool, checked bool) {
+	if !h.Protected || h.Layer != 3 {
+		return true, false
+	}
+	sideInfo := h.SideInfoSize()
+	if len(frame) < HeaderSize+2+sideInfo {
+		return true, false
+	}
+
+	// CRC covers the last two header bytes and the side information
+	crc := crc16(0xFFFF, frame[2:4])
+	crc = crc16(crc, frame[HeaderSize+2:HeaderSize+2+sideInfo])
+	stored := uint16(frame[4])<<8 | uint16(frame[5])
+	return crc == stored, true
+}
+
+// crc16 updates an MPEG audio CRC-16 (polynomial 0x8005)
+func crc16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
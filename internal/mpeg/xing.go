@@ -0,0 +1,129 @@
+package mpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// Xing header flags
+const (
+	xingFrames  = 0x1
+	xingBytes   = 0x2
+	xingTOC     = 0x4
+	xingQuality = 0x8
+)
+
+// vbriOffset is the fixed position of the VBRI header after the frame header
+const vbriOffset = HeaderSize + 32
+
+// XingHeader is the Xing (VBR) or Info (CBR) header stored in the first frame, with the LAME extension
+type XingHeader struct {
+	Tag      string // "Xing" or "Info"
+	Frames   int    // Number of audio frames, excluding this one (0 if absent)
+	Bytes    int    // Stream size in bytes, including this frame (0 if absent)
+	TOC      []byte // 100-entry seek table (nil if absent)
+	Quality  int
+	Encoder  string // Encoder version from the LAME extension, e.g. "LAME3.100"
+	Delay    int    // Encoder delay in samples (LAME extension)
+	Padding  int    // End padding in samples (LAME extension)
+	HasFrame bool   // Frames is present
+}
+
+// VBRIHeader is the Fraunhofer VBRI header stored in the first frame
+type VBRIHeader struct {
+	Frames int
+	Bytes  int
+	Delay  int
+}
+
+// xingOffset returns where the Xing header starts in a frame
+func xingOffset(h Header) int {
+	offset := HeaderSize + h.SideInfoSize()
+	if h.Protected {
+		offset += 2
+	}
+	return offset
+}
+
+// ParseXing reads the Xing/Info header of a frame, if it has one
+func ParseXing(frame []byte, h Header) (*XingHeader, bool) {
+	offset := xingOffset(h)
+	if len(frame) < offset+8 {
+		return nil, false
+	}
+	tag := string(frame[offset : offset+4])
+	if tag != "Xing" && tag != "Info" {
+		return nil, false
+	}
+
+	xing := &XingHeader{Tag: tag}
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	pos := offset + 8
+	read := func(n int) []byte {
+		if pos+n > len(frame) {
+			return nil
+		}
+		b := frame[pos : pos+n]
+		pos += n
+		return b
+	}
+
+	if flags&xingFrames != 0 {
+		if b := read(4); b != nil {
+			xing.Frames = int(binary.BigEndian.Uint32(b))
+			xing.HasFrame = true
+		}
+	}
+	if flags&xingBytes != 0 {
+		if b := read(4); b != nil {
+			xing.Bytes = int(binary.BigEndian.Uint32(b))
+		}
+	}
+	if flags&xingTOC != 0 {
+		if b := read(100); b != nil {
+			xing.TOC = append([]byte(nil), b...)
+		}
+	}
+	if flags&xingQuality != 0 {
+		if b := read(4); b != nil {
+			xing.Quality = int(binary.BigEndian.Uint32(b))
+		}
+	}
+
+	// LAME extension: 9-byte encoder string, then delay and padding at bytes 21-23
+	if lame := read(36); lame != nil && isEncoderString(lame[:9]) {
+		xing.Encoder = strings.TrimRight(string(lame[:9]), " \x00")
+		xing.Delay = int(lame[21])<<4 | int(lame[22])>>4
+		xing.Padding = int(lame[22]&0x0F)<<8 | int(lame[23])
+	}
+
+	return xing, true
+}
+
+// isEncoderString checks for an encoder version like "LAME3.100" or "Lavc58.54"
+func isEncoderString(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte("LAME")) && !bytes.HasPrefix(b, []byte("Lavc")) &&
+		!bytes.HasPrefix(b, []byte("Lavf")) && !bytes.HasPrefix(b, []byte("GOGO")) {
+		return false
+	}
+	for _, c := range b {
+		if c != 0 && (c < 0x20 || c > 0x7E) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseVBRI reads the VBRI header of a frame, if it has one
+func ParseVBRI(frame []byte) (*VBRIHeader, bool) {
+	if len(frame) < vbriOffset+18 || string(frame[vbriOffset:vbriOffset+4]) != "VBRI" {
+		return nil, false
+	}
+	b := frame[vbriOffset:]
+	return &VBRIHeader{
+		Delay:  int(binary.BigEndian.Uint16(b[6:8])),
+		Bytes:  int(binary.BigEndian.Uint32(b[10:14])),
+		Frames: int(binary.BigEndian.Uint32(b[14:18])),
+	}, true
+}
@@ -0,0 +1,126 @@
+package pcm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"mp3tools/internal/mpeg"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// Decoder decodes the MPEG audio payload of a file to float samples in [-1, 1)
+type Decoder struct {
+	SampleRate int
+	Channels   int              // Channels of the source: 1 for mono, else 2
+	Properties *mpeg.Properties // Stream properties of the file
+
+	file    *os.File
+	decoder *mp3.Decoder
+	buf     []byte
+}
+
+// Open opens an MP3 file for decoding; tags around the audio payload are skipped
+func Open(path string) (*Decoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	layout, err := mpeg.ReadLayout(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	props, err := mpeg.Analyze(f, layout)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Hiding Seek keeps the decoder from scanning the whole file up front
+	payload := io.NewSectionReader(f, layout.AudioStart, layout.AudioEnd-layout.AudioStart)
+	decoder, err := mp3.NewDecoder(struct{ io.Reader }{payload})
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+
+	channels := 2
+	if props.ChannelMode == mpeg.Mono {
+		channels = 1
+	}
+	return &Decoder{
+		SampleRate: decoder.SampleRate(),
+		Channels:   channels,
+		Properties: props,
+		file:       f,
+		decoder:    decoder,
+	}, nil
+}
+
+// Read decodes up to len(left) samples per channel into left and right (right may be nil;
+// for mono sources both get the same samples). Returns io.EOF at the end of the stream;
+// a decoding error is returned once the samples decoded before it have been read.
+func (d *Decoder) Read(left, right []float32) (int, error) {
+	if cap(d.buf) < len(left)*4 {
+		d.buf = make([]byte, len(left)*4)
+	}
+	buf := d.buf[:len(left)*4]
+
+	n, err := io.ReadFull(d.decoder, buf)
+	samples := n / 4
+	for i := 0; i < samples; i++ {
+		left[i] = float32(int16(binary.LittleEndian.Uint16(buf[i*4:]))) / 32768
+		if right != nil {
+			right[i] = float32(int16(binary.LittleEndian.Uint16(buf[i*4+2:]))) / 32768
+		}
+	}
+
+	switch {
+	case err == nil:
+		return samples, nil
+	case samples > 0:
+		return samples, nil
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		return 0, io.EOF
+	default:
+		return 0, fmt.Errorf("failed to decode: %w", err)
+	}
+}
+
+// ReadMono decodes up to maxSamples samples (all if maxSamples <= 0), downmixed to mono.
+// Damaged streams decode up to the damage.
+func (d *Decoder) ReadMono(maxSamples int) ([]float32, error) {
+	var samples []float32
+	left := make([]float32, 4096)
+	right := make([]float32, 4096)
+	for maxSamples <= 0 || len(samples) < maxSamples {
+		n, err := d.Read(left, right)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(samples) > 0 {
+				break
+			}
+			return nil, err
+		}
+		for i := 0; i < n && (maxSamples <= 0 || len(samples) < maxSamples); i++ {
+			samples = append(samples, (left[i]+right[i])/2)
+		}
+	}
+	return samples, nil
+}
+
+// Close closes the file
+func (d *Decoder) Close() error {
+	return d.file.Close()
+}
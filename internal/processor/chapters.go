@@ -0,0 +1,206 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mp3tools/internal/chapters"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/writer"
+)
+
+// listChaptersFile prints the embedded chapters of a file
+func (p *Processor) listChaptersFile(file scanner.AudioFile) error {
+	list, err := chapters.ReadEmbedded(file.Path)
+	if errors.Is(err, chapters.ErrNoChapters) {
+		p.mu.Lock()
+		p.stats.NoChapters++
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chapters from %s: %w", file.Path, err)
+	}
+
+	p.mu.Lock()
+	p.stats.WithChapters++
+	p.stats.ChaptersFound += len(list)
+	p.mu.Unlock()
+
+	// One Print per file so workers don't interleave chapter lists
+	fmt.Printf("[%d/%d] %s (%d chapters)\n%s",
+		p.getCurrentIndex(), p.stats.Total, convertPathToUTF8(file.RelPath), len(list), formatChapters(list))
+	return nil
+}
+
+// editChaptersFile replaces the chapters of a file with its .chapters.txt or .chapters.json
+// file (ImportChapters), then renames and shifts them. Files that already have chapters are
+// skipped on import unless ReplaceChapters is set.
+func (p *Processor) editChaptersFile(file scanner.AudioFile) error {
+	list, err := chapters.ReadEmbedded(file.Path)
+	hasChapters := err == nil
+	source := "embedded"
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+
+	if p.options.ImportChapters {
+		sidecar, found := chapters.FindSidecar(file.Path)
+		switch {
+		case found && hasChapters && !p.options.ReplaceChapters:
+			p.mu.Lock()
+			p.stats.ChaptersSkipped++
+			p.mu.Unlock()
+			fmt.Printf("[%d/%d] Skipped: %s (already has chapters, use -f to replace)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay)
+			return nil
+		case !found && len(p.options.ChapterRenames) == 0 && p.options.ChapterShift == 0:
+			p.mu.Lock()
+			p.stats.NoChapters++
+			p.mu.Unlock()
+			return nil
+		case found:
+			var charset string
+			list, charset, err = chapters.LoadFile(sidecar)
+			source = filepath.Base(sidecar)
+			if charset != "UTF-8" && charset != "" {
+				source += ", " + charset + "→UTF-8"
+			}
+		}
+	}
+	if errors.Is(err, chapters.ErrNoChapters) || (err == nil && len(list) == 0) {
+		p.mu.Lock()
+		p.stats.NoChapters++
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	props, err := mpeg.AnalyzeFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", file.Path, err)
+	}
+	if source != "embedded" {
+		chapters.Finish(list, props.Duration)
+	}
+	for n, title := range p.options.ChapterRenames {
+		if n <= len(list) {
+			list[n-1].Title = title
+		}
+	}
+	chapters.Shift(list, p.options.ChapterShift, props.Duration)
+
+	// Encode first so a list that can't be written leaves the file alone
+	bodies, toc, err := chapters.Encode(list)
+	if err != nil {
+		return fmt.Errorf("failed to encode chapters of %s: %w", file.Path, err)
+	}
+	w, err := writer.New(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file.Path, err)
+	}
+	defer w.Close()
+	w.SetChapters(bodies, toc)
+	if err := p.saveTags(file, w); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.stats.ChaptersUpdated++
+	p.mu.Unlock()
+	fmt.Printf("[%d/%d] Updating: %s ← %s (%d chapters)\n%s",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, source, len(list), formatChapters(list))
+	return nil
+}
+
+// exportChaptersFile writes the embedded chapters of a file in the ExportChapters format
+// next to it, or next to its copy in the output directory
+func (p *Processor) exportChaptersFile(file scanner.AudioFile) error {
+	list, err := chapters.ReadEmbedded(file.Path)
+	if errors.Is(err, chapters.ErrNoChapters) {
+		p.mu.Lock()
+		p.stats.NoChapters++
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read chapters from %s: %w", file.Path, err)
+	}
+
+	target := chapters.SidecarPath(p.outPath(file), p.options.ExportChapters)
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	if !p.options.ReplaceChapters {
+		if _, err := os.Stat(target); err == nil {
+			p.mu.Lock()
+			p.stats.ChaptersSkipped++
+			p.mu.Unlock()
+			fmt.Printf("[%d/%d] Skipped: %s (%s exists, use -f to replace)\n",
+				p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, filepath.Base(target))
+			return nil
+		}
+	}
+	text, err := chapters.Format(list, p.options.ExportChapters)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(target, []byte(text), 0644); err != nil {
+		return fmt.Errorf("failed to export chapters of %s: %w", file.Path, err)
+	}
+
+	p.mu.Lock()
+	p.stats.ChaptersExported++
+	p.mu.Unlock()
+	fmt.Printf("[%d/%d] Exporting: %s → %s (%d chapters)\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, filepath.Base(target), len(list))
+	return nil
+}
+
+// formatChapters returns a numbered chapter list, one line per chapter
+func formatChapters(list []chapters.Chapter) string {
+	var b strings.Builder
+	for i, chapter := range list {
+		fmt.Fprintf(&b, "  %2d. %s - %s %s\n", i+1, mpeg.FormatDuration(chapter.Start), mpeg.FormatDuration(chapter.End), chapter.Title)
+	}
+	return b.String()
+}
+
+// printChaptersStatistics prints chapter listing statistics
+func (p *Processor) printChaptersStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  With chapters: %d\n", p.stats.WithChapters)
+	fmt.Printf("  Chapters: %d\n", p.stats.ChaptersFound)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
+
+// printChaptersEditStatistics prints chapter edit and import statistics
+func (p *Processor) printChaptersEditStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Chapters updated: %d\n", p.stats.ChaptersUpdated)
+	fmt.Printf("  Skipped (has chapters): %d\n", p.stats.ChaptersSkipped)
+	fmt.Printf("  No chapters: %d\n", p.stats.NoChapters)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
+
+// printChaptersExportStatistics prints chapter export statistics
+func (p *Processor) printChaptersExportStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Chapters exported: %d\n", p.stats.ChaptersExported)
+	fmt.Printf("  Skipped (file exists): %d\n", p.stats.ChaptersSkipped)
+	fmt.Printf("  No chapters: %d\n", p.stats.NoChapters)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
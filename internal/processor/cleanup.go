@@ -0,0 +1,218 @@
+package processor
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed cleanup_default.yaml
+var defaultCleanupYAML []byte
+
+// CleanupRuleConfig is one find/replace entry of a cleanup rule file
+type CleanupRuleConfig struct {
+	Name      string           `yaml:"name"`       // Name shown in diffs
+	Pattern   string           `yaml:"pattern"`    // Regex to find
+	Replace   string           `yaml:"replace"`    // Replacement ($1 for groups)
+	Fields    []string         `yaml:"fields"`     // Fields the rule applies to (default: all)
+	Priority  int              `yaml:"priority"`   // Higher priorities run first
+	MaxLength int              `yaml:"max_length"` // Only apply to values of at most this many bytes of UTF-8 (0: no limit)
+	Examples  []CleanupExample `yaml:"examples"`   // Checked when the rule file is loaded
+}
+
+// CleanupExample is an input and the expected output of a cleanup rule
+type CleanupExample struct {
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+}
+
+// CleanupConfig is the content of a cleanup rule file
+type CleanupConfig struct {
+	IncludeBuiltin *bool               `yaml:"include_builtin"` // Also apply the built-in rules (default: true)
+	Rules          []CleanupRuleConfig `yaml:"rules"`
+}
+
+// CleanupSet is a compiled, priority-ordered set of cleanup rules
+type CleanupSet struct {
+	rules []*cleanupRule
+}
+
+// cleanupRule is a compiled cleanup rule
+type cleanupRule struct {
+	name      string
+	pattern   *regexp.Regexp
+	replace   string
+	fields    map[string]bool // nil means all fields
+	priority  int
+	maxLength int
+}
+
+// spacePattern matches runs of whitespace
+var spacePattern = regexp.MustCompile(`\s+`)
+
+var (
+	defaultCleanupOnce sync.Once
+	defaultCleanupSet  *CleanupSet
+)
+
+// DefaultCleanupSet returns the built-in cleanup rules (CD default titles, URLs, domains, file extensions)
+func DefaultCleanupSet() *CleanupSet {
+	defaultCleanupOnce.Do(func() {
+		var config CleanupConfig
+		if err := yaml.Unmarshal(defaultCleanupYAML, &config); err != nil {
+			panic(fmt.Sprintf("invalid built-in cleanup rules: %v", err))
+		}
+		set, err := compileCleanupRules(config.Rules)
+		if err != nil {
+			panic(fmt.Sprintf("invalid built-in cleanup rules: %v", err))
+		}
+		defaultCleanupSet = set
+	})
+	return defaultCleanupSet
+}
+
+// LoadCleanupSet reads and compiles a cleanup rule file, checking every rule's examples.
+// The built-in rules are included unless the file sets include_builtin: false.
+func LoadCleanupSet(path string) (*CleanupSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cleanup file: %w", err)
+	}
+	defer file.Close()
+
+	var config CleanupConfig
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse cleanup file %s: %w", path, err)
+	}
+
+	set, err := compileCleanupRules(config.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("cleanup file %s: %w", path, err)
+	}
+
+	if config.IncludeBuiltin == nil || *config.IncludeBuiltin {
+		// User rules come first among equal priorities
+		set.rules = append(set.rules, DefaultCleanupSet().rules...)
+		set.sort()
+	}
+
+	return set, nil
+}
+
+// compileCleanupRules compiles rule configs and checks their examples
+func compileCleanupRules(configs []CleanupRuleConfig) (*CleanupSet, error) {
+	set := &CleanupSet{}
+	for i, rc := range configs {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rc.Pattern == "" {
+			return nil, fmt.Errorf("%s: missing pattern", name)
+		}
+
+		pattern, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", name, err)
+		}
+
+		r := &cleanupRule{
+			name:      name,
+			pattern:   pattern,
+			replace:   rc.Replace,
+			priority:  rc.Priority,
+			maxLength: rc.MaxLength,
+		}
+		if len(rc.Fields) > 0 {
+			r.fields = make(map[string]bool)
+			for _, field := range rc.Fields {
+				if !pipelineFields[field] {
+					return nil, fmt.Errorf("%s: unknown field: %s", name, field)
+				}
+				r.fields[field] = true
+			}
+		}
+
+		// Check examples against this rule followed by the standard tidy-up
+		for _, example := range rc.Examples {
+			got, _ := r.apply(example.Input)
+			if got = tidyTagText(got); got != example.Output {
+				return nil, fmt.Errorf("%s: example %q: expected %q, got %q", name, example.Input, example.Output, got)
+			}
+		}
+
+		set.rules = append(set.rules, r)
+	}
+
+	set.sort()
+	return set, nil
+}
+
+// sort orders rules by priority, highest first, keeping file order for equal priorities
+func (s *CleanupSet) sort() {
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		return s.rules[i].priority > s.rules[j].priority
+	})
+}
+
+// Clean applies the rules targeting the field, then tidies separators and spaces.
+// Returns the cleaned text and the names of the rules that changed it.
+func (s *CleanupSet) Clean(field, text string) (string, []string) {
+	if text == "" {
+		return text, nil
+	}
+
+	cleaned := text
+	var applied []string
+	for _, r := range s.rules {
+		if r.fields != nil && !r.fields[field] {
+			continue
+		}
+		if result, changed := r.apply(cleaned); changed {
+			cleaned = result
+			applied = append(applied, r.name)
+		}
+	}
+
+	return tidyTagText(cleaned), applied
+}
+
+// apply runs the rule on text, reporting whether it changed anything
+func (r *cleanupRule) apply(text string) (string, bool) {
+	// Bytes, not characters, as the original CD title check counted: a CJK character counts 3
+	if r.maxLength > 0 && len(text) > r.maxLength {
+		return text, false
+	}
+	result := r.pattern.ReplaceAllString(text, r.replace)
+	return result, result != text
+}
+
+// tidyTagText removes leftover separators and repeated spaces after cleanup
+func tidyTagText(text string) string {
+	// Remove trailing/leading separators and spaces
+	cleaned := strings.Trim(text, " \t\n\r")
+
+	// Remove trailing dashes and separators (but keep content before them)
+	cleaned = strings.TrimRight(cleaned, "-")
+
+	// Remove multiple consecutive spaces
+	cleaned = spacePattern.ReplaceAllString(cleaned, " ")
+
+	// Final trim
+	cleaned = strings.TrimSpace(cleaned)
+
+	// If result is empty or only contains separators, return empty
+	if cleaned == "" || cleaned == "[]" {
+		return ""
+	}
+
+	return cleaned
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"mp3tools/internal/cue"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+)
+
+// changeTypeCue is the change type of fields taken from a cue sheet
+const changeTypeCue = "cue"
+
+// cueMetadata sets title, artist, album and track from the file's cue sheet entry.
+// The rule pipeline is not run, so the cue sheet is the only source of changes.
+func (p *Processor) cueMetadata(meta *tagger.Metadata, file scanner.AudioFile) (*tagger.Metadata, []FieldChange, error) {
+	match, ok := p.options.Cue[file.Path]
+	if !ok {
+		return nil, nil, fmt.Errorf("no cue sheet entry for %s", file.Path)
+	}
+
+	newMeta := *meta
+	rule := fmt.Sprintf("cue %s #%d (by %s)", filepath.Base(match.Sheet.Path), match.Track.Number, match.By)
+
+	var changes []FieldChange
+	set := func(field, value string) {
+		if old := fieldValue(&newMeta, field); value != "" && value != old {
+			setFieldValue(&newMeta, field, value)
+			changes = append(changes, FieldChange{Field: field, Old: old, New: value, Rule: rule, Type: changeTypeCue})
+		}
+	}
+	set("title", match.Track.Title)
+	set("artist", match.Track.Performer)
+	set("album", match.Sheet.Title)
+	set("track", strconv.Itoa(match.Track.Number))
+
+	return &newMeta, changes, nil
+}
+
+// CueEntry is the cue sheet track matched to an audio file
+type CueEntry struct {
+	Sheet *cue.Sheet
+	Track cue.Track
+	By    string // How the file was matched (cue.ByFile, cue.ByNumber, ...)
+}
+
+// CueEntries indexes cue sheet matches by audio file path, for ProcessOptions.Cue
+func CueEntries(results []*cue.Result) map[string]CueEntry {
+	entries := make(map[string]CueEntry)
+	for _, result := range results {
+		for _, match := range result.Matches {
+			entries[match.File.Path] = CueEntry{Sheet: result.Sheet, Track: match.Track, By: match.By}
+		}
+	}
+	return entries
+}
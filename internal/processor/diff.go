@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mp3tools/internal/tagger"
+)
+
+// Rule names reported in field diffs
+const (
+	RuleCleanup      = "cleanup"
+	RuleZeroPad      = "zero-pad"
+	RuleFallbackFile = "fallback from filename"
+	RuleFallbackDir  = "fallback from dir"
+	RuleEmbedCover   = "embed cover"
+)
+
+// Diff output formats for test mode
+const (
+	FormatText    = "text"
+	FormatUnified = "unified"
+	FormatJSON    = "json"
+)
+
+// FieldChange records a single change made to a field by one pipeline rule
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+	Rule  string // Rule name shown in diffs
+	Type  string // Rule type (one of the RuleType* values)
+}
+
+// FieldDiff is the overall change of one field with the rules that produced it
+type FieldDiff struct {
+	Field string   `json:"field"`
+	Old   string   `json:"old"`
+	New   string   `json:"new"`
+	Rules []string `json:"rules"`
+}
+
+// FileDiff lists the field diffs of one file
+type FileDiff struct {
+	Path    string      `json:"path"`
+	Changes []FieldDiff `json:"changes"`
+}
+
+// diffFields lists every metadata field in display order
+var diffFields = []string{"title", "artist", "album", "year", "genre", "track", "comment"}
+
+// ruleEncodingPrefix starts the rule name of every encoding conversion
+const ruleEncodingPrefix = "encoding "
+
+// encodingRule returns the rule name for an encoding conversion
+func encodingRule(charset string) string {
+	return fmt.Sprintf("%s%s→UTF-8", ruleEncodingPrefix, charset)
+}
+
+// buildDiff compares old and new metadata field by field and attaches the rules that changed each field
+func buildDiff(path string, oldMeta, newMeta *tagger.Metadata, changes []FieldChange) FileDiff {
+	diff := FileDiff{Path: path, Changes: []FieldDiff{}}
+
+	for _, field := range diffFields {
+		oldValue := fieldValue(oldMeta, field)
+		newValue := fieldValue(newMeta, field)
+		if oldValue == newValue {
+			continue
+		}
+
+		rules := []string{}
+		for _, change := range changes {
+			if change.Field == field {
+				rules = append(rules, change.Rule)
+			}
+		}
+
+		diff.Changes = append(diff.Changes, FieldDiff{
+			Field: field,
+			Old:   oldValue,
+			New:   newValue,
+			Rules: rules,
+		})
+	}
+
+	return diff
+}
+
+// fieldValue returns a metadata field as a string
+func fieldValue(meta *tagger.Metadata, field string) string {
+	switch field {
+	case "title":
+		return meta.Title
+	case "artist":
+		return meta.Artist
+	case "album":
+		return meta.Album
+	case "year":
+		if meta.Year == 0 {
+			return ""
+		}
+		return strconv.Itoa(meta.Year)
+	case "genre":
+		return meta.Genre
+	case "track":
+		if meta.Track == 0 {
+			return ""
+		}
+		return strconv.Itoa(meta.Track)
+	case "comment":
+		return meta.Comment
+	default:
+		return ""
+	}
+}
+
+// formatDiff renders a file diff in the given format
+func formatDiff(diff FileDiff, format string) string {
+	switch format {
+	case FormatJSON:
+		data, err := json.Marshal(diff)
+		if err != nil {
+			return fmt.Sprintf(`{"path":%q,"error":%q}`+"\n", diff.Path, err.Error())
+		}
+		return string(data) + "\n"
+	case FormatUnified:
+		return formatUnified(diff)
+	default:
+		return formatText(diff)
+	}
+}
+
+// formatText renders a diff as one line per changed field
+func formatText(diff FileDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "File: %s\n", diff.Path)
+	if len(diff.Changes) == 0 {
+		b.WriteString("  (no changes)\n")
+	}
+	for _, change := range diff.Changes {
+		fmt.Fprintf(&b, "  %s: %q → %q [%s]\n",
+			fieldLabel(change.Field), change.Old, change.New, strings.Join(change.Rules, ", "))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// formatUnified renders a diff in unified diff style, one hunk per changed field
+func formatUnified(diff FileDiff) string {
+	if len(diff.Changes) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n", diff.Path)
+	fmt.Fprintf(&b, "+++ b/%s\n", diff.Path)
+	for _, change := range diff.Changes {
+		fmt.Fprintf(&b, "@@ %s @@ %s\n", fieldLabel(change.Field), strings.Join(change.Rules, ", "))
+		if change.Old != "" {
+			fmt.Fprintf(&b, "-%s: %s\n", fieldLabel(change.Field), change.Old)
+		}
+		if change.New != "" {
+			fmt.Fprintf(&b, "+%s: %s\n", fieldLabel(change.Field), change.New)
+		}
+	}
+	return b.String()
+}
+
+// fieldLabel returns the display name of a field
+func fieldLabel(field string) string {
+	if field == "" {
+		return field
+	}
+	return strings.ToUpper(field[:1]) + field[1:]
+}
@@ -0,0 +1,326 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mp3tools/internal/loudness"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+	"mp3tools/internal/writer"
+)
+
+// ReplayGain tag descriptions (TXXX)
+const (
+	TagTrackGain = "REPLAYGAIN_TRACK_GAIN"
+	TagTrackPeak = "REPLAYGAIN_TRACK_PEAK"
+	TagAlbumGain = "REPLAYGAIN_ALBUM_GAIN"
+	TagAlbumPeak = "REPLAYGAIN_ALBUM_PEAK"
+	TagGainUndo  = "MP3GAIN_UNDO" // Applied global_gain steps, as mp3gain writes them: "+002,+002,N"
+)
+
+// Gain modes for adjusting global_gain (ProcessOptions.ApplyGain)
+const (
+	ApplyTrack = "track"
+	ApplyAlbum = "album"
+)
+
+// albumGain collects the track loudness of one directory
+type albumGain struct {
+	relDir string
+	tracks []trackGain
+}
+
+// trackGain is the loudness of one analyzed file
+type trackGain struct {
+	file   scanner.AudioFile
+	result *loudness.Result
+}
+
+// initAlbums sets up the albums of the files' directories, in scan order
+func (p *Processor) initAlbums(files []scanner.AudioFile) {
+	p.albums = make(map[string]*albumGain)
+	p.albumOrder = nil
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		if p.albums[dir] == nil {
+			p.albums[dir] = &albumGain{relDir: filepath.Dir(file.RelPath)}
+			p.albumOrder = append(p.albumOrder, dir)
+		}
+	}
+}
+
+// gainFile measures the loudness of a file. Album gains are computed and the tags written
+// by finishAlbums once every file has been analyzed.
+func (p *Processor) gainFile(file scanner.AudioFile) error {
+	result, err := loudness.AnalyzeFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", file.Path, err)
+	}
+
+	p.mu.Lock()
+	album := p.albums[filepath.Dir(file.Path)]
+	album.tracks = append(album.tracks, trackGain{file: file, result: result})
+	p.mu.Unlock()
+
+	fmt.Printf("[%d/%d] Analyzed: %s → %s, peak %s, gain %s\n",
+		p.getCurrentIndex(), p.stats.Total, convertPathToUTF8(file.RelPath),
+		formatLUFS(result.Loudness), formatPeakDB(result), formatGain(result.Gain()))
+	return nil
+}
+
+// finishAlbums computes the album gain of each directory and writes the tags of its tracks,
+// one directory per worker. It runs after all workers have analyzed their files.
+func (p *Processor) finishAlbums(threads int) {
+	workers.Run(len(p.albumOrder), threads, func(index int) {
+		p.finishAlbum(p.albums[p.albumOrder[index]])
+	})
+}
+
+// finishAlbum computes the album gain of a directory and writes the ReplayGain tags of its tracks
+func (p *Processor) finishAlbum(album *albumGain) {
+	if len(album.tracks) == 0 {
+		return
+	}
+	sort.Slice(album.tracks, func(i, j int) bool {
+		return album.tracks[i].file.RelPath < album.tracks[j].file.RelPath
+	})
+
+	results := make([]*loudness.Result, len(album.tracks))
+	for i, track := range album.tracks {
+		results[i] = track.result
+	}
+	total := loudness.Album(results)
+	fmt.Printf("Album: %s → %s, peak %s, gain %s (%d tracks)\n",
+		convertPathToUTF8(album.relDir), formatLUFS(total.Loudness), formatPeakDB(total), formatGain(total.Gain()), len(album.tracks))
+
+	p.mu.Lock()
+	p.stats.GainAlbums++
+	p.mu.Unlock()
+	if p.options.AnalyzeOnly {
+		return
+	}
+
+	for _, track := range album.tracks {
+		if err := p.writeGain(track, total); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			p.mu.Lock()
+			p.stats.GainWriteFailed++
+			p.mu.Unlock()
+			continue
+		}
+		p.mu.Lock()
+		p.stats.TagsUpdated++
+		p.mu.Unlock()
+	}
+}
+
+// writeGain writes the track and album ReplayGain tags of a file, journaling the original tag first.
+// With ApplyGain, the global_gain is adjusted in a copy that gets the tags before replacing the file.
+func (p *Processor) writeGain(track trackGain, album *loudness.Result) error {
+	path := track.file.Path
+	if p.options.Journal != nil {
+		if err := p.options.Journal.Record(path); err != nil {
+			return fmt.Errorf("failed to journal %s: %w", path, err)
+		}
+	}
+
+	texts, err := tagger.ReadUserTexts(path)
+	if err != nil {
+		texts = map[string]string{}
+	}
+
+	// tag writes the ReplayGain tags describing the audio after adjusting it by applied steps
+	tag := func(target string, applied int) error {
+		w, err := writer.New(target)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer w.Close()
+
+		dB := float64(applied) * mpeg.GainStep
+		factor := math.Pow(10, dB/20)
+		w.SetUserText(TagTrackGain, formatGain(track.result.Gain()-dB))
+		w.SetUserText(TagTrackPeak, fmt.Sprintf("%.6f", track.result.TruePeak*factor))
+		w.SetUserText(TagAlbumGain, formatGain(album.Gain()-dB))
+		w.SetUserText(TagAlbumPeak, fmt.Sprintf("%.6f", album.TruePeak*factor))
+		if applied != 0 {
+			w.SetUserText(TagGainUndo, formatUndo(parseUndo(texts[TagGainUndo])+applied))
+		}
+		if err := w.Save(); err != nil {
+			return fmt.Errorf("failed to write tags to %s: %w", path, err)
+		}
+		return nil
+	}
+
+	var steps int
+	switch p.options.ApplyGain {
+	case ApplyTrack:
+		steps = gainSteps(track.result.Gain(), track.result.TruePeak)
+	case ApplyAlbum:
+		// Same steps for every track keeps the album balance
+		steps = gainSteps(album.Gain(), album.TruePeak)
+	default:
+		return tag(path, 0)
+	}
+	applied, err := mpeg.AdjustGainFile(path, steps, tag)
+	if err != nil {
+		return fmt.Errorf("failed to adjust gain of %s: %w", path, err)
+	}
+
+	dB := float64(applied) * mpeg.GainStep
+	if applied != 0 {
+		fmt.Printf("  Adjusted: %s %s (%d steps)\n", convertPathToUTF8(track.file.RelPath), formatGain(dB), applied)
+		p.mu.Lock()
+		p.stats.GainAdjusted++
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// gainSteps rounds a gain to global_gain steps, lowered so the true peak stays at or below 0 dBTP
+func gainSteps(gain, peak float64) int {
+	steps := int(math.Round(gain / mpeg.GainStep))
+	for steps > 0 && peak*math.Pow(10, float64(steps)*mpeg.GainStep/20) > 1 {
+		steps--
+	}
+	return steps
+}
+
+// undoGainFile reverts the global_gain steps recorded in the MP3GAIN_UNDO tag of a file
+func (p *Processor) undoGainFile(file scanner.AudioFile) error {
+	texts, err := tagger.ReadUserTexts(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read tags from %s: %w", file.Path, err)
+	}
+
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	steps := parseUndo(texts[TagGainUndo])
+	if steps == 0 {
+		p.mu.Lock()
+		p.stats.Unchanged++
+		p.mu.Unlock()
+		fmt.Printf("[%d/%d] Unchanged: %s (no %s tag)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, TagGainUndo)
+		return nil
+	}
+
+	// The undo tag is rewritten in the adjusted copy, so an interrupted undo can be rerun
+	applied, err := mpeg.AdjustGainFile(file.Path, -steps, func(target string, applied int) error {
+		w, err := writer.New(target)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Path, err)
+		}
+		defer w.Close()
+
+		// Keep the ReplayGain tags in line with the restored audio
+		dB := float64(applied) * mpeg.GainStep
+		for _, tag := range []string{TagTrackGain, TagAlbumGain} {
+			if gain, ok := parseGain(texts[tag]); ok {
+				w.SetUserText(tag, formatGain(gain-dB))
+			}
+		}
+		for _, tag := range []string{TagTrackPeak, TagAlbumPeak} {
+			if peak, err := strconv.ParseFloat(texts[tag], 64); err == nil {
+				w.SetUserText(tag, fmt.Sprintf("%.6f", peak*math.Pow(10, dB/20)))
+			}
+		}
+		w.SetUserText(TagGainUndo, formatUndo(steps+applied))
+		if err := w.Save(); err != nil {
+			return fmt.Errorf("failed to write tags to %s: %w", file.Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to adjust gain of %s: %w", file.Path, err)
+	}
+	dB := float64(applied) * mpeg.GainStep
+
+	p.mu.Lock()
+	p.stats.GainAdjusted++
+	p.mu.Unlock()
+	fmt.Printf("[%d/%d] Restored: %s %s (%d steps)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, formatGain(dB), applied)
+	return nil
+}
+
+// parseUndo returns the steps recorded in an MP3GAIN_UNDO value (0 if empty or invalid)
+func parseUndo(value string) int {
+	steps, err := strconv.Atoi(strings.TrimSpace(strings.Split(value, ",")[0]))
+	if err != nil {
+		return 0
+	}
+	return steps
+}
+
+// formatUndo formats steps as an MP3GAIN_UNDO value (empty for none, which removes the tag)
+func formatUndo(steps int) string {
+	if steps == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+04d,%+04d,N", steps, steps)
+}
+
+// parseGain parses a ReplayGain gain value such as "-3.21 dB"
+func parseGain(value string) (float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	gain, err := strconv.ParseFloat(fields[0], 64)
+	return gain, err == nil
+}
+
+// formatGain formats a gain as ReplayGain does, e.g. "-3.21 dB"
+func formatGain(gain float64) string {
+	return fmt.Sprintf("%+.2f dB", gain)
+}
+
+// formatLUFS formats an integrated loudness
+func formatLUFS(lufs float64) string {
+	if math.IsInf(lufs, -1) {
+		return "silent"
+	}
+	return fmt.Sprintf("%.1f LUFS", lufs)
+}
+
+// formatPeakDB formats a true peak in dBTP
+func formatPeakDB(result *loudness.Result) string {
+	if result.TruePeak == 0 {
+		return "-inf dBTP"
+	}
+	return fmt.Sprintf("%.1f dBTP", result.PeakDB())
+}
+
+// printGainUndoStatistics prints statistics of reverted gain adjustments
+func (p *Processor) printGainUndoStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Restored: %d\n", p.stats.GainAdjusted)
+	fmt.Printf("  Unchanged: %d\n", p.stats.Unchanged)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
+
+// printGainStatistics prints loudness statistics
+func (p *Processor) printGainStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Analyzed: %d\n", p.stats.Success)
+	fmt.Printf("  Albums: %d\n", p.stats.GainAlbums)
+	if !p.options.AnalyzeOnly {
+		fmt.Printf("  Tags updated: %d\n", p.stats.TagsUpdated)
+		fmt.Printf("  Write failed: %d\n", p.stats.GainWriteFailed)
+	}
+	if p.options.ApplyGain != "" {
+		fmt.Printf("  Gain adjusted: %d\n", p.stats.GainAdjusted)
+	}
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
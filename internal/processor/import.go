@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"fmt"
+
+	"mp3tools/internal/catalog"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+)
+
+// changeTypeImport is the change type of fields taken from an imported tag database
+const changeTypeImport = "import"
+
+// ImportEntry is the tag database row matched to an audio file
+type ImportEntry struct {
+	Row *catalog.Row
+	By  string // How the row was matched (catalog.ByPath or catalog.ByHash)
+}
+
+// ImportEntries indexes the matched rows by audio file path, for ProcessOptions.Import
+func ImportEntries(result *catalog.Result) map[string]ImportEntry {
+	entries := make(map[string]ImportEntry)
+	for _, match := range result.Matches {
+		entries[match.File.Path] = ImportEntry{Row: match.Row, By: match.By}
+	}
+	return entries
+}
+
+// importMetadata sets the editable fields of the file's row; empty cells clear a field.
+// The rule pipeline is not run, so the row is the only source of changes.
+func (p *Processor) importMetadata(meta *tagger.Metadata, file scanner.AudioFile) (*tagger.Metadata, []FieldChange, error) {
+	entry, ok := p.options.Import[file.Path]
+	if !ok {
+		return nil, nil, fmt.Errorf("no import row for %s", file.Path)
+	}
+
+	newMeta := *meta
+	rule := fmt.Sprintf("import row %d (by %s)", entry.Row.Line, entry.By)
+
+	var changes []FieldChange
+	for _, edit := range entry.Row.Apply(meta) {
+		setFieldValue(&newMeta, edit.Field, edit.New)
+		changes = append(changes, FieldChange{Field: edit.Field, Old: edit.Old, New: edit.New, Rule: rule, Type: changeTypeImport})
+	}
+	return &newMeta, changes, nil
+}
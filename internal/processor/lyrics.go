@@ -0,0 +1,148 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mp3tools/internal/lyrics"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/writer"
+)
+
+// DefaultLyricsLanguage is the ISO 639-2 code written when the language is unknown
+const DefaultLyricsLanguage = "und"
+
+// lyricsFile embeds the .lrc file next to an audio file as USLT lyrics, and as SYLT too
+// with SyncedLyrics. Files that already have lyrics are skipped unless ReplaceLyrics is set.
+func (p *Processor) lyricsFile(file scanner.AudioFile) error {
+	lrcPath, found := lyrics.FindSidecar(file.Path)
+	if !found {
+		p.mu.Lock()
+		p.stats.NoLyrics++
+		p.mu.Unlock()
+		return nil
+	}
+
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	if !p.options.ReplaceLyrics {
+		if _, err := lyrics.ReadEmbedded(file.Path); err == nil {
+			p.mu.Lock()
+			p.stats.LyricsSkipped++
+			p.mu.Unlock()
+			fmt.Printf("[%d/%d] Skipped: %s (already has lyrics, use -f to replace)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay)
+			return nil
+		}
+	}
+
+	lyr, charset, err := lyrics.LoadFile(lrcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", lrcPath, err)
+	}
+
+	lang := p.options.LyricsLanguage
+	if lang == "" {
+		lang = DefaultLyricsLanguage
+	}
+	w, err := writer.New(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file.Path, err)
+	}
+	defer w.Close()
+	w.SetLyrics(lyr.Plain(), lang)
+	if p.options.SyncedLyrics && lyr.Synced {
+		w.SetSyncedLyrics(lyrics.EncodeSYLT(lyr, lang))
+	} else if p.options.ReplaceLyrics {
+		// Drop stale synchronised lyrics replaced by the new ones
+		w.SetSyncedLyrics(nil)
+	}
+	if err := p.saveTags(file, w); err != nil {
+		return err
+	}
+
+	kind := "plain"
+	if lyr.Synced {
+		kind = "synced"
+	}
+	fixed := charset != "UTF-8" && charset != ""
+	if fixed {
+		kind += ", " + charset + "→UTF-8"
+	}
+	p.mu.Lock()
+	p.stats.LyricsImported++
+	if fixed {
+		p.stats.EncodingFixed++
+	}
+	p.mu.Unlock()
+
+	fmt.Printf("[%d/%d] Importing: %s ← %s (%d lines, %s)\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, filepath.Base(lrcPath), len(lyr.Lines), kind)
+	return nil
+}
+
+// exportLyricsFile writes the embedded lyrics of an audio file to a .lrc file next to it,
+// or next to its copy in the output directory
+func (p *Processor) exportLyricsFile(file scanner.AudioFile) error {
+	lyr, err := lyrics.ReadEmbedded(file.Path)
+	if errors.Is(err, lyrics.ErrNoLyrics) {
+		p.mu.Lock()
+		p.stats.NoLyrics++
+		p.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read lyrics from %s: %w", file.Path, err)
+	}
+
+	target := lyrics.SidecarPath(p.outPath(file))
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	if !p.options.ReplaceLyrics {
+		if _, err := os.Stat(target); err == nil {
+			p.mu.Lock()
+			p.stats.LyricsSkipped++
+			p.mu.Unlock()
+			fmt.Printf("[%d/%d] Skipped: %s (%s exists, use -f to replace)\n",
+				p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, filepath.Base(target))
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := lyrics.SaveFile(target, lyr); err != nil {
+		return fmt.Errorf("failed to export lyrics of %s: %w", file.Path, err)
+	}
+
+	p.mu.Lock()
+	p.stats.LyricsExported++
+	p.mu.Unlock()
+	fmt.Printf("[%d/%d] Exporting: %s → %s (%d lines)\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, filepath.Base(target), len(lyr.Lines))
+	return nil
+}
+
+// printLyricsStatistics prints lyrics import statistics
+func (p *Processor) printLyricsStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Lyrics imported: %d\n", p.stats.LyricsImported)
+	fmt.Printf("  Encoding fixed: %d\n", p.stats.EncodingFixed)
+	fmt.Printf("  Skipped (has lyrics): %d\n", p.stats.LyricsSkipped)
+	fmt.Printf("  No lyrics file: %d\n", p.stats.NoLyrics)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
+
+// printLyricsExportStatistics prints lyrics export statistics
+func (p *Processor) printLyricsExportStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Lyrics exported: %d\n", p.stats.LyricsExported)
+	fmt.Printf("  Skipped (.lrc exists): %d\n", p.stats.LyricsSkipped)
+	fmt.Printf("  No embedded lyrics: %d\n", p.stats.NoLyrics)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"mp3tools/internal/chapters"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/writer"
+)
+
+// albumMerge collects the files of one directory until all their tags are read
+type albumMerge struct {
+	remaining int
+	tracks    []mergeTrack
+}
+
+// mergeTrack is one source file of a merge
+type mergeTrack struct {
+	file scanner.AudioFile
+	meta *tagger.Metadata
+}
+
+// initMerges counts the files of each directory, so the last worker of a directory can merge it
+func (p *Processor) initMerges(files []scanner.AudioFile) {
+	p.merges = make(map[string]*albumMerge)
+	for _, file := range files {
+		dir := filepath.Dir(file.Path)
+		if p.merges[dir] == nil {
+			p.merges[dir] = &albumMerge{}
+		}
+		p.merges[dir].remaining++
+	}
+}
+
+// mergeFile reads the tags of a file. The worker that reads the last file of a directory
+// joins the directory into one file with a chapter per source file.
+func (p *Processor) mergeFile(file scanner.AudioFile) error {
+	meta, err := tagger.ReadTags(file.Path)
+	if err != nil {
+		meta = &tagger.Metadata{}
+	}
+
+	p.mu.Lock()
+	album := p.merges[filepath.Dir(file.Path)]
+	album.remaining--
+	album.tracks = append(album.tracks, mergeTrack{file: file, meta: meta})
+	done := album.remaining == 0
+	p.mu.Unlock()
+
+	if !done {
+		return nil
+	}
+	return p.finishMerge(file, album.tracks)
+}
+
+// finishMerge merges the files of a directory into <output>/<directory>.mp3 with a fresh tag
+// taken from the first track, the album as title, and CHAP/CTOC frames for the source files
+func (p *Processor) finishMerge(last scanner.AudioFile, tracks []mergeTrack) error {
+	sortMergeTracks(tracks)
+
+	relDir := filepath.Dir(last.RelPath)
+	if relDir == "." {
+		relDir = filepath.Base(last.BasePath)
+	}
+	outPath := filepath.Join(p.options.OutDir, relDir+".mp3")
+
+	if len(tracks) > chapters.MaxChapters {
+		return fmt.Errorf("failed to merge %s: %d files, but a chapter list holds at most %d", filepath.Dir(last.Path), len(tracks), chapters.MaxChapters)
+	}
+
+	srcs := make([]string, len(tracks))
+	for i, track := range tracks {
+		srcs[i] = track.file.Path
+	}
+	result, err := mpeg.MergeFiles(srcs, outPath)
+	if err != nil {
+		return fmt.Errorf("failed to merge %s: %w", filepath.Dir(last.Path), err)
+	}
+
+	first := tracks[0].meta
+	title := first.Album
+	if title == "" {
+		title = filepath.Base(relDir)
+	}
+	data := &writer.TagData{
+		Title:  title,
+		Artist: first.Artist,
+		Album:  first.Album,
+		Genre:  first.Genre,
+	}
+	if first.Year > 0 {
+		data.Year = strconv.Itoa(first.Year)
+	}
+	if pictures, err := tagger.ReadPictures(tracks[0].file.Path); err == nil {
+		if front := tagger.FrontCover(pictures); front != nil {
+			data.Cover, data.CoverMimeType = front.Data, front.MimeType
+		}
+	}
+
+	list := make([]chapters.Chapter, len(tracks))
+	for i, track := range tracks {
+		list[i] = chapters.Chapter{
+			Start: result.Starts[i],
+			End:   result.Starts[i] + result.Lengths[i],
+			Title: track.meta.Title,
+		}
+		if list[i].Title == "" {
+			list[i].Title = strings.TrimSuffix(filepath.Base(track.file.Path), filepath.Ext(track.file.Path))
+		}
+	}
+	chapters.Number(list)
+	bodies, toc, err := chapters.Encode(list)
+	if err != nil {
+		return fmt.Errorf("failed to merge %s: %w", filepath.Dir(last.Path), err)
+	}
+
+	w, err := writer.New(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", outPath, err)
+	}
+	defer w.Close()
+	w.SetAllTags(data)
+	w.SetLength(result.Duration)
+	w.SetChapters(bodies, toc)
+	if err := w.Save(); err != nil {
+		return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
+	}
+
+	p.mu.Lock()
+	p.stats.DirsMerged++
+	p.stats.ChaptersWritten += len(list)
+	p.mu.Unlock()
+
+	fmt.Printf("[%d/%d] Merged: %s → %s (%d chapters, %s)\n", p.getCurrentIndex(), p.stats.Total,
+		convertPathToUTF8(relDir), convertPathToUTF8(outPath), len(list), mpeg.FormatDuration(result.Duration))
+	for _, chapter := range list {
+		fmt.Printf("  %s %s\n", mpeg.FormatDuration(chapter.Start), chapter.Title)
+	}
+	return nil
+}
+
+// sortMergeTracks orders the files of a directory by track number if every file has a
+// distinct one, otherwise by file name with numbers compared by value ("2" before "10")
+func sortMergeTracks(tracks []mergeTrack) {
+	numbers := make(map[int]bool)
+	for _, track := range tracks {
+		numbers[track.meta.Track] = true
+	}
+	if !numbers[0] && len(numbers) == len(tracks) {
+		sort.Slice(tracks, func(i, j int) bool { return tracks[i].meta.Track < tracks[j].meta.Track })
+		return
+	}
+	sort.Slice(tracks, func(i, j int) bool { return naturalLess(tracks[i].file.RelPath, tracks[j].file.RelPath) })
+}
+
+// naturalLess compares strings with runs of digits compared by value
+func naturalLess(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if unicode.IsDigit(ra[i]) && unicode.IsDigit(rb[j]) {
+			si, sj := i, j
+			for i < len(ra) && unicode.IsDigit(ra[i]) {
+				i++
+			}
+			for j < len(rb) && unicode.IsDigit(rb[j]) {
+				j++
+			}
+			na := strings.TrimLeft(string(ra[si:i]), "0")
+			nb := strings.TrimLeft(string(rb[sj:j]), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if ra[i] != rb[j] {
+			return ra[i] < rb[j]
+		}
+		i++
+		j++
+	}
+	return len(ra)-i < len(rb)-j
+}
+
+// printMergeStatistics prints merge statistics
+func (p *Processor) printMergeStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Merged directories: %d\n", p.stats.DirsMerged)
+	fmt.Printf("  Chapters: %d\n", p.stats.ChaptersWritten)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
@@ -0,0 +1,409 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mp3tools/internal/encoder"
+	"mp3tools/internal/tagger"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule types
+const (
+	RuleTypeFixEncoding    = "fix-encoding"
+	RuleTypeClean          = "clean"
+	RuleTypeNormalize      = "normalize"
+	RuleTypePad            = "pad"
+	RuleTypeDeriveFromPath = "derive-from-path"
+	RuleTypeRegexReplace   = "regex-replace"
+	RuleTypeSetConstant    = "set-constant"
+)
+
+// Rule conditions (the "when" key)
+const (
+	WhenAlways         = "always"
+	WhenEmpty          = "empty"
+	WhenNotEmpty       = "not-empty"
+	WhenGarbled        = "garbled"
+	WhenEmptyOrGarbled = "empty-or-garbled"
+)
+
+// Path sources for derive-from-path rules
+const (
+	SourceFilename  = "filename"   // Filename without extension, trailing number moved to front
+	SourceDir       = "dir"        // Parent directory name
+	SourceDirPrefix = "dir-prefix" // Parent directory name before the first underscore
+)
+
+// RuleConfig is one rule entry of a pipeline config file
+type RuleConfig struct {
+	Name    string   `yaml:"name"`    // Name shown in diffs (default depends on type)
+	Type    string   `yaml:"type"`    // One of the RuleType* values
+	Fields  []string `yaml:"fields"`  // Fields the rule applies to (default: title, artist, album)
+	When    string   `yaml:"when"`    // Condition on the current field value (default depends on type)
+	Match   string   `yaml:"match"`   // Optional regex the current field value must match
+	Source  string   `yaml:"source"`  // derive-from-path: filename, dir or dir-prefix
+	Width   int      `yaml:"width"`   // pad: number width (default: 2)
+	Pattern string   `yaml:"pattern"` // regex-replace: regex to find
+	Replace string   `yaml:"replace"` // regex-replace: replacement ($1 for groups)
+	Value   string   `yaml:"value"`   // set-constant: value to set
+	File    string   `yaml:"file"`    // clean: cleanup rule file (default: built-in cleanup rules)
+}
+
+// PipelineConfig is the content of a pipeline config file
+type PipelineConfig struct {
+	Rules []RuleConfig `yaml:"rules"`
+}
+
+// Pipeline is a compiled, ordered list of rules
+type Pipeline struct {
+	rules []*rule
+}
+
+// rule is a compiled pipeline rule
+type rule struct {
+	name   string
+	named  bool // Name set in config
+	kind   string
+	fields []string
+	when   string
+	match  *regexp.Regexp
+	apply  func(field, value string, ctx *ruleContext) (string, string) // Returns new value and detailed rule name (optional)
+}
+
+// ruleContext holds per-file values used by rules
+type ruleContext struct {
+	fileName  string // UTF-8 filename without extension
+	dirName   string // UTF-8 parent directory name
+	overwrite bool   // Derive rules ignore their condition (-f -a)
+}
+
+// pipelineFields lists the fields rules can target
+var pipelineFields = map[string]bool{
+	"title": true, "artist": true, "album": true, "genre": true, "comment": true, "year": true, "track": true,
+}
+
+// DefaultPipelineConfig returns the built-in pipeline:
+// encoding → cleanup → zero-pad → fallback from filename/directory
+func DefaultPipelineConfig() PipelineConfig {
+	textFields := []string{"title", "artist", "album"}
+	return PipelineConfig{Rules: []RuleConfig{
+		{Type: RuleTypeFixEncoding, Fields: textFields},
+		{Type: RuleTypeClean, Fields: textFields},
+		{Type: RuleTypePad, Fields: []string{"title"}, Width: 2},
+		{Type: RuleTypeDeriveFromPath, Fields: []string{"title"}, Source: SourceFilename, When: WhenEmptyOrGarbled},
+		{Type: RuleTypeDeriveFromPath, Fields: []string{"album"}, Source: SourceDir, When: WhenEmptyOrGarbled},
+		{Type: RuleTypeDeriveFromPath, Fields: []string{"artist"}, Source: SourceDirPrefix, When: WhenEmptyOrGarbled},
+	}}
+}
+
+// LoadPipelineConfig reads a pipeline config from a YAML file
+func LoadPipelineConfig(path string) (PipelineConfig, error) {
+	var config PipelineConfig
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	defer file.Close()
+
+	// Reject unknown keys so typos don't silently disable a rule
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("failed to parse rules file %s: %w", path, err)
+	}
+	if len(config.Rules) == 0 {
+		return config, fmt.Errorf("rules file %s has no rules", path)
+	}
+
+	// Cleanup files are relative to the rules file
+	for i := range config.Rules {
+		if file := config.Rules[i].File; file != "" && !filepath.IsAbs(file) {
+			config.Rules[i].File = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+
+	return config, nil
+}
+
+// SetCleanupFile makes every clean rule without its own file use the given cleanup rule file
+func (c *PipelineConfig) SetCleanupFile(path string) {
+	for i := range c.Rules {
+		if c.Rules[i].Type == RuleTypeClean && c.Rules[i].File == "" {
+			c.Rules[i].File = path
+		}
+	}
+}
+
+// CompilePipeline validates a pipeline config and compiles its rules
+func CompilePipeline(config PipelineConfig) (*Pipeline, error) {
+	pipeline := &Pipeline{}
+	cleanupSets := make(map[string]*CleanupSet)
+	for i, rc := range config.Rules {
+		r, err := compileRule(rc, cleanupSets)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, rc.Type, err)
+		}
+		pipeline.rules = append(pipeline.rules, r)
+	}
+	return pipeline, nil
+}
+
+// DefaultPipeline returns the compiled built-in pipeline
+func DefaultPipeline() *Pipeline {
+	pipeline, err := CompilePipeline(DefaultPipelineConfig())
+	if err != nil {
+		panic(err) // Built-in rules always compile
+	}
+	return pipeline
+}
+
+// loadCleanupSetCached loads a cleanup rule file once per pipeline compilation
+func loadCleanupSetCached(path string, cache map[string]*CleanupSet) (*CleanupSet, error) {
+	if set, ok := cache[path]; ok {
+		return set, nil
+	}
+	set, err := LoadCleanupSet(path)
+	if err != nil {
+		return nil, err
+	}
+	cache[path] = set
+	return set, nil
+}
+
+// compileRule compiles a single rule config
+func compileRule(rc RuleConfig, cleanupSets map[string]*CleanupSet) (*rule, error) {
+	r := &rule{
+		name:   rc.Name,
+		named:  rc.Name != "",
+		kind:   rc.Type,
+		fields: rc.Fields,
+		when:   rc.When,
+	}
+	if len(r.fields) == 0 {
+		r.fields = []string{"title", "artist", "album"}
+	}
+	for _, field := range r.fields {
+		if !pipelineFields[field] {
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+	}
+
+	if rc.Match != "" {
+		match, err := regexp.Compile(rc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match regex: %w", err)
+		}
+		r.match = match
+	}
+
+	// Default condition: only touch existing values, except for rules that fill values in
+	defaultWhen := WhenNotEmpty
+	defaultName := rc.Type
+
+	switch rc.Type {
+	case RuleTypeFixEncoding:
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			fixed, charset, changed := encoder.FixEncoding(value)
+			if !changed {
+				return value, ""
+			}
+			return fixed, encodingRule(charset)
+		}
+	case RuleTypeClean:
+		defaultName = RuleCleanup
+		cleanup := DefaultCleanupSet()
+		if rc.File != "" {
+			set, err := loadCleanupSetCached(rc.File, cleanupSets)
+			if err != nil {
+				return nil, err
+			}
+			cleanup = set
+		}
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			cleaned, applied := cleanup.Clean(field, value)
+			if len(applied) == 0 {
+				return cleaned, ""
+			}
+			return cleaned, RuleCleanup + ": " + strings.Join(applied, ", ")
+		}
+	case RuleTypeNormalize:
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			return normalizeText(value), ""
+		}
+	case RuleTypePad:
+		defaultName = RuleZeroPad
+		padWidth := rc.Width
+		if padWidth == 0 {
+			padWidth = 2
+		}
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			return formatTitle(value, padWidth), ""
+		}
+	case RuleTypeDeriveFromPath:
+		defaultWhen = WhenEmptyOrGarbled
+		switch rc.Source {
+		case SourceFilename:
+			defaultName = RuleFallbackFile
+		case SourceDir, SourceDirPrefix:
+			defaultName = RuleFallbackDir
+		default:
+			return nil, fmt.Errorf("unknown source: %q (use filename, dir or dir-prefix)", rc.Source)
+		}
+		source := rc.Source
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			derived := derivePathValue(source, ctx)
+			if derived == "" {
+				return value, ""
+			}
+			return derived, ""
+		}
+	case RuleTypeRegexReplace:
+		if rc.Pattern == "" {
+			return nil, fmt.Errorf("missing pattern")
+		}
+		pattern, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		replace := rc.Replace
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			return strings.TrimSpace(pattern.ReplaceAllString(value, replace)), ""
+		}
+	case RuleTypeSetConstant:
+		defaultWhen = WhenAlways
+		constant := rc.Value
+		r.apply = func(field, value string, ctx *ruleContext) (string, string) {
+			return constant, ""
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule type: %q", rc.Type)
+	}
+
+	if r.name == "" {
+		r.name = defaultName
+	}
+	if r.when == "" {
+		r.when = defaultWhen
+	}
+	switch r.when {
+	case WhenAlways, WhenEmpty, WhenNotEmpty, WhenGarbled, WhenEmptyOrGarbled:
+	default:
+		return nil, fmt.Errorf("unknown condition: %q", r.when)
+	}
+
+	return r, nil
+}
+
+// run applies every rule in order and returns the field changes
+func (pl *Pipeline) run(meta *tagger.Metadata, ctx *ruleContext) []FieldChange {
+	var changes []FieldChange
+	for _, r := range pl.rules {
+		for _, field := range r.fields {
+			value := fieldValue(meta, field)
+			if !r.matches(value, ctx) {
+				continue
+			}
+
+			newValue, detail := r.apply(field, value, ctx)
+			if newValue == value {
+				continue
+			}
+
+			// Configured names win over detailed default names like "encoding GBK→UTF-8"
+			name := r.name
+			if !r.named && detail != "" {
+				name = detail
+			}
+
+			setFieldValue(meta, field, newValue)
+			changes = append(changes, FieldChange{Field: field, Old: value, New: newValue, Rule: name, Type: r.kind})
+		}
+	}
+	return changes
+}
+
+// matches checks the rule condition against the current field value
+func (r *rule) matches(value string, ctx *ruleContext) bool {
+	if r.match != nil && !r.match.MatchString(value) {
+		return false
+	}
+
+	// -f -a overwrites derived fields regardless of their condition
+	if r.kind == RuleTypeDeriveFromPath && ctx.overwrite {
+		return true
+	}
+
+	switch r.when {
+	case WhenEmpty:
+		return value == ""
+	case WhenNotEmpty:
+		return value != ""
+	case WhenGarbled:
+		return encoder.IsGarbled(value)
+	case WhenEmptyOrGarbled:
+		return value == "" || encoder.IsGarbled(value)
+	default:
+		return true
+	}
+}
+
+// derivePathValue returns the value a derive-from-path rule takes from the file path
+func derivePathValue(source string, ctx *ruleContext) string {
+	switch source {
+	case SourceFilename:
+		if ctx.fileName == "" {
+			return ""
+		}
+		return formatTitleFromFilename(ctx.fileName)
+	case SourceDir:
+		if ctx.dirName == "" || ctx.dirName == "." {
+			return ""
+		}
+		return ctx.dirName
+	case SourceDirPrefix:
+		if ctx.dirName == "" || ctx.dirName == "." {
+			return ""
+		}
+		// Extract artist from directory name (before underscore)
+		return strings.SplitN(ctx.dirName, "_", 2)[0]
+	default:
+		return ""
+	}
+}
+
+// normalizeText applies NFC normalization, folds full-width ASCII to half-width and collapses spaces
+func normalizeText(text string) string {
+	text = norm.NFC.String(text)
+	text = width.Fold.String(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// setFieldValue sets a metadata field from a string
+func setFieldValue(meta *tagger.Metadata, field, value string) {
+	switch field {
+	case "title":
+		meta.Title = value
+	case "artist":
+		meta.Artist = value
+	case "album":
+		meta.Album = value
+	case "genre":
+		meta.Genre = value
+	case "comment":
+		meta.Comment = value
+	case "year":
+		meta.Year, _ = strconv.Atoi(value)
+	case "track":
+		meta.Track, _ = strconv.Atoi(value)
+	}
+}
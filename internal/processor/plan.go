@@ -0,0 +1,201 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"mp3tools/internal/cover"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/writer"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// Plan describes the metadata changes for one file.
+// test prints plans while fix and tag execute them, so a preview always matches what gets written.
+type Plan struct {
+	File    scanner.AudioFile
+	OutPath string           // Destination file (same as File.Path for in-place updates)
+	Old     *tagger.Metadata // Tags as read from the file
+	New     *tagger.Metadata // Tags after processing
+	Changes []FieldChange    // Field changes in the order they were applied
+	Cover   *cover.Image     // Front cover to embed (nil keeps the current art)
+}
+
+// Unchanged reports whether the plan leaves every field as it is
+func (pl *Plan) Unchanged() bool {
+	return pl.Old.Equal(pl.New) && pl.Cover == nil
+}
+
+// NeedsWrite reports whether executing the plan writes a file.
+// Unchanged files are still copied when writing to an output directory.
+func (pl *Plan) NeedsWrite() bool {
+	return !pl.Unchanged() || pl.OutPath != pl.File.Path
+}
+
+// Diff returns the field-level diff of the plan
+func (pl *Plan) Diff() FileDiff {
+	diff := buildDiff(pl.File.RelPath, pl.Old, pl.New, pl.Changes)
+	if pl.Cover != nil {
+		old := ""
+		if pl.Old.HasPicture {
+			old = "(embedded)"
+		}
+		diff.Changes = append(diff.Changes, FieldDiff{
+			Field: "cover",
+			Old:   old,
+			New:   pl.Cover.String(),
+			Rules: []string{RuleEmbedCover},
+		})
+	}
+	return diff
+}
+
+// planFile reads the tags of a file and plans the changes processing would make
+func (p *Processor) planFile(file scanner.AudioFile) (*Plan, error) {
+	meta, err := tagger.ReadTags(file.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags from %s: %w", file.Path, err)
+	}
+
+	var newMeta *tagger.Metadata
+	var changes []FieldChange
+	switch {
+	case p.options.Cue != nil:
+		newMeta, changes, err = p.cueMetadata(meta, file)
+		if err != nil {
+			return nil, err
+		}
+	case p.options.Import != nil:
+		newMeta, changes, err = p.importMetadata(meta, file)
+		if err != nil {
+			return nil, err
+		}
+	case p.options.Set != nil:
+		newMeta, changes = p.setMetadata(meta)
+	default:
+		newMeta, changes = p.processMetadata(meta, file)
+	}
+
+	// Determine output path
+	outPath := file.Path
+	if p.options.OutDir != "" {
+		outPath = filepath.Join(p.options.OutDir, file.RelPath)
+	}
+
+	plan := &Plan{
+		File:    file,
+		OutPath: outPath,
+		Old:     meta,
+		New:     newMeta,
+		Changes: changes,
+	}
+
+	// Embed the album directory's cover, keeping existing art unless asked to replace it
+	if p.covers != nil && (!meta.HasPicture || p.options.ReplaceCovers) {
+		dir := filepath.Dir(file.Path)
+		img, err := p.covers.Get(dir)
+		if err != nil {
+			// Tag the album anyway; report the broken cover once per directory
+			if _, warned := p.coverWarned.LoadOrStore(dir, true); !warned {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+		// Rewriting the same image would make every rerun with --replace-covers rewrite every file
+		if img != nil && meta.HasPicture && hasFrontCover(file.Path, img) {
+			img = nil
+		}
+		plan.Cover = img
+	}
+
+	return plan, nil
+}
+
+// hasFrontCover reports whether the file already embeds img as its front cover
+func hasFrontCover(path string, img *cover.Image) bool {
+	pictures, err := tagger.ReadPictures(path)
+	if err != nil {
+		return false
+	}
+	for _, pic := range pictures {
+		if pic.Type == id3v2.PTFrontCover && pic.MimeType == img.MimeType && bytes.Equal(pic.Data, img.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPlan writes the planned tags, skipping in-place files that are unchanged
+func (p *Processor) applyPlan(plan *Plan) error {
+	if !plan.NeedsWrite() {
+		return nil
+	}
+
+	data := &writer.TagData{
+		Title:  plan.New.Title,
+		Artist: plan.New.Artist,
+		Album:  plan.New.Album,
+		Genre:  plan.New.Genre,
+	}
+	if plan.New.Year != 0 {
+		data.Year = strconv.Itoa(plan.New.Year)
+	}
+	if plan.New.Track != 0 {
+		data.Track = strconv.Itoa(plan.New.Track)
+	}
+	if plan.New.Comment != plan.Old.Comment {
+		data.Comment = plan.New.Comment
+	}
+	// Empty values don't overwrite, so fields the plan empties are removed explicitly
+	for _, field := range diffFields {
+		if fieldValue(plan.Old, field) != "" && fieldValue(plan.New, field) == "" {
+			data.Clear = append(data.Clear, field)
+		}
+	}
+	if plan.Cover != nil {
+		data.Cover = plan.Cover.Data
+		data.CoverMimeType = plan.Cover.MimeType
+	}
+
+	return p.writeTags(plan.File, plan.OutPath, data)
+}
+
+// countPlan updates statistics for a planned file
+func (p *Processor) countPlan(plan *Plan) {
+	encodingFixed := 0
+	autoTitle := false
+	autoAlbum := false
+	for _, change := range plan.Changes {
+		switch {
+		case change.Type == RuleTypeFixEncoding:
+			encodingFixed++
+		case change.Field == "title" && (change.Type == RuleTypePad || change.Type == RuleTypeDeriveFromPath):
+			autoTitle = true
+		case change.Field == "album" && change.Type == RuleTypeDeriveFromPath:
+			autoAlbum = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if plan.Unchanged() {
+		p.stats.Unchanged++
+	} else {
+		p.stats.TagsUpdated++
+	}
+	p.stats.EncodingFixed += encodingFixed
+	if autoTitle {
+		p.stats.AutoTitles++
+	}
+	if autoAlbum {
+		p.stats.AutoAlbums++
+	}
+	if plan.Cover != nil {
+		p.stats.CoversEmbedded++
+	}
+}
@@ -1,14 +1,18 @@
 package processor
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"mp3tools/internal/cover"
 	"mp3tools/internal/encoder"
+	"mp3tools/internal/journal"
 	"mp3tools/internal/scanner"
 	"mp3tools/internal/tagger"
 	"mp3tools/internal/writer"
@@ -16,16 +20,47 @@ import (
 
 // ProcessOptions contains options for processing files
 type ProcessOptions struct {
-	Force          bool   // Derive tags from filename and directory
-	ForceAll       bool   // Force update all tags (overwrite existing tags)
-	UpdateEncoding bool   // Fix encoding only (for tag command)
-	OutDir         string // Output directory (empty means update in place)
-	Threads        int    // Number of worker threads
+	Force            bool                   // Derive tags from filename and directory
+	ForceAll         bool                   // Force update all tags (overwrite existing tags)
+	UpdateEncoding   bool                   // Fix encoding only (for tag command)
+	OutDir           string                 // Output directory (empty means update in place)
+	Threads          int                    // Number of worker threads
+	Journal          *journal.Journal       // Records original tags before in-place updates (optional)
+	Format           string                 // Diff output format for test mode: text, unified or json
+	Pipeline         *Pipeline              // Rule pipeline (default: built-in pipeline)
+	Covers           bool                   // Embed cover.*, folder.* or front.* from each album directory
+	CoverSize        int                    // Maximum cover width/height, larger images are scaled down
+	ReplaceCovers    bool                   // Replace existing embedded covers (default: keep them)
+	Cue              map[string]CueEntry    // Cue sheet tracks by file path; tags come from the cue sheet instead of the pipeline
+	Import           map[string]ImportEntry // Tag database rows by file path; tags come from the rows instead of the pipeline
+	Set              *SetSpec               // Direct field edits; tags come from the spec instead of the pipeline (set command)
+	AnalyzeOnly      bool                   // Report loudness without writing tags (gain command)
+	ApplyGain        string                 // Adjust global_gain by the track or album gain (gain command, ApplyTrack or ApplyAlbum)
+	SilenceThreshold float64                // Frames below this RMS level in dBFS are silent (silence/trim, default: -50)
+	MinSilence       time.Duration          // Shortest silent region reported or trimmed (silence/trim, default: 500ms)
+	SilenceMargin    time.Duration          // Silence kept at each end (trim command)
+	SplitMode        string                 // Where to split: SplitAt, SplitSilence or SplitCue (split command)
+	SplitAt          []time.Duration        // Split points for SplitAt
+	SplitTitle       string                 // Title template of parts without a cue sheet title (default: DefaultSplitTitle)
+	SyncedLyrics     bool                   // Also embed timed .lrc lyrics as SYLT (lyrics command)
+	LyricsLanguage   string                 // ISO 639-2 language of embedded lyrics (lyrics command, default: DefaultLyricsLanguage)
+	ReplaceLyrics    bool                   // Replace embedded lyrics or existing .lrc files (lyrics commands)
+	ImportChapters   bool                   // Replace chapters with the .chapters.txt or .chapters.json file next to each MP3 (chapters-edit)
+	ChapterRenames   map[int]string         // New chapter titles by chapter number counting from 1 (chapters-edit)
+	ChapterShift     time.Duration          // Offset added to all chapter times (chapters-edit)
+	ExportChapters   string                 // Chapter file format to export (chapters-export)
+	ReplaceChapters  bool                   // Replace existing chapters on import or existing chapter files on export
 }
 
 // Processor handles batch processing of audio files
 type Processor struct {
 	options      ProcessOptions
+	pipeline     *Pipeline
+	covers       *cover.Cache
+	coverWarned  sync.Map               // Directories whose cover failed to load
+	albums       map[string]*albumGain  // Loudness per directory (gain command)
+	albumOrder   []string               // Directories of albums in scan order (gain command)
+	merges       map[string]*albumMerge // Source files per directory (merge command)
 	stats        Statistics
 	mu           sync.Mutex
 	currentIndex int
@@ -33,26 +68,85 @@ type Processor struct {
 
 // Statistics tracks processing statistics
 type Statistics struct {
-	Total         int
-	Success       int
-	Failed        int
-	EncodingFixed int
-	TagsUpdated   int
-	AutoAlbums    int
-	AutoTitles    int
+	Total          int
+	Success        int
+	Failed         int
+	EncodingFixed  int
+	TagsUpdated    int
+	Unchanged      int
+	AutoAlbums     int
+	AutoTitles     int
+	CoversEmbedded int
+
+	// validate command
+	StreamsOK       int
+	StreamsWarnings int // Files with warnings only
+	StreamsErrors   int // Files with at least one error
+
+	// repair command
+	StreamsRepaired int
+
+	// gain command
+	GainAlbums      int
+	GainWriteFailed int // Files analyzed but not tagged
+	GainAdjusted    int // Files whose global_gain was adjusted or restored
+
+	// silence and trim commands
+	SilentFiles int // Files with at least one silent region
+	Trimmed     int
+
+	// split command
+	FilesSplit   int
+	PartsWritten int
+
+	// merge command
+	DirsMerged      int
+	ChaptersWritten int
+
+	// lyrics and lyrics-export commands
+	LyricsImported int
+	LyricsExported int
+	LyricsSkipped  int // Files that already have lyrics or a .lrc file
+	NoLyrics       int // Files without a .lrc file or embedded lyrics
+
+	// chapters, chapters-edit and chapters-export commands
+	WithChapters     int
+	ChaptersFound    int
+	ChaptersUpdated  int
+	ChaptersExported int
+	ChaptersSkipped  int // Files that already have chapters or a chapter file
+	NoChapters       int
 }
 
 // New creates a new Processor with the given options
 func New(options ProcessOptions) *Processor {
+	pipeline := options.Pipeline
+	if pipeline == nil {
+		pipeline = DefaultPipeline()
+	}
+
+	var covers *cover.Cache
+	if options.Covers {
+		covers = cover.NewCache(options.CoverSize)
+	}
+
 	return &Processor{
-		options: options,
-		stats:   Statistics{},
+		options:  options,
+		pipeline: pipeline,
+		covers:   covers,
+		stats:    Statistics{},
 	}
 }
 
 // ProcessFiles processes a list of audio files
 func (p *Processor) ProcessFiles(files []scanner.AudioFile, command string, threads int) error {
 	p.stats.Total = len(files)
+	switch command {
+	case "gain":
+		p.initAlbums(files)
+	case "merge":
+		p.initMerges(files)
+	}
 
 	// Create worker pool
 	jobs := make(chan scanner.AudioFile, len(files))
@@ -82,13 +176,23 @@ func (p *Processor) ProcessFiles(files []scanner.AudioFile, command string, thre
 	wg.Wait()
 	close(results)
 
+	if command == "gain" {
+		// Album gains need every track of the directory
+		p.finishAlbums(threads)
+	}
+
 	// Collect results
 	for err := range results {
 		if err != nil {
 			p.mu.Lock()
 			p.stats.Failed++
 			p.mu.Unlock()
-			fmt.Printf("Error: %v\n", err)
+			if p.options.Format == FormatJSON {
+				// Keep stdout machine-readable
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			} else {
+				fmt.Printf("Error: %v\n", err)
+			}
 		} else {
 			p.mu.Lock()
 			p.stats.Success++
@@ -97,11 +201,49 @@ func (p *Processor) ProcessFiles(files []scanner.AudioFile, command string, thre
 	}
 
 	// Print statistics
-	p.printStatistics()
+	if p.options.Format != FormatJSON {
+		switch command {
+		case "validate":
+			p.printValidateStatistics()
+		case "repair":
+			p.printRepairStatistics()
+		case "gain":
+			p.printGainStatistics()
+		case "gain-undo":
+			p.printGainUndoStatistics()
+		case "silence":
+			p.printSilenceStatistics()
+		case "trim":
+			p.printTrimStatistics()
+		case "split":
+			p.printSplitStatistics()
+		case "merge":
+			p.printMergeStatistics()
+		case "lyrics":
+			p.printLyricsStatistics()
+		case "lyrics-export":
+			p.printLyricsExportStatistics()
+		case "chapters":
+			p.printChaptersStatistics()
+		case "chapters-edit":
+			p.printChaptersEditStatistics()
+		case "chapters-export":
+			p.printChaptersExportStatistics()
+		default:
+			p.printStatistics()
+		}
+	}
 
 	return nil
 }
 
+// Statistics returns the statistics of the last ProcessFiles run
+func (p *Processor) Statistics() Statistics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
 // processFile processes a single audio file
 func (p *Processor) processFile(file scanner.AudioFile, command string) error {
 	// Increment current index
@@ -112,14 +254,38 @@ func (p *Processor) processFile(file scanner.AudioFile, command string) error {
 	switch command {
 	case "scan":
 		return p.scanFile(file)
-	case "fix":
-		return p.fixFile(file)
-	case "tag":
-		return p.tagFile(file)
+	case "fix", "tag", "cue", "import", "set":
+		return p.applyFile(file)
 	case "test":
 		return p.testFile(file)
 	case "check":
 		return p.checkFile(file)
+	case "validate":
+		return p.validateFile(file)
+	case "repair":
+		return p.repairFile(file)
+	case "gain":
+		return p.gainFile(file)
+	case "gain-undo":
+		return p.undoGainFile(file)
+	case "silence":
+		return p.silenceFile(file)
+	case "trim":
+		return p.trimFile(file)
+	case "split":
+		return p.splitFile(file)
+	case "merge":
+		return p.mergeFile(file)
+	case "lyrics":
+		return p.lyricsFile(file)
+	case "lyrics-export":
+		return p.exportLyricsFile(file)
+	case "chapters":
+		return p.listChaptersFile(file)
+	case "chapters-edit":
+		return p.editChaptersFile(file)
+	case "chapters-export":
+		return p.exportChaptersFile(file)
 	default:
 		return fmt.Errorf("unknown command: %s", command)
 	}
@@ -149,6 +315,14 @@ func (p *Processor) scanFile(file scanner.AudioFile) error {
 	if meta.Genre != "" {
 		fmt.Printf("  Genre: %s\n", meta.Genre)
 	}
+	if err := meta.ReadAudio(file.Path); err != nil {
+		fmt.Printf("  Audio: %v\n", errors.Unwrap(err))
+	} else {
+		fmt.Printf("  Audio: %s\n", meta.Audio)
+		if meta.Audio.Encoder != "" {
+			fmt.Printf("  Encoder: %s\n", meta.Audio.Encoder)
+		}
+	}
 	fmt.Println()
 
 	return nil
@@ -171,421 +345,123 @@ func (p *Processor) checkFile(file scanner.AudioFile) error {
 
 // testFile simulates processing without modifying files
 func (p *Processor) testFile(file scanner.AudioFile) error {
-	meta, err := tagger.ReadTags(file.Path)
+	plan, err := p.planFile(file)
 	if err != nil {
-		return fmt.Errorf("failed to read tags from %s: %w", file.Path, err)
+		return err
 	}
+	p.countPlan(plan)
 
-	// Simulate processing
-	newMeta := p.processMetadata(meta, file)
-
-	// Display what would be changed
-	fmt.Printf("File: %s\n", file.RelPath)
-	fmt.Printf("  Current: Title=%q, Artist=%q, Album=%q\n", meta.Title, meta.Artist, meta.Album)
-	fmt.Printf("  New:     Title=%q, Artist=%q, Album=%q\n", newMeta.Title, newMeta.Artist, newMeta.Album)
-	fmt.Println()
+	// Display what would be changed, field by field with the rules that changed it
+	fmt.Print(formatDiff(plan.Diff(), p.options.Format))
 
 	return nil
 }
 
-// fixFile fixes encoding issues
-func (p *Processor) fixFile(file scanner.AudioFile) error {
-	meta, err := tagger.ReadTags(file.Path)
+// applyFile plans and writes the metadata changes of a file (fix and tag commands)
+func (p *Processor) applyFile(file scanner.AudioFile) error {
+	plan, err := p.planFile(file)
 	if err != nil {
-		return fmt.Errorf("failed to read tags from %s: %w", file.Path, err)
-	}
-
-	// Track changes for output
-	var changes []string
-	encodingFixed := 0
-	autoAlbum := false
-	autoTitle := false
-
-	// Process metadata and track changes
-	newMeta := &tagger.Metadata{
-		Title:  meta.Title,
-		Artist: meta.Artist,
-		Album:  meta.Album,
-		Year:   meta.Year,
-		Genre:  meta.Genre,
-		Track:  meta.Track,
-	}
-
-	// Step 1: Fix encoding first (priority)
-	if newMeta.Title != "" {
-		fixed, charset, changed := encoder.FixEncoding(newMeta.Title)
-		if changed {
-			changes = append(changes, fmt.Sprintf("Title: %s -> UTF-8", charset))
-			newMeta.Title = fixed
-			encodingFixed++
-		}
-		// Check if still garbled after encoding fix
-		if encoder.IsGarbled(newMeta.Title) {
-			changes = append(changes, "Title: still garbled after encoding fix")
-		}
-	}
-
-	if newMeta.Artist != "" {
-		fixed, charset, changed := encoder.FixEncoding(newMeta.Artist)
-		if changed {
-			changes = append(changes, fmt.Sprintf("Artist: %s -> UTF-8", charset))
-			newMeta.Artist = fixed
-			encodingFixed++
-		}
-		// Check if still garbled after encoding fix
-		if encoder.IsGarbled(newMeta.Artist) {
-			changes = append(changes, "Artist: still garbled after encoding fix")
-		}
-	}
-
-	if newMeta.Album != "" {
-		fixed, charset, changed := encoder.FixEncoding(newMeta.Album)
-		if changed {
-			changes = append(changes, fmt.Sprintf("Album: %s -> UTF-8", charset))
-			newMeta.Album = fixed
-			encodingFixed++
-		}
-		// Check if still garbled after encoding fix
-		if encoder.IsGarbled(newMeta.Album) {
-			changes = append(changes, "Album: still garbled after encoding fix")
-		}
+		return err
 	}
 
-	// Step 1.5: Clean up domains and file extensions
-	if newMeta.Title != "" {
-		cleaned := cleanTagText(newMeta.Title)
-		if cleaned != newMeta.Title {
-			newMeta.Title = cleaned
-			changes = append(changes, "Title cleaned (removed domains/extensions)")
-		}
-		// If cleaned title is empty (e.g., CD default title), treat as empty for fallback
-		if newMeta.Title == "" {
-			changes = append(changes, "Title is empty after cleaning, will use filename")
-		}
-	}
-	if newMeta.Artist != "" {
-		cleaned := cleanTagText(newMeta.Artist)
-		if cleaned != newMeta.Artist {
-			newMeta.Artist = cleaned
-			changes = append(changes, "Artist cleaned (removed domains/extensions)")
-		}
-	}
-	if newMeta.Album != "" {
-		cleaned := cleanTagText(newMeta.Album)
-		if cleaned != newMeta.Album {
-			newMeta.Album = cleaned
-			changes = append(changes, "Album cleaned (removed domains/extensions)")
-		}
-		// If cleaned album is empty (e.g., URL only), treat as empty for fallback
-		if newMeta.Album == "" {
-			changes = append(changes, "Album is empty after cleaning, will use directory")
-		}
-	}
-
-	// Step 2: Auto-format title with zero-padding
-	if newMeta.Title != "" {
-		formatted := formatTitle(newMeta.Title)
-		if formatted != newMeta.Title {
-			newMeta.Title = formatted
-			autoTitle = true
-			changes = append(changes, "Title zero-padded")
-		}
+	if err := p.applyPlan(plan); err != nil {
+		return err
 	}
+	p.countPlan(plan)
 
-	// Step 3: Fill from filename/directory if empty or garbled (fallback)
-	// Always use fallback if field is empty or garbled (even if UpdateEncoding is true)
-	fileName := convertPathToUTF8(filepath.Base(file.Path))
-	fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
-	dirName := convertPathToUTF8(filepath.Base(filepath.Dir(file.Path)))
-
-	// Fill Title: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillTitle := newMeta.Title == "" || encoder.IsGarbled(newMeta.Title) || (p.options.Force && p.options.ForceAll)
-	if shouldFillTitle && fileName != "" {
-		formattedTitle := formatTitleFromFilename(fileName)
-		newMeta.Title = formattedTitle
-		autoTitle = true
-		changes = append(changes, fmt.Sprintf("Title=%q (from filename, fallback)", formattedTitle))
-	}
-
-	// Fill Album: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillAlbum := newMeta.Album == "" || encoder.IsGarbled(newMeta.Album) || (p.options.Force && p.options.ForceAll)
-	if shouldFillAlbum && dirName != "" && dirName != "." {
-		newMeta.Album = dirName
-		autoAlbum = true
-		changes = append(changes, fmt.Sprintf("Album=%q (from directory, fallback)", dirName))
-	}
-
-	// Fill Artist: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillArtist := newMeta.Artist == "" || encoder.IsGarbled(newMeta.Artist) || (p.options.Force && p.options.ForceAll)
-	if shouldFillArtist && dirName != "" && dirName != "." {
-		// Extract artist from directory name (before underscore)
-		if strings.Contains(dirName, "_") {
-			parts := strings.SplitN(dirName, "_", 2)
-			if len(parts) >= 1 && parts[0] != "" {
-				newMeta.Artist = parts[0]
-				changes = append(changes, fmt.Sprintf("Artist=%q (from directory, fallback)", parts[0]))
-			}
-		} else {
-			newMeta.Artist = dirName
-			changes = append(changes, fmt.Sprintf("Artist=%q (from directory, fallback)", dirName))
-		}
-	}
-
-	// Determine output path
-	outPath := file.Path
-	if p.options.OutDir != "" {
-		outPath = filepath.Join(p.options.OutDir, file.RelPath)
+	// Print output
+	fileNameForDisplay := convertPathToUTF8(filepath.Base(file.Path))
+	if !plan.NeedsWrite() {
+		fmt.Printf("[%d/%d] Unchanged: %s\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay)
+		return nil
 	}
+	fmt.Printf("[%d/%d] Processing: %s → Title: %q, Artist: %q, Album: %q\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, plan.New.Title, plan.New.Artist, plan.New.Album)
 
-	// Write tags
-	data := &writer.TagData{
-		Title:  newMeta.Title,
-		Artist: newMeta.Artist,
-		Album:  newMeta.Album,
-		Year:   strconv.Itoa(newMeta.Year),
-		Genre:  newMeta.Genre,
-	}
+	return nil
+}
 
-	if outPath == file.Path {
-		// Update in place
-		if err := writer.WriteTagsToFile(outPath, data); err != nil {
-			return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
-		}
-	} else {
+// writeTags writes tags in place or to a new file, journaling the original tag for in-place updates
+func (p *Processor) writeTags(file scanner.AudioFile, outPath string, data *writer.TagData) error {
+	if outPath != file.Path {
 		// Write to new file
 		if err := writer.WriteTagsToNewFile(file.Path, outPath, data); err != nil {
 			return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
 		}
+		return nil
 	}
 
-	// Update statistics
-	p.mu.Lock()
-	p.stats.TagsUpdated++
-	p.stats.EncodingFixed += encodingFixed
-	if autoAlbum {
-		p.stats.AutoAlbums++
+	// Update in place, recording the original tag first so the run can be restored
+	if p.options.Journal != nil {
+		if err := p.options.Journal.Record(file.Path); err != nil {
+			return fmt.Errorf("failed to journal %s: %w", file.Path, err)
+		}
 	}
-	if autoTitle {
-		p.stats.AutoTitles++
+	if err := writer.WriteTagsToFile(outPath, data); err != nil {
+		return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
 	}
-	p.mu.Unlock()
-
-	// Print output
-	fileNameForDisplay := convertPathToUTF8(filepath.Base(file.Path))
-	fmt.Printf("[%d/%d] Processing: %s → Title: %q, Artist: %q, Album: %q\n",
-		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, newMeta.Title, newMeta.Artist, newMeta.Album)
-
 	return nil
 }
 
-// tagFile auto-fills missing metadata tags
-func (p *Processor) tagFile(file scanner.AudioFile) error {
-	meta, err := tagger.ReadTags(file.Path)
-	if err != nil {
-		return fmt.Errorf("failed to read tags from %s: %w", file.Path, err)
-	}
-
-	// Process metadata
-	newMeta := p.processMetadata(meta, file)
-
-	// Determine output path
-	outPath := file.Path
+// outPath returns where the processed copy of a file goes (the file itself for in-place updates)
+func (p *Processor) outPath(file scanner.AudioFile) string {
 	if p.options.OutDir != "" {
-		outPath = filepath.Join(p.options.OutDir, file.RelPath)
-	}
-
-	// Before writing, check if any field is garbled and fill from filename/directory if needed
-	fileNameForCheck := convertPathToUTF8(filepath.Base(file.Path))
-	fileNameForCheck = strings.TrimSuffix(fileNameForCheck, filepath.Ext(fileNameForCheck))
-	dirNameForCheck := convertPathToUTF8(filepath.Base(filepath.Dir(file.Path)))
-
-	// Check and fix Title before writing
-	if encoder.IsGarbled(newMeta.Title) && fileNameForCheck != "" {
-		formattedTitle := formatTitleFromFilename(fileNameForCheck)
-		newMeta.Title = formattedTitle
-		p.mu.Lock()
-		p.stats.AutoTitles++
-		p.mu.Unlock()
-	}
-
-	// Check and fix Album before writing
-	if encoder.IsGarbled(newMeta.Album) && dirNameForCheck != "" && dirNameForCheck != "." {
-		newMeta.Album = dirNameForCheck
-		p.mu.Lock()
-		p.stats.AutoAlbums++
-		p.mu.Unlock()
+		return filepath.Join(p.options.OutDir, file.RelPath)
 	}
+	return file.Path
+}
 
-	// Check and fix Artist before writing
-	if encoder.IsGarbled(newMeta.Artist) && dirNameForCheck != "" && dirNameForCheck != "." {
-		if strings.Contains(dirNameForCheck, "_") {
-			parts := strings.SplitN(dirNameForCheck, "_", 2)
-			if len(parts) >= 1 && parts[0] != "" {
-				newMeta.Artist = parts[0]
-			}
-		} else {
-			newMeta.Artist = dirNameForCheck
+// saveTags saves the frames of an opened tag like writeTags does: journaled in place,
+// or to a copy in the output directory
+func (p *Processor) saveTags(file scanner.AudioFile, w *writer.TagWriter) error {
+	outPath := p.outPath(file)
+	if outPath != file.Path {
+		if err := w.SaveTo(outPath); err != nil {
+			return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
 		}
+		return nil
 	}
 
-	// Write tags
-	data := &writer.TagData{
-		Title:  newMeta.Title,
-		Artist: newMeta.Artist,
-		Album:  newMeta.Album,
-		Year:   strconv.Itoa(newMeta.Year),
-		Genre:  newMeta.Genre,
-	}
-
-	if outPath == file.Path {
-		// Update in place
-		if err := writer.WriteTagsToFile(outPath, data); err != nil {
-			return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
-		}
-	} else {
-		// Write to new file
-		if err := writer.WriteTagsToNewFile(file.Path, outPath, data); err != nil {
-			return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
+	if p.options.Journal != nil {
+		if err := p.options.Journal.Record(file.Path); err != nil {
+			return fmt.Errorf("failed to journal %s: %w", file.Path, err)
 		}
 	}
-
-	p.mu.Lock()
-	p.stats.TagsUpdated++
-	p.mu.Unlock()
-
-	// Print output
-	fileNameForDisplay := convertPathToUTF8(filepath.Base(file.Path))
-	fmt.Printf("[%d/%d] Processing: %s → Title: %q, Artist: %q, Album: %q\n",
-		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, newMeta.Title, newMeta.Artist, newMeta.Album)
-
+	if err := w.Save(); err != nil {
+		return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
+	}
 	return nil
 }
 
-// processMetadata processes metadata according to options
-func (p *Processor) processMetadata(meta *tagger.Metadata, file scanner.AudioFile) *tagger.Metadata {
+// processMetadata runs the rule pipeline over a copy of the metadata.
+// Returns the new metadata and every field change in the order the rules applied them.
+// It has no side effects, so previews and writes always go through the same rules.
+func (p *Processor) processMetadata(meta *tagger.Metadata, file scanner.AudioFile) (*tagger.Metadata, []FieldChange) {
 	newMeta := &tagger.Metadata{
-		Title:  meta.Title,
-		Artist: meta.Artist,
-		Album:  meta.Album,
-		Year:   meta.Year,
-		Genre:  meta.Genre,
-		Track:  meta.Track,
-	}
-
-	// Step 1: Fix encoding first (priority)
-	if newMeta.Title != "" {
-		fixed, _, changed := encoder.FixEncoding(newMeta.Title)
-		if changed {
-			newMeta.Title = fixed
-			p.mu.Lock()
-			p.stats.EncodingFixed++
-			p.mu.Unlock()
-		}
+		Title:   meta.Title,
+		Artist:  meta.Artist,
+		Album:   meta.Album,
+		Year:    meta.Year,
+		Genre:   meta.Genre,
+		Track:   meta.Track,
+		Comment: meta.Comment,
+		Format:  meta.Format,
 	}
 
-	if newMeta.Artist != "" {
-		fixed, _, changed := encoder.FixEncoding(newMeta.Artist)
-		if changed {
-			newMeta.Artist = fixed
-			p.mu.Lock()
-			p.stats.EncodingFixed++
-			p.mu.Unlock()
-		}
-	}
-
-	if newMeta.Album != "" {
-		fixed, _, changed := encoder.FixEncoding(newMeta.Album)
-		if changed {
-			newMeta.Album = fixed
-			p.mu.Lock()
-			p.stats.EncodingFixed++
-			p.mu.Unlock()
-		}
-	}
-
-	// Step 1.5: Clean up domains and file extensions
-	if newMeta.Title != "" {
-		cleaned := cleanTagText(newMeta.Title)
-		if cleaned != newMeta.Title {
-			newMeta.Title = cleaned
-		}
-		// If cleaned title is empty (e.g., CD default title), treat as empty for fallback
-	}
-	if newMeta.Artist != "" {
-		cleaned := cleanTagText(newMeta.Artist)
-		if cleaned != newMeta.Artist {
-			newMeta.Artist = cleaned
-		}
-	}
-	if newMeta.Album != "" {
-		cleaned := cleanTagText(newMeta.Album)
-		if cleaned != newMeta.Album {
-			newMeta.Album = cleaned
-		}
-		// If cleaned album is empty (e.g., URL only), treat as empty for fallback
-	}
-
-	// Step 2: Auto-format title with zero-padding
-	if newMeta.Title != "" {
-		formatted := formatTitle(newMeta.Title)
-		if formatted != newMeta.Title {
-			newMeta.Title = formatted
-			p.mu.Lock()
-			p.stats.AutoTitles++
-			p.mu.Unlock()
-		}
-	}
-
-	// Step 3: Fill from filename/directory if empty or garbled (fallback)
-	// Always use fallback if field is empty or garbled (even if UpdateEncoding is true)
-	fileNameForFallback := convertPathToUTF8(filepath.Base(file.Path))
-	fileNameForFallback = strings.TrimSuffix(fileNameForFallback, filepath.Ext(fileNameForFallback))
-	dirNameForFallback := convertPathToUTF8(filepath.Base(filepath.Dir(file.Path)))
-
-	// Fill Title: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillTitle := newMeta.Title == "" || encoder.IsGarbled(newMeta.Title) || (p.options.Force && p.options.ForceAll)
-	if shouldFillTitle && fileNameForFallback != "" {
-		formattedTitle := formatTitleFromFilename(fileNameForFallback)
-		newMeta.Title = formattedTitle
-		p.mu.Lock()
-		p.stats.AutoTitles++
-		p.mu.Unlock()
-	}
-
-	// Fill Album: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillAlbum := newMeta.Album == "" || encoder.IsGarbled(newMeta.Album) || (p.options.Force && p.options.ForceAll)
-	if shouldFillAlbum && dirNameForFallback != "" && dirNameForFallback != "." {
-		newMeta.Album = dirNameForFallback
-		p.mu.Lock()
-		p.stats.AutoAlbums++
-		p.mu.Unlock()
-	}
-
-	// Fill Artist: empty or garbled (Force allows overwrite even if not garbled)
-	shouldFillArtist := newMeta.Artist == "" || encoder.IsGarbled(newMeta.Artist) || (p.options.Force && p.options.ForceAll)
-	if shouldFillArtist && dirNameForFallback != "" && dirNameForFallback != "." {
-		// Extract artist from directory name (before underscore)
-		if strings.Contains(dirNameForFallback, "_") {
-			parts := strings.SplitN(dirNameForFallback, "_", 2)
-			if len(parts) >= 1 && parts[0] != "" {
-				newMeta.Artist = parts[0]
-			}
-		} else {
-			newMeta.Artist = dirNameForFallback
-		}
-	}
-
-	// If UpdateEncoding is true and Force is false, only fix encoding, don't derive tags
-	// But we already did fallback above, so this is just for early return
-	if p.options.UpdateEncoding && !p.options.Force {
-		// Already processed fallback above, so just return
+	fileName := convertPathToUTF8(filepath.Base(file.Path))
+	ctx := &ruleContext{
+		fileName: strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		dirName:  convertPathToUTF8(filepath.Base(filepath.Dir(file.Path))),
+		// Force allows overwrite even if not garbled
+		overwrite: p.options.Force && p.options.ForceAll,
 	}
 
-	return newMeta
+	changes := p.pipeline.run(newMeta, ctx)
+	return newMeta, changes
 }
 
-// formatTitle formats title with zero-padding (e.g., "1 Title" -> "01 Title")
-func formatTitle(title string) string {
+// formatTitle formats title with zero-padding (e.g., "1 Title" -> "01 Title" for width 2)
+func formatTitle(title string, width int) string {
 	// Match pattern: "number space title"
 	re := regexp.MustCompile(`^(\d+)\s+(.+)$`)
 	matches := re.FindStringSubmatch(title)
@@ -594,9 +470,9 @@ func formatTitle(title string) string {
 		number := matches[1]
 		rest := matches[2]
 
-		// If number is single digit, pad with zero
-		if len(number) == 1 {
-			return "0" + number + " " + rest
+		// If number is shorter than width, pad with zeros
+		if len(number) < width {
+			return strings.Repeat("0", width-len(number)) + number + " " + rest
 		}
 	}
 
@@ -673,8 +549,10 @@ func (p *Processor) printStatistics() {
 	fmt.Printf("  Failed: %d\n", p.stats.Failed)
 	fmt.Printf("  Encoding fixed: %d\n", p.stats.EncodingFixed)
 	fmt.Printf("  Tags updated: %d\n", p.stats.TagsUpdated)
+	fmt.Printf("  Unchanged: %d\n", p.stats.Unchanged)
 	fmt.Printf("  Auto-derived albums: %d\n", p.stats.AutoAlbums)
 	fmt.Printf("  Auto-formatted titles: %d\n", p.stats.AutoTitles)
+	fmt.Printf("  Covers embedded: %d\n", p.stats.CoversEmbedded)
 	fmt.Println()
 }
 
@@ -690,63 +568,3 @@ func convertPathToUTF8(path string) string {
 	}
 	return utf8Path
 }
-
-// cleanTagText removes domains, file extensions, and other unwanted content from tag text
-func cleanTagText(text string) string {
-	if text == "" {
-		return text
-	}
-
-	cleaned := text
-
-	// Remove common CD default titles first
-	// Match patterns like "CD Digital Audio, Track#30", "CD Digital Audio Track 30", etc.
-	cdPattern := regexp.MustCompile(`(?i)^CD\s+Digital\s+Audio\s*,?\s*Track#?\s*\d+.*$`)
-	if cdPattern.MatchString(cleaned) {
-		return ""
-	}
-	// Also match variations like "CD Digital Audio, Track 30", "CDDA Track#30", "CD Track 30"
-	cdPattern2 := regexp.MustCompile(`(?i)^CD\s*(Digital\s+Audio|DA)\s*,?\s*Track#?\s*\d+.*$`)
-	if cdPattern2.MatchString(cleaned) {
-		return ""
-	}
-	// Match simple patterns like "CD Track 30", "Track 30", "Track#30" (if starts with these)
-	cdPattern3 := regexp.MustCompile(`(?i)^(CD\s*)?Track#?\s*\d+.*$`)
-	if cdPattern3.MatchString(cleaned) && len(cleaned) < 50 { // Only if short, to avoid false positives
-		return ""
-	}
-
-	// Remove URLs (http://, https://, www.)
-	urlPattern := regexp.MustCompile(`(?i)(https?://[^\s]+|www\.[^\s]+)`)
-	cleaned = urlPattern.ReplaceAllString(cleaned, "")
-
-	// Remove domain patterns in brackets like [bbs.bbxpp.cn], [www.example.com]
-	// Match [anything.domain] where domain is a common TLD
-	domainPattern := regexp.MustCompile(`\[[^\]]*\.(com|cn|net|org|edu|gov|io|co|uk|de|fr|jp|ru|au|ca|br|in|it|es|nl|se|no|dk|fi|pl|cz|hu|gr|pt|ie|at|ch|be|tr|kr|tw|hk|sg|my|th|vn|id|ph|nz|za|mx|ar|cl|pe|eg|sa|ae|il|pk|bd|lk|np|mm|kh|la|mn|kz|uz|az|ge|am|by|ua|md|ro|bg|rs|hr|si|sk|lt|lv|ee|is|mt|cy|lu|mc|ad|li|sm|va|me|ba|mk|al|xk)[^\]]*\]`)
-	cleaned = domainPattern.ReplaceAllString(cleaned, "")
-
-	// Remove file extensions (.MP3, .mp3, .WAV, .wav, etc.)
-	// Match .ext followed by space, end of string, or another dot
-	extPattern := regexp.MustCompile(`(?i)\.(mp3|wav|flac|m4a|aac|ogg|wma|ape|wv|tta|tak|ofr|ofs|off|rka|shn|aa3|gsm|3gp|amr|awb|au|snd|ra|rm|ram|dct|vox|sln)(\s|$|\.)`)
-	cleaned = extPattern.ReplaceAllString(cleaned, "")
-
-	// Remove trailing/leading separators and spaces
-	cleaned = strings.Trim(cleaned, " \t\n\r")
-
-	// Remove trailing dashes and separators (but keep content before them)
-	cleaned = strings.TrimRight(cleaned, "---")
-
-	// Remove multiple consecutive spaces
-	spacePattern := regexp.MustCompile(`\s+`)
-	cleaned = spacePattern.ReplaceAllString(cleaned, " ")
-
-	// Final trim
-	cleaned = strings.TrimSpace(cleaned)
-
-	// If result is empty or only contains separators, return empty
-	if cleaned == "" || cleaned == "---" || cleaned == "[]" {
-		return ""
-	}
-
-	return cleaned
-}
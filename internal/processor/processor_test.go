@@ -0,0 +1,948 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mp3tools/internal/catalog"
+	"mp3tools/internal/chapters"
+	"mp3tools/internal/cover"
+	"mp3tools/internal/journal"
+	"mp3tools/internal/lyrics"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// silentFrame is a 128 kbps 44.1 kHz MPEG-1 Layer III frame of silence
+var silentFrame = append([]byte{0xFF, 0xFB, 0x90, 0x64}, make([]byte, 413)...)
+
+// writeFixture writes an MP3 file with the given ID3v2 text frames (nil means no tag)
+func writeFixture(t *testing.T, path string, frames map[string]id3v2.TextFrame) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if frames != nil {
+		tag := id3v2.NewEmptyTag()
+		tag.SetVersion(3)
+		for id, frame := range frames {
+			tag.AddFrame(id, frame)
+		}
+		if _, err := tag.WriteTo(&buf); err != nil {
+			t.Fatalf("Failed to build tag: %v", err)
+		}
+	}
+	buf.Write(bytes.Repeat(silentFrame, 10))
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+}
+
+// writeFixtureTree creates a directory tree covering each processing step
+func writeFixtureTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	utf8 := func(text string) id3v2.TextFrame {
+		return id3v2.TextFrame{Encoding: id3v2.EncodingUTF16, Text: text}
+	}
+
+	// Empty tag: everything derived from path
+	writeFixture(t, filepath.Join(root, "单田芳_评书", "3.mp3"), nil)
+	// Title needs zero-padding, album is a URL
+	writeFixture(t, filepath.Join(root, "单田芳_评书", "1 白眉大侠.mp3"), map[string]id3v2.TextFrame{
+		"TIT2": utf8("1 白眉大侠"),
+		"TALB": utf8("www.example.com"),
+		"TPE1": utf8("单田芳"),
+	})
+	// Domain watermark and CD default title
+	writeFixture(t, filepath.Join(root, "专辑", "白眉大侠12.mp3"), map[string]id3v2.TextFrame{
+		"TIT2": utf8("CD Digital Audio, Track#12"),
+		"TALB": utf8("白眉大侠[bbs.example.cn]"),
+		"TCON": utf8("Other"),
+	})
+	// Already clean: should be unchanged
+	writeFixture(t, filepath.Join(root, "专辑", "05.mp3"), map[string]id3v2.TextFrame{
+		"TIT2": utf8("05 第五回"),
+		"TALB": utf8("评书"),
+		"TPE1": utf8("单田芳"),
+	})
+
+	return root
+}
+
+func TestPreviewMatchesApply(t *testing.T) {
+	tests := []struct {
+		name            string
+		force, forceAll bool
+	}{
+		{"default", false, false},
+		{"-f -a", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFixtureTree(t)
+			files, err := scanner.ScanDirectory(root)
+			if err != nil {
+				t.Fatalf("Failed to scan fixture tree: %v", err)
+			}
+
+			// Rules on track and comment, and one that empties a field, so every written field is compared
+			config := DefaultPipelineConfig()
+			config.Rules = append(config.Rules,
+				RuleConfig{Type: RuleTypeSetConstant, Fields: []string{"track"}, Value: "7", When: WhenEmpty},
+				RuleConfig{Type: RuleTypeSetConstant, Fields: []string{"comment"}, Value: "整理: 评书", When: WhenEmpty},
+				RuleConfig{Type: RuleTypeRegexReplace, Fields: []string{"genre"}, Pattern: `^Other$`},
+			)
+			pipeline, err := CompilePipeline(config)
+			if err != nil {
+				t.Fatalf("Failed to compile pipeline: %v", err)
+			}
+
+			// test and fix get the same flags from the CLI
+			options := ProcessOptions{Threads: 1, Pipeline: pipeline, Force: tt.force, ForceAll: tt.forceAll}
+			preview := New(options)
+			plans := make(map[string]*Plan)
+			for _, file := range files {
+				plan, err := preview.planFile(file)
+				if err != nil {
+					t.Fatalf("Failed to plan %s: %v", file.RelPath, err)
+				}
+				plans[file.RelPath] = plan
+			}
+
+			// Run test and fix through the full pipeline and compare statistics
+			if err := preview.ProcessFiles(files, "test", 1); err != nil {
+				t.Fatalf("Failed to preview: %v", err)
+			}
+			apply := New(options)
+			if err := apply.ProcessFiles(files, "fix", 1); err != nil {
+				t.Fatalf("Failed to apply: %v", err)
+			}
+			if preview.stats != apply.stats {
+				t.Errorf("Expected preview statistics %+v to match apply statistics %+v", preview.stats, apply.stats)
+			}
+
+			// Tags written must match the previewed plan
+			for _, file := range files {
+				want := plans[file.RelPath].New
+				got, err := tagger.ReadTags(file.Path)
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", file.RelPath, err)
+				}
+				if got.Title != want.Title || got.Artist != want.Artist || got.Album != want.Album ||
+					got.Year != want.Year || got.Genre != want.Genre || got.Track != want.Track || got.Comment != want.Comment {
+					t.Errorf("%s: expected %+v, got %+v", file.RelPath, want, got)
+				}
+				if want.Track != 7 || want.Comment != "整理: 评书" || want.Genre != "" {
+					t.Errorf("%s: expected the plan to set track and comment and clear genre, got %+v", file.RelPath, want)
+				}
+			}
+
+			// -f -a overwrites clean tags from the path, so the clean file is planned differently
+			clean := plans[filepath.Join("专辑", "05.mp3")]
+			if overwritten := clean.Old.Album != clean.New.Album; overwritten != (tt.force && tt.forceAll) {
+				t.Errorf("Expected album %q overwritten = %v, got %q", clean.Old.Album, tt.force && tt.forceAll, clean.New.Album)
+			}
+
+			// Applying again must be a no-op
+			for _, file := range files {
+				plan, err := apply.planFile(file)
+				if err != nil {
+					t.Fatalf("Failed to plan %s: %v", file.RelPath, err)
+				}
+				if !plan.Unchanged() {
+					t.Errorf("%s: expected no changes after apply, got %+v", file.RelPath, plan.Diff().Changes)
+				}
+			}
+		})
+	}
+}
+
+func TestRerunSkipsWrite(t *testing.T) {
+	root := writeFixtureTree(t)
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixture tree: %v", err)
+	}
+	stateDir := t.TempDir()
+
+	run := func() (*journal.Journal, Statistics) {
+		t.Helper()
+		jrnl, err := journal.Create(stateDir)
+		if err != nil {
+			t.Fatalf("Failed to create journal: %v", err)
+		}
+		proc := New(ProcessOptions{Threads: 1, Journal: jrnl})
+		if err := proc.ProcessFiles(files, "fix", 1); err != nil {
+			t.Fatalf("Failed to apply: %v", err)
+		}
+		if err := jrnl.Close(); err != nil {
+			t.Fatalf("Failed to close journal: %v", err)
+		}
+		return jrnl, proc.Statistics()
+	}
+
+	first, stats := run()
+	if entries, err := journal.Load(stateDir, first.RunID); err != nil || len(entries) == 0 {
+		t.Fatalf("Expected the first run to journal its writes, got %d entries (%v)", len(entries), err)
+	}
+	if stats.TagsUpdated == 0 {
+		t.Fatalf("Expected the first run to update tags, got %+v", stats)
+	}
+
+	// Age the files so a rewrite would show up as a new modification time
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, file := range files {
+		if err := os.Chtimes(file.Path, past, past); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+
+	second, stats := run()
+	if stats.Unchanged != len(files) || stats.TagsUpdated != 0 {
+		t.Errorf("Expected every file unchanged on rerun, got %+v", stats)
+	}
+	if entries, err := journal.Load(stateDir, second.RunID); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no journal entries on rerun, got %d (%v)", len(entries), err)
+	}
+	for _, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", file.RelPath, err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("%s: expected mtime %v to be kept, got %v", file.RelPath, past, info.ModTime())
+		}
+	}
+}
+
+func TestPlanRules(t *testing.T) {
+	root := writeFixtureTree(t)
+	p := New(ProcessOptions{Threads: 1})
+
+	file := scanner.AudioFile{
+		Path:    filepath.Join(root, "单田芳_评书", "1 白眉大侠.mp3"),
+		RelPath: filepath.Join("单田芳_评书", "1 白眉大侠.mp3"),
+	}
+	plan, err := p.planFile(file)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+
+	diff := plan.Diff()
+	rules := make(map[string][]string)
+	for _, change := range diff.Changes {
+		rules[change.Field] = change.Rules
+	}
+
+	if plan.New.Title != "01 白眉大侠" || len(rules["title"]) != 1 || rules["title"][0] != RuleZeroPad {
+		t.Errorf("Expected zero-padded title, got %q %v", plan.New.Title, rules["title"])
+	}
+	if plan.New.Album != "单田芳_评书" || len(rules["album"]) != 2 || rules["album"][0] != "cleanup: url" {
+		t.Errorf("Expected album from dir after cleanup, got %q %v", plan.New.Album, rules["album"])
+	}
+	if _, ok := rules["artist"]; ok {
+		t.Errorf("Expected artist unchanged, got %v", rules["artist"])
+	}
+}
+
+func TestCustomPipeline(t *testing.T) {
+	config := PipelineConfig{Rules: []RuleConfig{
+		{Type: RuleTypeNormalize, Fields: []string{"title"}},
+		{Name: "strip-recommend", Type: RuleTypeRegexReplace, Fields: []string{"title"}, Pattern: `-推荐收听$`},
+		{Type: RuleTypePad, Fields: []string{"title"}, Width: 3},
+		{Type: RuleTypeSetConstant, Fields: []string{"genre"}, Value: "评书", When: WhenEmpty},
+		{Type: RuleTypeSetConstant, Fields: []string{"artist"}, Value: "单田芳", Match: `^Unknown`},
+	}}
+	pipeline, err := CompilePipeline(config)
+	if err != nil {
+		t.Fatalf("Failed to compile pipeline: %v", err)
+	}
+
+	meta := &tagger.Metadata{Title: "７　白眉大侠-推荐收听", Artist: "Unknown Artist", Genre: ""}
+	changes := pipeline.run(meta, &ruleContext{})
+
+	if meta.Title != "007 白眉大侠" {
+		t.Errorf("Expected title %q, got %q", "007 白眉大侠", meta.Title)
+	}
+	if meta.Genre != "评书" {
+		t.Errorf("Expected genre %q, got %q", "评书", meta.Genre)
+	}
+	if meta.Artist != "单田芳" {
+		t.Errorf("Expected artist %q, got %q", "单田芳", meta.Artist)
+	}
+
+	var names []string
+	for _, change := range changes {
+		names = append(names, change.Rule)
+	}
+	want := []string{RuleTypeNormalize, "strip-recommend", RuleZeroPad, RuleTypeSetConstant, RuleTypeSetConstant}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected rules %v, got %v", want, names)
+	}
+}
+
+func TestPipelineConfigErrors(t *testing.T) {
+	tests := []RuleConfig{
+		{Type: "unknown"},
+		{Type: RuleTypeRegexReplace, Pattern: "("},
+		{Type: RuleTypeDeriveFromPath, Source: "parent"},
+		{Type: RuleTypeClean, Fields: []string{"lyrics"}},
+		{Type: RuleTypeClean, When: "sometimes"},
+	}
+	for _, rc := range tests {
+		if _, err := CompilePipeline(PipelineConfig{Rules: []RuleConfig{rc}}); err == nil {
+			t.Errorf("Expected error for rule %+v", rc)
+		}
+	}
+}
+
+func TestExamplePipelineConfig(t *testing.T) {
+	config, err := LoadPipelineConfig(filepath.Join("..", "..", "docs", "rules.example.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load example config: %v", err)
+	}
+	if _, err := CompilePipeline(config); err != nil {
+		t.Fatalf("Failed to compile example config: %v", err)
+	}
+}
+
+func TestDefaultCleanupSet(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"CD Digital Audio, Track#30", ""},
+		{"Track 12", ""},
+		{"白眉大侠 www.example.com", "白眉大侠"},
+		{"白眉大侠[bbs.bbxpp.cn] 第一回", "白眉大侠 第一回"},
+		{"第一回.mp3", "第一回"},
+		{"白眉大侠 ---", "白眉大侠"},
+		{"Track 12 of a very long title that should not be treated as a CD default", "Track 12 of a very long title that should not be treated as a CD default"},
+		// max_length counts bytes: 49 bytes is still a default title, 50 bytes (24 characters) is a real one
+		{"Track 12 白眉大侠第十二回徐良出世血!", ""},
+		{"Track 12 白眉大侠第十二回徐良出世血!!", "Track 12 白眉大侠第十二回徐良出世血!!"},
+	}
+
+	set := DefaultCleanupSet()
+	for _, tt := range tests {
+		if got, _ := set.Clean("title", tt.input); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCleanupSet(t *testing.T) {
+	set, err := LoadCleanupSet(filepath.Join("..", "..", "docs", "cleanup.example.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to load example cleanup file: %v", err)
+	}
+
+	got, applied := set.Clean("title", "【某某有声】白眉大侠(www.xxx.com整理)-推荐收听")
+	if got != "白眉大侠" {
+		t.Errorf("Expected %q, got %q (rules %v)", "白眉大侠", got, applied)
+	}
+	// Field targeting: the suffix rule only applies to title and album
+	if got, _ := set.Clean("artist", "单田芳-推荐收听"); got != "单田芳-推荐收听" {
+		t.Errorf("Expected artist untouched, got %q", got)
+	}
+
+	// A failing example rejects the file
+	badFile := filepath.Join(t.TempDir(), "cleanup.yaml")
+	bad := "rules:\n  - name: bad\n    pattern: 'x'\n    examples:\n      - input: 'axb'\n        output: 'axb'\n"
+	if err := os.WriteFile(badFile, []byte(bad), 0644); err != nil {
+		t.Fatalf("Failed to write cleanup file: %v", err)
+	}
+	if _, err := LoadCleanupSet(badFile); err == nil {
+		t.Error("Expected error for failing example")
+	}
+}
+
+func TestGainSteps(t *testing.T) {
+	for _, tc := range []struct {
+		gain, peak float64
+		steps      int
+	}{
+		{-10.51, 1.02, -7},
+		{4.4, 0.5, 3},
+		{4.4, 0.8, 1}, // Lowered to keep the peak below 0 dBTP
+		{3, 1.1, 0},
+	} {
+		if steps := gainSteps(tc.gain, tc.peak); steps != tc.steps {
+			t.Errorf("gainSteps(%.2f, %.2f): expected %d, got %d", tc.gain, tc.peak, tc.steps, steps)
+		}
+	}
+
+	if undo := formatUndo(-7); undo != "-007,-007,N" || parseUndo(undo) != -7 {
+		t.Errorf("Expected mp3gain undo format, got %q", undo)
+	}
+	if parseUndo("") != 0 || formatUndo(0) != "" {
+		t.Error("Expected no undo value for zero steps")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for text, expected := range map[string]time.Duration{
+		"1:02:03.5": time.Hour + 2*time.Minute + 3500*time.Millisecond,
+		"62:03":     62*time.Minute + 3*time.Second,
+		"3723":      3723 * time.Second,
+		"1h2m3s":    time.Hour + 2*time.Minute + 3*time.Second,
+	} {
+		if d, err := ParseTimestamp(text); err != nil || d != expected {
+			t.Errorf("ParseTimestamp(%q): expected %v, got %v (%v)", text, expected, d, err)
+		}
+	}
+	for _, text := range []string{"", "1:2:3:4", "1.5:00", "-3", "abc"} {
+		if _, err := ParseTimestamp(text); err == nil {
+			t.Errorf("ParseTimestamp(%q): expected an error", text)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	names := []string{"第10回.mp3", "第2回.mp3", "第1回.mp3", "intro.mp3", "第02回b.mp3"}
+	sort.Slice(names, func(i, j int) bool { return naturalLess(names[i], names[j]) })
+	expected := []string{"intro.mp3", "第1回.mp3", "第2回.mp3", "第02回b.mp3", "第10回.mp3"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+}
+
+func TestImportClearsFields(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "01.mp3")
+	writeFixture(t, path, map[string]id3v2.TextFrame{
+		"TIT2": {Encoding: id3v2.EncodingUTF8, Text: "第一回"},
+		"TPE1": {Encoding: id3v2.EncodingUTF8, Text: "Unknown"},
+		"TYER": {Encoding: id3v2.EncodingUTF8, Text: "2001"},
+	})
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+
+	row := &catalog.Row{Line: 1, Values: map[string]string{"path": "01.mp3", "artist": "", "album": "白眉大侠", "year": ""}}
+	options := ProcessOptions{Threads: 1, Import: map[string]ImportEntry{path: {Row: row, By: catalog.ByPath}}}
+	plan, err := New(options).planFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if diff := plan.Diff(); len(diff.Changes) != 3 || diff.Changes[0].Rules[0] != "import row 1 (by path)" {
+		t.Errorf("Expected artist, album and year changes from row 1, got %+v", diff.Changes)
+	}
+
+	if err := New(options).ProcessFiles(files, "import", 1); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	got, err := tagger.ReadTags(path)
+	if err != nil {
+		t.Fatalf("Failed to read tags: %v", err)
+	}
+	if got.Title != "第一回" || got.Artist != "" || got.Album != "白眉大侠" || got.Year != 0 {
+		t.Errorf("Expected the planned tags with artist and year cleared, got %+v", got)
+	}
+}
+
+func TestParseReplacement(t *testing.T) {
+	r, err := ParseReplacement(`title:s/第(\d+)回/$1/`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if got := r.Pattern.ReplaceAllString("第12回 出世", r.Replace); r.Field != "title" || got != "12 出世" {
+		t.Errorf("Expected title replacement giving %q, got %s %q", "12 出世", r.Field, got)
+	}
+
+	r, err = ParseReplacement(`artist:s|a/b|x|i`)
+	if err != nil {
+		t.Fatalf("Failed to parse custom delimiter: %v", err)
+	}
+	if got := r.Pattern.ReplaceAllString("A/B", r.Replace); got != "x" {
+		t.Errorf("Expected case-insensitive match with | delimiter, got %q", got)
+	}
+
+	for _, spec := range []string{"title", "size:s/a/b/", "title:s/a/b", "title:s/a/b/x", "title:s/(/b/"} {
+		if _, err := ParseReplacement(spec); err == nil {
+			t.Errorf("Expected %q to fail", spec)
+		}
+	}
+}
+
+func TestSetFields(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "01.mp3")
+	writeFixture(t, path, map[string]id3v2.TextFrame{
+		"TIT2": {Encoding: id3v2.EncodingUTF8, Text: "第3回 出世"},
+		"TPE1": {Encoding: id3v2.EncodingUTF8, Text: "Unknown"},
+		"TYER": {Encoding: id3v2.EncodingUTF8, Text: "2001"},
+	})
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+
+	replace, err := ParseReplacement(`title:s/第(\d+)回/$1/`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	spec := &SetSpec{
+		Values:   map[string]string{"artist": "单田芳", "album": "白眉大侠"},
+		Clear:    []string{"year"},
+		Replaces: []Replacement{replace},
+	}
+	if err := spec.Validate(); err != nil {
+		t.Fatalf("Expected a valid spec, got %v", err)
+	}
+	options := ProcessOptions{Threads: 1, Set: spec}
+	if err := New(options).ProcessFiles(files, "set", 1); err != nil {
+		t.Fatalf("Failed to set: %v", err)
+	}
+	got, err := tagger.ReadTags(path)
+	if err != nil {
+		t.Fatalf("Failed to read tags: %v", err)
+	}
+	if got.Title != "3 出世" || got.Artist != "单田芳" || got.Album != "白眉大侠" || got.Year != 0 {
+		t.Errorf("Expected set, cleared and replaced fields, got %+v", got)
+	}
+
+	for _, invalid := range []*SetSpec{
+		{Values: map[string]string{"year": "soon"}},
+		{Values: map[string]string{"title": "x"}, Clear: []string{"title"}},
+		{Clear: []string{"size"}},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	plan := &Plan{
+		File: scanner.AudioFile{RelPath: "白眉大侠/01.mp3"},
+		Old:  &tagger.Metadata{Title: "1 白眉大侠", Album: "www.example.com", HasPicture: true},
+		New:  &tagger.Metadata{Title: "01 白眉大侠", Artist: "单田芳"},
+		Changes: []FieldChange{
+			{Field: "title", Old: "1 白眉大侠", New: "01 白眉大侠", Rule: RuleZeroPad},
+			{Field: "artist", Old: "", New: "单田芳", Rule: RuleFallbackDir},
+			{Field: "album", Old: "www.example.com", New: "", Rule: RuleCleanup},
+		},
+		Cover: &cover.Image{Source: "/music/白眉大侠/cover.jpg", Data: make([]byte, 2000), MimeType: "image/jpeg", Width: 800, Height: 800, Resized: true},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatText, `File: 白眉大侠/01.mp3
+  Title: "1 白眉大侠" → "01 白眉大侠" [zero-pad]
+  Artist: "" → "单田芳" [fallback from dir]
+  Album: "www.example.com" → "" [cleanup]
+  Cover: "(embedded)" → "cover.jpg 800x800 (2 KB) resized" [embed cover]
+
+`},
+		{FormatUnified, `--- a/白眉大侠/01.mp3
++++ b/白眉大侠/01.mp3
+@@ Title @@ zero-pad
+-Title: 1 白眉大侠
++Title: 01 白眉大侠
+@@ Artist @@ fallback from dir
++Artist: 单田芳
+@@ Album @@ cleanup
+-Album: www.example.com
+@@ Cover @@ embed cover
+-Cover: (embedded)
++Cover: cover.jpg 800x800 (2 KB) resized
+`},
+		{FormatJSON, `{"path":"白眉大侠/01.mp3","changes":[` +
+			`{"field":"title","old":"1 白眉大侠","new":"01 白眉大侠","rules":["zero-pad"]},` +
+			`{"field":"artist","old":"","new":"单田芳","rules":["fallback from dir"]},` +
+			`{"field":"album","old":"www.example.com","new":"","rules":["cleanup"]},` +
+			`{"field":"cover","old":"(embedded)","new":"cover.jpg 800x800 (2 KB) resized","rules":["embed cover"]}]}
+`},
+	}
+	for _, tt := range tests {
+		if got := formatDiff(plan.Diff(), tt.format); got != tt.want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.format, tt.want, got)
+		}
+	}
+
+	// Unchanged files
+	unchanged := FileDiff{Path: "05.mp3", Changes: []FieldDiff{}}
+	for format, want := range map[string]string{
+		FormatText:    "File: 05.mp3\n  (no changes)\n\n",
+		FormatUnified: "",
+		FormatJSON:    `{"path":"05.mp3","changes":[]}` + "\n",
+	} {
+		if got := formatDiff(unchanged, format); got != want {
+			t.Errorf("%s without changes: expected %q, got %q", format, want, got)
+		}
+	}
+}
+
+// coverPNG returns a small PNG cover image
+func coverPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode cover: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplaceCoversRerun(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "01.mp3")
+	writeFixture(t, path, map[string]id3v2.TextFrame{
+		"TIT2": {Encoding: id3v2.EncodingUTF8, Text: "01 第一回"},
+		"TALB": {Encoding: id3v2.EncodingUTF8, Text: "白眉大侠"},
+		"TPE1": {Encoding: id3v2.EncodingUTF8, Text: "单田芳"},
+	})
+	if err := os.WriteFile(filepath.Join(root, "cover.png"), coverPNG(t), 0644); err != nil {
+		t.Fatalf("Failed to write cover: %v", err)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+
+	options := ProcessOptions{Threads: 1, Covers: true, CoverSize: 800, ReplaceCovers: true}
+	if err := New(options).ProcessFiles(files, "tag", 1); err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+
+	// The same cover is already embedded, so the rerun has nothing to write
+	plan, err := New(options).planFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if plan.Cover != nil || !plan.Unchanged() {
+		t.Errorf("Expected no cover change on rerun, got %+v", plan.Diff().Changes)
+	}
+}
+
+func TestLyrics(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, filepath.Join(root, "01 第一回.mp3"), nil)
+	writeFixture(t, filepath.Join(root, "02 第二回.mp3"), nil)
+	lrc := "[00:01.00]话说大宋年间\n[00:03.50]白眉大侠徐良出世\n"
+	if err := os.WriteFile(filepath.Join(root, "01 第一回.lrc"), []byte(lrc), 0644); err != nil {
+		t.Fatalf("Failed to write .lrc: %v", err)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixtures: %v", err)
+	}
+
+	// Writing to an output directory leaves the originals alone
+	outDir := t.TempDir()
+	proc := New(ProcessOptions{OutDir: outDir, Threads: 2, SyncedLyrics: true})
+	if err := proc.ProcessFiles(files, "lyrics", 2); err != nil {
+		t.Fatalf("Failed to embed lyrics: %v", err)
+	}
+	if stats := proc.Statistics(); stats.LyricsImported != 1 || stats.NoLyrics != 1 || stats.Failed != 0 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+	if _, err := lyrics.ReadEmbedded(files[0].Path); !errors.Is(err, lyrics.ErrNoLyrics) {
+		t.Errorf("Expected the original to stay without lyrics, got %v", err)
+	}
+	copied, err := lyrics.ReadEmbedded(filepath.Join(outDir, files[0].RelPath))
+	if err != nil || !copied.Synced || len(copied.Lines) != 2 {
+		t.Fatalf("Expected synced lyrics in the output copy, got %+v (%v)", copied, err)
+	}
+
+	// In place, the original tag is journaled so restore can undo it
+	stateDir := t.TempDir()
+	jrnl, err := journal.Create(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	proc = New(ProcessOptions{Threads: 2, Journal: jrnl})
+	if err := proc.ProcessFiles(files, "lyrics", 2); err != nil {
+		t.Fatalf("Failed to embed lyrics: %v", err)
+	}
+	if err := jrnl.Close(); err != nil {
+		t.Fatalf("Failed to close journal: %v", err)
+	}
+	if entries, err := journal.Load(stateDir, jrnl.RunID); err != nil || len(entries) != 1 {
+		t.Errorf("Expected one journal entry, got %d (%v)", len(entries), err)
+	}
+	if embedded, err := lyrics.ReadEmbedded(files[0].Path); err != nil || embedded.Lines[1].Text != "白眉大侠徐良出世" {
+		t.Fatalf("Expected lyrics embedded in place, got %+v (%v)", embedded, err)
+	}
+
+	// A rerun skips files that already have lyrics
+	proc = New(ProcessOptions{Threads: 2})
+	if err := proc.ProcessFiles(files, "lyrics", 2); err != nil {
+		t.Fatalf("Failed to rerun: %v", err)
+	}
+	if stats := proc.Statistics(); stats.LyricsSkipped != 1 || stats.LyricsImported != 0 {
+		t.Errorf("Expected the rerun to skip, got %+v", stats)
+	}
+
+	// Export writes the .lrc next to the copy in the output directory
+	exportDir := t.TempDir()
+	proc = New(ProcessOptions{OutDir: exportDir, Threads: 2})
+	if err := proc.ProcessFiles(files, "lyrics-export", 2); err != nil {
+		t.Fatalf("Failed to export lyrics: %v", err)
+	}
+	if stats := proc.Statistics(); stats.LyricsExported != 1 || stats.NoLyrics != 1 {
+		t.Errorf("Unexpected export statistics: %+v", stats)
+	}
+	exported, _, err := lyrics.LoadFile(lyrics.SidecarPath(filepath.Join(exportDir, files[0].RelPath)))
+	if err != nil || len(exported.Lines) != 2 {
+		t.Errorf("Expected the exported .lrc in the output directory, got %+v (%v)", exported, err)
+	}
+}
+
+func TestChapters(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, filepath.Join(root, "01 第一回.mp3"), nil)
+	writeFixture(t, filepath.Join(root, "02 第二回.mp3"), nil)
+	list := "00:00.000 话说大宋年间\n00:00.100 徐良出世\n"
+	if err := os.WriteFile(filepath.Join(root, "01 第一回.chapters.txt"), []byte(list), 0644); err != nil {
+		t.Fatalf("Failed to write chapter list: %v", err)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixtures: %v", err)
+	}
+
+	// In place, the original tag is journaled so restore can undo the import
+	stateDir := t.TempDir()
+	jrnl, err := journal.Create(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %v", err)
+	}
+	proc := New(ProcessOptions{Threads: 2, Journal: jrnl, ImportChapters: true})
+	if err := proc.ProcessFiles(files, "chapters-edit", 2); err != nil {
+		t.Fatalf("Failed to import chapters: %v", err)
+	}
+	if err := jrnl.Close(); err != nil {
+		t.Fatalf("Failed to close journal: %v", err)
+	}
+	if stats := proc.Statistics(); stats.ChaptersUpdated != 1 || stats.NoChapters != 1 || stats.Failed != 0 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+	if entries, err := journal.Load(stateDir, jrnl.RunID); err != nil || len(entries) != 1 {
+		t.Errorf("Expected one journal entry, got %d (%v)", len(entries), err)
+	}
+	embedded, err := chapters.ReadEmbedded(files[0].Path)
+	if err != nil || len(embedded) != 2 || embedded[1].Title != "徐良出世" {
+		t.Fatalf("Expected imported chapters, got %+v (%v)", embedded, err)
+	}
+
+	// Importing again skips files that already have chapters
+	proc = New(ProcessOptions{Threads: 2, ImportChapters: true})
+	if err := proc.ProcessFiles(files, "chapters-edit", 2); err != nil {
+		t.Fatalf("Failed to rerun: %v", err)
+	}
+	if stats := proc.Statistics(); stats.ChaptersSkipped != 1 || stats.ChaptersUpdated != 0 {
+		t.Errorf("Expected the rerun to skip, got %+v", stats)
+	}
+
+	// Edits to an output directory leave the originals alone
+	outDir := t.TempDir()
+	proc = New(ProcessOptions{
+		OutDir:         outDir,
+		Threads:        2,
+		ChapterRenames: map[int]string{2: "第二节"},
+		ChapterShift:   50 * time.Millisecond,
+	})
+	if err := proc.ProcessFiles(files, "chapters-edit", 2); err != nil {
+		t.Fatalf("Failed to edit chapters: %v", err)
+	}
+	copied, err := chapters.ReadEmbedded(filepath.Join(outDir, files[0].RelPath))
+	if err != nil || len(copied) != 2 || copied[1].Title != "第二节" || copied[1].Start != 150*time.Millisecond {
+		t.Errorf("Expected renamed and shifted chapters in the copy, got %+v (%v)", copied, err)
+	}
+	if original, _ := chapters.ReadEmbedded(files[0].Path); original[1].Title != "徐良出世" {
+		t.Errorf("Expected the original untouched, got %+v", original)
+	}
+
+	// Export writes the chapter file next to the copy in the output directory
+	exportDir := t.TempDir()
+	proc = New(ProcessOptions{OutDir: exportDir, Threads: 2, ExportChapters: chapters.FormatMP4Chaps})
+	if err := proc.ProcessFiles(files, "chapters-export", 2); err != nil {
+		t.Fatalf("Failed to export chapters: %v", err)
+	}
+	if stats := proc.Statistics(); stats.ChaptersExported != 1 || stats.NoChapters != 1 {
+		t.Errorf("Unexpected export statistics: %+v", stats)
+	}
+	target := chapters.SidecarPath(filepath.Join(exportDir, files[0].RelPath), chapters.FormatMP4Chaps)
+	if text, err := os.ReadFile(target); err != nil || !strings.Contains(string(text), "00:00:00.100 徐良出世") {
+		t.Errorf("Expected the exported chapters in the output directory, got %q (%v)", text, err)
+	}
+}
+
+func TestSplitTitleTemplate(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, filepath.Join(root, "书.mp3"), map[string]id3v2.TextFrame{
+		"TIT2": {Encoding: id3v2.EncodingUTF8, Text: "白眉大侠"},
+	})
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixture: %v", err)
+	}
+
+	outDir := t.TempDir()
+	proc := New(ProcessOptions{
+		OutDir:     outDir,
+		Threads:    1,
+		SplitMode:  SplitAt,
+		SplitAt:    []time.Duration{130 * time.Millisecond},
+		SplitTitle: "{title} {n}/{total} {start}+{duration} {bitrate}k",
+	})
+	if err := proc.ProcessFiles(files, "split", 1); err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	if stats := proc.Statistics(); stats.PartsWritten != 2 {
+		t.Fatalf("Expected 2 parts, got %+v", stats)
+	}
+
+	// 10 frames of 26.122 ms, cut after 5
+	want := []string{"白眉大侠 01/2 0:00.000+0:00.130 128k", "白眉大侠 02/2 0:00.130+0:00.130 128k"}
+	for _, title := range want {
+		meta, err := tagger.ReadTags(filepath.Join(outDir, "书", safeFileName(title)+".mp3"))
+		if err != nil {
+			t.Fatalf("Failed to read part %q: %v", title, err)
+		}
+		if meta.Title != title {
+			t.Errorf("Part title = %q, want %q", meta.Title, title)
+		}
+	}
+}
+
+func TestGainAlbumsConcurrent(t *testing.T) {
+	root := t.TempDir()
+	for _, album := range []string{"白眉大侠", "三侠五义", "七侠五义"} {
+		for n := 1; n <= 4; n++ {
+			writeFixture(t, filepath.Join(root, album, strconv.Itoa(n)+".mp3"), nil)
+		}
+	}
+	// A file that fails to analyze doesn't keep its album from being tagged
+	if err := os.WriteFile(filepath.Join(root, "三侠五义", "5.mp3"), []byte("not audio"), 0644); err != nil {
+		t.Fatalf("Failed to write broken file: %v", err)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixtures: %v", err)
+	}
+
+	proc := New(ProcessOptions{Threads: 8})
+	if err := proc.ProcessFiles(files, "gain", 8); err != nil {
+		t.Fatalf("Failed to run gain: %v", err)
+	}
+	stats := proc.Statistics()
+	if stats.GainAlbums != 3 || stats.TagsUpdated != 12 || stats.Failed != 1 || stats.GainWriteFailed != 0 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+	for _, file := range files {
+		if filepath.Base(file.Path) == "5.mp3" {
+			continue
+		}
+		texts, err := tagger.ReadUserTexts(file.Path)
+		if err != nil {
+			t.Fatalf("Failed to read tags of %s: %v", file.RelPath, err)
+		}
+		if texts[TagAlbumGain] == "" || texts[TagTrackGain] == "" {
+			t.Errorf("%s: expected ReplayGain tags, got %v", file.RelPath, texts)
+		}
+	}
+}
+
+func TestSplitCueStarts(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, filepath.Join(root, "书.mp3"), nil)
+	// Tracks out of order, one starting with another and one past the end of the 261 ms stream
+	sheet := `TITLE "白眉大侠"
+FILE "书.mp3" MP3
+  TRACK 01 AUDIO
+    TITLE "第一回"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "第三回"
+    INDEX 01 00:00:15
+  TRACK 03 AUDIO
+    TITLE "第二回"
+    INDEX 01 00:00:05
+  TRACK 04 AUDIO
+    TITLE "重复"
+    INDEX 01 00:00:05
+  TRACK 05 AUDIO
+    TITLE "第九回"
+    INDEX 01 00:05:00
+`
+	if err := os.WriteFile(filepath.Join(root, "书.cue"), []byte(sheet), 0644); err != nil {
+		t.Fatalf("Failed to write cue sheet: %v", err)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixture: %v", err)
+	}
+
+	outDir := t.TempDir()
+	proc := New(ProcessOptions{OutDir: outDir, Threads: 1, SplitMode: SplitCue})
+	if err := proc.ProcessFiles(files, "split", 1); err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	if stats := proc.Statistics(); stats.PartsWritten != 3 || stats.Failed != 0 {
+		t.Fatalf("Expected 3 parts, got %+v", stats)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(outDir, "书"))
+	if err != nil {
+		t.Fatalf("Failed to list parts: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"01 第一回.mp3", "02 第二回.mp3", "03 第三回.mp3"}
+	if strings.Join(names, "|") != strings.Join(want, "|") {
+		t.Errorf("Parts = %q, want %q", names, want)
+	}
+}
+
+func TestMergeChapterLimit(t *testing.T) {
+	root := t.TempDir()
+	for n := 1; n <= chapters.MaxChapters+1; n++ {
+		writeFixture(t, filepath.Join(root, "白眉大侠", fmt.Sprintf("%03d.mp3", n)), nil)
+	}
+	files, err := scanner.ScanDirectory(root)
+	if err != nil {
+		t.Fatalf("Failed to scan fixtures: %v", err)
+	}
+
+	outDir := t.TempDir()
+	proc := New(ProcessOptions{OutDir: outDir, Threads: 4})
+	if err := proc.ProcessFiles(files, "merge", 4); err != nil {
+		t.Fatalf("Failed to run merge: %v", err)
+	}
+	if stats := proc.Statistics(); stats.Failed != 1 || stats.DirsMerged != 0 {
+		t.Errorf("Expected the directory to be rejected, got %+v", stats)
+	}
+	if entries, _ := os.ReadDir(outDir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, got %d entries", len(entries))
+	}
+}
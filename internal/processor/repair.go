@@ -0,0 +1,52 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+)
+
+// repairFile repairs the MPEG stream of a file in place or into the output directory
+func (p *Processor) repairFile(file scanner.AudioFile) error {
+	outPath := file.Path
+	if p.options.OutDir != "" {
+		outPath = filepath.Join(p.options.OutDir, file.RelPath)
+	}
+
+	result, err := mpeg.RepairFile(file.Path, outPath)
+	if err != nil {
+		return fmt.Errorf("failed to repair %s: %w", file.Path, err)
+	}
+
+	p.mu.Lock()
+	if result.Changed() {
+		p.stats.StreamsRepaired++
+	} else {
+		p.stats.Unchanged++
+	}
+	p.mu.Unlock()
+
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	if !result.Changed() {
+		fmt.Printf("[%d/%d] Unchanged: %s (%d frames)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, result.Frames)
+		return nil
+	}
+	fmt.Printf("[%d/%d] Repaired: %s (%d frames)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, result.Frames)
+	for _, action := range result.Actions {
+		fmt.Printf("  %s\n", action)
+	}
+	return nil
+}
+
+// printRepairStatistics prints repair statistics
+func (p *Processor) printRepairStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Repaired: %d\n", p.stats.StreamsRepaired)
+	fmt.Printf("  Unchanged: %d\n", p.stats.Unchanged)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
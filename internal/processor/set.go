@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mp3tools/internal/tagger"
+)
+
+// Rule names of direct field edits (set command)
+const (
+	RuleSet   = "set"
+	RuleClear = "clear"
+)
+
+// changeTypeSet is the change type of direct field edits
+const changeTypeSet = "set"
+
+// SetSpec lists the direct field edits of the set command, applied in order:
+// values, then clears, then regex replacements
+type SetSpec struct {
+	Values   map[string]string // New field values; an empty value clears the field
+	Clear    []string          // Fields to remove
+	Replaces []Replacement     // Regex replacements on the resulting values
+}
+
+// Replacement is a per-field regex replacement written as field:s/pattern/replacement/[gi]
+type Replacement struct {
+	Field   string
+	Pattern *regexp.Regexp
+	Replace string // Replacement with $1 for groups
+	spec    string // As written, shown in diffs
+}
+
+// isField reports whether name is a metadata field (title, artist, album, year, genre, track or comment)
+func isField(name string) bool {
+	for _, field := range diffFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseReplacement parses a replacement such as `title:s/第(\d+)回/$1/`.
+// Any character after the s is the delimiter; a backslash escapes it. Every match is replaced,
+// as in regex-replace rules; the i flag makes the pattern case-insensitive, g is accepted as in sed.
+func ParseReplacement(spec string) (Replacement, error) {
+	field, expr, ok := strings.Cut(spec, ":")
+	field = strings.ToLower(strings.TrimSpace(field))
+	if !ok || !isField(field) {
+		return Replacement{}, fmt.Errorf("invalid replacement %q: expected field:s/pattern/replacement/ with field one of %s",
+			spec, strings.Join(diffFields, ", "))
+	}
+	if len(expr) < 2 || expr[0] != 's' {
+		return Replacement{}, fmt.Errorf("invalid replacement %q: expected s/pattern/replacement/", spec)
+	}
+
+	delim := expr[1]
+	var parts []string
+	var part strings.Builder
+	for i := 2; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == delim:
+			part.WriteByte(delim)
+			i++
+		case expr[i] == delim:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(expr[i])
+		}
+	}
+	if len(parts) != 2 {
+		return Replacement{}, fmt.Errorf("invalid replacement %q: expected s%cpattern%creplacement%c", spec, delim, delim, delim)
+	}
+
+	pattern := parts[0]
+	for _, flag := range part.String() {
+		switch flag {
+		case 'i':
+			pattern = "(?i)" + pattern
+		case 'g':
+		default:
+			return Replacement{}, fmt.Errorf("invalid replacement %q: unknown flag %q (use g or i)", spec, flag)
+		}
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Replacement{}, fmt.Errorf("invalid replacement %q: %w", spec, err)
+	}
+	return Replacement{Field: field, Pattern: re, Replace: parts[1], spec: expr}, nil
+}
+
+// Validate checks the field names and numeric values of a spec
+func (s *SetSpec) Validate() error {
+	for field, value := range s.Values {
+		if !isField(field) {
+			return fmt.Errorf("unknown field: %s", field)
+		}
+		if (field == "year" || field == "track") && value != "" {
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				return fmt.Errorf("%s must be a number, got %q", field, value)
+			}
+		}
+	}
+	for _, field := range s.Clear {
+		if !isField(field) {
+			return fmt.Errorf("unknown field: %s (use %s)", field, strings.Join(diffFields, ", "))
+		}
+		if _, ok := s.Values[field]; ok {
+			return fmt.Errorf("%s is both set and cleared", field)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the spec edits nothing
+func (s *SetSpec) Empty() bool {
+	return len(s.Values) == 0 && len(s.Clear) == 0 && len(s.Replaces) == 0
+}
+
+// setMetadata applies the set command's edits to a copy of the metadata.
+// The rule pipeline is not run, so the edits are the only source of changes.
+func (p *Processor) setMetadata(meta *tagger.Metadata) (*tagger.Metadata, []FieldChange) {
+	spec := p.options.Set
+	newMeta := *meta
+
+	var changes []FieldChange
+	set := func(field, value, rule string) {
+		if old := fieldValue(&newMeta, field); value != old {
+			setFieldValue(&newMeta, field, value)
+			changes = append(changes, FieldChange{Field: field, Old: old, New: value, Rule: rule, Type: changeTypeSet})
+		}
+	}
+
+	// Map order is random, so set fields in display order
+	for _, field := range diffFields {
+		if value, ok := spec.Values[field]; ok {
+			set(field, value, RuleSet)
+		}
+	}
+	for _, field := range spec.Clear {
+		set(field, "", RuleClear)
+	}
+	for _, r := range spec.Replaces {
+		value := fieldValue(&newMeta, r.Field)
+		replaced := strings.TrimSpace(r.Pattern.ReplaceAllString(value, r.Replace))
+		if r.Field == "year" || r.Field == "track" {
+			if _, err := strconv.Atoi(replaced); err != nil && replaced != "" {
+				// A number field can't hold text, keep it as it is
+				continue
+			}
+		}
+		set(r.Field, replaced, r.spec)
+	}
+
+	return &newMeta, changes
+}
@@ -0,0 +1,278 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mp3tools/internal/cue"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/writer"
+)
+
+// Split modes (ProcessOptions.SplitMode)
+const (
+	SplitAt      = "at"      // At the timestamps in ProcessOptions.SplitAt
+	SplitSilence = "silence" // In the middle of each silent region between the first and last sound
+	SplitCue     = "cue"     // At the tracks of the .cue sheet describing the file
+)
+
+// DefaultSplitTitle is the title template of parts without a cue sheet title
+const DefaultSplitTitle = "{title} {n}"
+
+// splitPart is one part of a file to split
+type splitPart struct {
+	first  int
+	title  string
+	artist string // From the cue sheet, empty to keep the parent's
+	album  string // From the cue sheet, empty to keep the parent's
+}
+
+// splitFile cuts a file into parts at frame boundaries. The parts are written to a directory
+// named after the file under the output directory, and each part gets the parent's tags with
+// its own title, track number n/total and length.
+func (p *Processor) splitFile(file scanner.AudioFile) error {
+	props, err := mpeg.AnalyzeFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", file.Path, err)
+	}
+	meta, err := tagger.ReadTags(file.Path)
+	if err != nil {
+		meta = &tagger.Metadata{}
+	}
+
+	parts, err := p.splitParts(file, props)
+	if err != nil {
+		return err
+	}
+
+	relPath := file.RelPath
+	if relPath == "." {
+		// The path given was the file itself
+		relPath = filepath.Base(file.Path)
+	}
+	fileNameForDisplay := convertPathToUTF8(relPath)
+	if len(parts) < 2 {
+		p.mu.Lock()
+		p.stats.Unchanged++
+		p.mu.Unlock()
+		fmt.Printf("[%d/%d] Unchanged: %s (no split points)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay)
+		return nil
+	}
+
+	// Titles and paths
+	total := len(parts)
+	width := max(2, len(strconv.Itoa(total)))
+	parentTitle := meta.Title
+	if parentTitle == "" {
+		parentTitle = strings.TrimSuffix(filepath.Base(file.Path), filepath.Ext(file.Path))
+	}
+	template := p.options.SplitTitle
+	if template == "" {
+		template = DefaultSplitTitle
+	}
+	partDir := filepath.Join(p.options.OutDir, strings.TrimSuffix(relPath, filepath.Ext(relPath)))
+
+	frameDuration := props.FrameDuration()
+	mpegParts := make([]mpeg.Part, total)
+	for i := range parts {
+		end := math.MaxInt // To the last frame
+		endFrame := props.Frames
+		if i+1 < total {
+			end = parts[i+1].first
+			endFrame = end
+		}
+
+		n := fmt.Sprintf("%0*d", width, i+1)
+		name := parts[i].title
+		if name == "" {
+			start := time.Duration(parts[i].first) * frameDuration
+			parts[i].title = strings.NewReplacer(
+				"{title}", parentTitle,
+				"{album}", meta.Album,
+				"{artist}", meta.Artist,
+				"{n}", n,
+				"{total}", strconv.Itoa(total),
+				"{start}", mpeg.FormatDuration(start),
+				"{duration}", mpeg.FormatDuration(time.Duration(endFrame-parts[i].first)*frameDuration),
+				"{bitrate}", strconv.Itoa(props.Bitrate),
+			).Replace(template)
+			name = parts[i].title
+		} else {
+			name = n + " " + name
+		}
+
+		mpegParts[i] = mpeg.Part{First: parts[i].first, End: end, Path: filepath.Join(partDir, safeFileName(name)+".mp3")}
+	}
+
+	results, err := mpeg.SplitFile(file.Path, mpegParts)
+	if err != nil {
+		return fmt.Errorf("failed to split %s: %w", file.Path, err)
+	}
+
+	parent, err := writer.New(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read tags of %s: %w", file.Path, err)
+	}
+	defer parent.Close()
+
+	fmt.Printf("[%d/%d] Split: %s → %d parts\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, total)
+	for i, result := range results {
+		if err := writePartTags(parent, mpegParts[i].Path, parts[i], i+1, total, result.Duration); err != nil {
+			return err
+		}
+		start := time.Duration(parts[i].first) * frameDuration
+		fmt.Printf("  %s (%s - %s)\n", filepath.Base(mpegParts[i].Path),
+			mpeg.FormatDuration(start), mpeg.FormatDuration(start+time.Duration(result.End-parts[i].first)*frameDuration))
+	}
+
+	p.mu.Lock()
+	p.stats.FilesSplit++
+	p.stats.PartsWritten += total
+	p.mu.Unlock()
+	return nil
+}
+
+// splitParts finds the first frame of each part
+func (p *Processor) splitParts(file scanner.AudioFile, props *mpeg.Properties) ([]splitPart, error) {
+	frameDuration := props.FrameDuration()
+	toFrame := func(t time.Duration) int {
+		return int((t + frameDuration/2) / frameDuration)
+	}
+
+	var parts []splitPart
+	switch p.options.SplitMode {
+	case SplitAt:
+		for _, t := range p.options.SplitAt {
+			parts = append(parts, splitPart{first: toFrame(t)})
+		}
+	case SplitSilence:
+		silence, err := p.detectSilence(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, region := range silence.Regions {
+			if region.FirstFrame > 0 && region.EndFrame < silence.Frames {
+				parts = append(parts, splitPart{first: (region.FirstFrame + region.EndFrame) / 2})
+			}
+		}
+	case SplitCue:
+		sheet, tracks, err := cue.FindImage(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		if sheet == nil {
+			return nil, nil
+		}
+		for _, track := range tracks {
+			parts = append(parts, splitPart{first: toFrame(track.Start), title: track.Title, artist: track.Performer, album: sheet.Title})
+		}
+	default:
+		return nil, fmt.Errorf("unknown split mode: %s", p.options.SplitMode)
+	}
+
+	// Sorted cut points inside the stream, starting with the first frame
+	sort.SliceStable(parts, func(i, j int) bool { return parts[i].first < parts[j].first })
+	result := []splitPart{{first: 0}}
+	if p.options.SplitMode == SplitCue {
+		// The pregap goes to the first track
+		result[0] = parts[0]
+		result[0].first = 0
+		parts = parts[1:]
+	}
+	for _, part := range parts {
+		if part.first > result[len(result)-1].first && part.first < props.Frames {
+			result = append(result, part)
+			continue
+		}
+		if p.options.SplitMode == SplitCue {
+			// A cue sheet for another rip of the disc, or a typo; the track's audio stays in the previous part
+			reason := "starts with the previous track"
+			if part.first >= props.Frames {
+				reason = "starts after the end of the audio (" + mpeg.FormatDuration(props.Duration) + ")"
+			}
+			fmt.Fprintf(os.Stderr, "Warning: %s: cue track %q at %s %s, skipped\n",
+				convertPathToUTF8(file.RelPath), part.title, mpeg.FormatDuration(time.Duration(part.first)*frameDuration), reason)
+		}
+	}
+	return result, nil
+}
+
+// writePartTags gives a part the tags of its parent with its own title, track and length.
+// Tags that describe the whole parent (track ReplayGain, synchronised lyrics, chapters) are dropped.
+func writePartTags(parent *writer.TagWriter, path string, part splitPart, n, total int, length time.Duration) error {
+	w, err := writer.New(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer w.Close()
+
+	w.CopyTags(parent)
+	for _, id := range []string{"SYLT", "CHAP", "CTOC"} {
+		w.GetTag().DeleteFrames(id)
+	}
+	w.SetUserText(TagTrackGain, "")
+	w.SetUserText(TagTrackPeak, "")
+
+	w.SetTitle(part.title)
+	w.SetArtist(part.artist)
+	w.SetAlbum(part.album)
+	w.SetTrack(fmt.Sprintf("%d/%d", n, total))
+	w.SetLength(length)
+	if err := w.Save(); err != nil {
+		return fmt.Errorf("failed to write tags to %s: %w", path, err)
+	}
+	return nil
+}
+
+// ParseTimestamp parses a split point such as "1:02:03.5", "62:03", "3723" (seconds) or "1h2m3s"
+func ParseTimestamp(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if d, err := time.ParseDuration(text); err == nil && strings.ContainsAny(text, "hms") {
+		return d, nil
+	}
+
+	fields := strings.Split(text, ":")
+	if len(fields) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", text)
+	}
+	var seconds float64
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil || value < 0 || (i < len(fields)-1 && strings.Contains(field, ".")) {
+			return 0, fmt.Errorf("invalid timestamp %q", text)
+		}
+		seconds = seconds*60 + value
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// safeFileName replaces characters that are not allowed in file names
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+}
+
+// printSplitStatistics prints split statistics
+func (p *Processor) printSplitStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Split: %d\n", p.stats.FilesSplit)
+	fmt.Printf("  Parts written: %d\n", p.stats.PartsWritten)
+	fmt.Printf("  Unchanged: %d\n", p.stats.Unchanged)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
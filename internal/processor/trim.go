@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"mp3tools/internal/loudness"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/writer"
+)
+
+// DefaultSilenceMargin is the silence kept at each end when trimming
+const DefaultSilenceMargin = 200 * time.Millisecond
+
+// detectSilence finds the silent regions of a file with the configured threshold
+func (p *Processor) detectSilence(file scanner.AudioFile) (*loudness.Silence, error) {
+	threshold, minSilence := p.options.SilenceThreshold, p.options.MinSilence
+	if threshold == 0 {
+		threshold = loudness.DefaultSilenceThreshold
+	}
+	if minSilence == 0 {
+		minSilence = loudness.DefaultMinSilence
+	}
+	silence, err := loudness.DetectSilence(file.Path, threshold, minSilence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze %s: %w", file.Path, err)
+	}
+	return silence, nil
+}
+
+// silenceFile reports the silent regions of a file
+func (p *Processor) silenceFile(file scanner.AudioFile) error {
+	silence, err := p.detectSilence(file)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if len(silence.Regions) > 0 {
+		p.stats.SilentFiles++
+	}
+	p.mu.Unlock()
+
+	leading, trailing := time.Duration(0), time.Duration(0)
+	if region, ok := silence.Leading(); ok {
+		leading = region.Duration()
+	}
+	if region, ok := silence.Trailing(); ok {
+		trailing = region.Duration()
+	}
+
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	fmt.Printf("[%d/%d] %s (%s): leading %s, trailing %s, %d silent regions\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, mpeg.FormatDuration(silence.Duration()),
+		formatSeconds(leading), formatSeconds(trailing), len(silence.Regions))
+	for _, region := range silence.Regions {
+		fmt.Printf("  %s - %s (%s)\n", mpeg.FormatDuration(region.Start), mpeg.FormatDuration(region.End), formatSeconds(region.Duration()))
+	}
+	return nil
+}
+
+// trimFile cuts leading and trailing silence at frame boundaries, keeping the configured margin,
+// then updates the length tag. Files are written in place or into the output directory.
+func (p *Processor) trimFile(file scanner.AudioFile) error {
+	silence, err := p.detectSilence(file)
+	if err != nil {
+		return err
+	}
+
+	margin := int(p.options.SilenceMargin / silence.FrameDuration)
+	first, end := 0, silence.Frames
+	if region, ok := silence.Leading(); ok {
+		first = max(region.EndFrame-margin, 0)
+	}
+	if region, ok := silence.Trailing(); ok {
+		end = min(region.FirstFrame+margin, silence.Frames)
+	}
+
+	outPath := file.Path
+	if p.options.OutDir != "" {
+		outPath = filepath.Join(p.options.OutDir, file.RelPath)
+	}
+
+	fileNameForDisplay := convertPathToUTF8(file.RelPath)
+	if first >= end {
+		return fmt.Errorf("%s is silent throughout, not trimmed", file.Path)
+	}
+	if first == 0 && end == silence.Frames && outPath == file.Path {
+		p.mu.Lock()
+		p.stats.Unchanged++
+		p.mu.Unlock()
+		fmt.Printf("[%d/%d] Unchanged: %s (%s)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, mpeg.FormatDuration(silence.Duration()))
+		return nil
+	}
+
+	result, err := mpeg.TrimFile(file.Path, outPath, first, end)
+	if err != nil {
+		return fmt.Errorf("failed to trim %s: %w", file.Path, err)
+	}
+
+	w, err := writer.New(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", outPath, err)
+	}
+	defer w.Close()
+	w.SetLength(result.Duration)
+	if err := w.Save(); err != nil {
+		return fmt.Errorf("failed to write tags to %s: %w", outPath, err)
+	}
+
+	changed := result.First > 0 || result.End < silence.Frames
+	p.mu.Lock()
+	if changed {
+		p.stats.Trimmed++
+	} else {
+		p.stats.Unchanged++
+	}
+	p.mu.Unlock()
+
+	if !changed {
+		fmt.Printf("[%d/%d] Unchanged: %s (%s)\n", p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, mpeg.FormatDuration(result.Duration))
+		return nil
+	}
+	cutStart := time.Duration(result.First) * silence.FrameDuration
+	cutEnd := time.Duration(silence.Frames-result.End) * silence.FrameDuration
+	fmt.Printf("[%d/%d] Trimmed: %s (%s -> %s, start -%s, end -%s)\n",
+		p.getCurrentIndex(), p.stats.Total, fileNameForDisplay, mpeg.FormatDuration(silence.Duration()),
+		mpeg.FormatDuration(result.Duration), formatSeconds(cutStart), formatSeconds(cutEnd))
+	if result.Reservoir > 0 {
+		fmt.Printf("  kept %d extra frames for the bit reservoir\n", result.Reservoir)
+	}
+	if !result.Complete {
+		fmt.Println("  bit reservoir not fully preserved, the first frame may be muted")
+	}
+	return nil
+}
+
+// formatSeconds formats a duration in seconds, e.g. "3.12 s"
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.2f s", d.Seconds())
+}
+
+// printSilenceStatistics prints silence detection statistics
+func (p *Processor) printSilenceStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  With silence: %d\n", p.stats.SilentFiles)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
+
+// printTrimStatistics prints trim statistics
+func (p *Processor) printTrimStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  Trimmed: %d\n", p.stats.Trimmed)
+	fmt.Printf("  Unchanged: %d\n", p.stats.Unchanged)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
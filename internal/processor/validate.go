@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+)
+
+// ValidateResult is the JSON report line of one validated file
+type ValidateResult struct {
+	Path   string       `json:"path"`
+	Status string       `json:"status"` // ok, warning or error
+	Frames int          `json:"frames"`
+	Issues []mpeg.Issue `json:"issues"`
+}
+
+// validateFile checks the MPEG stream of a file and prints its issues
+func (p *Processor) validateFile(file scanner.AudioFile) error {
+	report, err := mpeg.ValidateFile(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to validate %s: %w", file.Path, err)
+	}
+
+	result := ValidateResult{
+		Path:   file.RelPath,
+		Status: report.Status(),
+		Frames: report.Frames,
+		Issues: report.Issues,
+	}
+
+	p.mu.Lock()
+	switch result.Status {
+	case mpeg.SeverityError:
+		p.stats.StreamsErrors++
+	case mpeg.SeverityWarning:
+		p.stats.StreamsWarnings++
+	default:
+		p.stats.StreamsOK++
+	}
+	p.mu.Unlock()
+
+	fmt.Print(p.formatValidateResult(result))
+	return nil
+}
+
+// formatValidateResult renders a validation result as text or a JSON line
+func (p *Processor) formatValidateResult(result ValidateResult) string {
+	if p.options.Format == FormatJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Sprintf(`{"path":%q,"error":%q}`+"\n", result.Path, err.Error())
+		}
+		return string(data) + "\n"
+	}
+
+	var b strings.Builder
+	label := map[string]string{"ok": "OK", mpeg.SeverityWarning: "Warning", mpeg.SeverityError: "Error"}[result.Status]
+	fmt.Fprintf(&b, "[%d/%d] %s: %s (%d frames)\n", p.getCurrentIndex(), p.stats.Total, label, result.Path, result.Frames)
+	for _, issue := range result.Issues {
+		fmt.Fprintf(&b, "  @%d %s %s: %s\n", issue.Offset, issue.Severity, issue.Kind, issue.Message)
+	}
+	return b.String()
+}
+
+// printValidateStatistics prints validation statistics
+func (p *Processor) printValidateStatistics() {
+	fmt.Println("\n---")
+	fmt.Println("\nStatistics:")
+	fmt.Printf("  Total files: %d\n", p.stats.Total)
+	fmt.Printf("  OK: %d\n", p.stats.StreamsOK)
+	fmt.Printf("  Warnings: %d\n", p.stats.StreamsWarnings)
+	fmt.Printf("  Errors: %d\n", p.stats.StreamsErrors)
+	fmt.Printf("  Failed: %d\n", p.stats.Failed)
+	fmt.Println()
+}
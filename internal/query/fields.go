@@ -0,0 +1,229 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mp3tools/internal/catalog"
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+	"mp3tools/internal/workers"
+)
+
+// Subject is a file a filter is evaluated against. Tags, audio properties and file
+// information are read on first use, so filters only pay for the fields they use.
+type Subject struct {
+	File scanner.AudioFile
+
+	meta    *tagger.Metadata
+	metaErr error
+	read    bool
+
+	audio    *mpeg.Properties
+	audioErr error
+	analyzed bool
+
+	info    os.FileInfo
+	infoErr error
+	statted bool
+}
+
+// NewSubject returns a subject for a file
+func NewSubject(file scanner.AudioFile) *Subject {
+	return &Subject{File: file}
+}
+
+// Meta returns the tags of the file
+func (s *Subject) Meta() (*tagger.Metadata, error) {
+	if !s.read {
+		s.read = true
+		s.meta, s.metaErr = tagger.ReadTags(s.File.Path)
+		if s.metaErr != nil {
+			s.metaErr = fmt.Errorf("failed to read tags from %s: %w", s.File.Path, s.metaErr)
+		}
+	}
+	return s.meta, s.metaErr
+}
+
+// Audio returns the technical properties of the audio stream, or an error if it can't be analyzed
+func (s *Subject) Audio() (*mpeg.Properties, error) {
+	if !s.analyzed {
+		s.analyzed = true
+		s.audio, s.audioErr = mpeg.AnalyzeFile(s.File.Path)
+	}
+	return s.audio, s.audioErr
+}
+
+// stat returns the file information
+func (s *Subject) stat() (os.FileInfo, error) {
+	if !s.statted {
+		s.statted = true
+		s.info, s.infoErr = os.Stat(s.File.Path)
+	}
+	return s.info, s.infoErr
+}
+
+// Field returns the value of a field
+func (s *Subject) Field(name string) (Value, error) {
+	f, ok := fields[name]
+	if !ok {
+		return Value{}, fmt.Errorf("unknown field %q", name)
+	}
+	return f(s)
+}
+
+// tagField returns a field read from the tags
+func tagField(get func(m *tagger.Metadata) Value) func(s *Subject) (Value, error) {
+	return func(s *Subject) (Value, error) {
+		meta, err := s.Meta()
+		if err != nil {
+			return Value{}, err
+		}
+		return get(meta), nil
+	}
+}
+
+// audioField returns a technical property; it is unset (empty, 0 in comparisons) when the
+// stream can't be analyzed, and audio_error tells why
+func audioField(get func(p *mpeg.Properties) Value) func(s *Subject) (Value, error) {
+	return func(s *Subject) (Value, error) {
+		props, err := s.Audio()
+		if err != nil {
+			return Value{}, nil
+		}
+		return get(props), nil
+	}
+}
+
+// fileField returns a field from the file information
+func fileField(get func(info os.FileInfo) Value) func(s *Subject) (Value, error) {
+	return func(s *Subject) (Value, error) {
+		info, err := s.stat()
+		if err != nil {
+			return Value{}, err
+		}
+		return get(info), nil
+	}
+}
+
+// fields lists the fields a filter can use, named like the export columns
+var fields = map[string]func(s *Subject) (Value, error){
+	"path": func(s *Subject) (Value, error) { return String(catalog.RelPath(s.File)), nil },
+	"name": func(s *Subject) (Value, error) {
+		name := filepath.Base(s.File.Path)
+		return String(strings.TrimSuffix(name, filepath.Ext(name))), nil
+	},
+	"dir": func(s *Subject) (Value, error) {
+		return String(filepath.Base(filepath.Dir(s.File.Path))), nil
+	},
+	"size":  fileField(func(info os.FileInfo) Value { return Number(float64(info.Size())) }),
+	"mtime": fileField(func(info os.FileInfo) Value { return String(info.ModTime().Format(time.RFC3339)) }),
+
+	"title":       tagField(func(m *tagger.Metadata) Value { return String(m.Title) }),
+	"artist":      tagField(func(m *tagger.Metadata) Value { return String(m.Artist) }),
+	"album":       tagField(func(m *tagger.Metadata) Value { return String(m.Album) }),
+	"genre":       tagField(func(m *tagger.Metadata) Value { return String(m.Genre) }),
+	"comment":     tagField(func(m *tagger.Metadata) Value { return String(m.Comment) }),
+	"year":        tagField(func(m *tagger.Metadata) Value { return Number(float64(m.Year)) }),
+	"track":       tagField(func(m *tagger.Metadata) Value { return Number(float64(m.Track)) }),
+	"format":      tagField(func(m *tagger.Metadata) Value { return String(string(m.Format)) }),
+	"has_picture": tagField(func(m *tagger.Metadata) Value { return Bool(m.HasPicture) }),
+	"charset":     tagField(func(m *tagger.Metadata) Value { return String(catalog.DetectCharset(m)) }),
+
+	"version":      audioField(func(p *mpeg.Properties) Value { return String(p.Version.String()) }),
+	"layer":        audioField(func(p *mpeg.Properties) Value { return Number(float64(p.Layer)) }),
+	"sample_rate":  audioField(func(p *mpeg.Properties) Value { return Number(float64(p.SampleRate)) }),
+	"channel_mode": audioField(func(p *mpeg.Properties) Value { return String(p.ChannelMode.String()) }),
+	"bitrate":      audioField(func(p *mpeg.Properties) Value { return Number(float64(p.Bitrate)) }),
+	"vbr":          audioField(func(p *mpeg.Properties) Value { return Bool(p.VBR) }),
+	"duration": audioField(func(p *mpeg.Properties) Value {
+		return Number(math.Round(p.Duration.Seconds()*1000) / 1000)
+	}),
+	"frames":        audioField(func(p *mpeg.Properties) Value { return Number(float64(p.Frames)) }),
+	"encoder":       audioField(func(p *mpeg.Properties) Value { return String(p.Encoder) }),
+	"length_source": audioField(func(p *mpeg.Properties) Value { return String(p.Source) }),
+	"audio_error": func(s *Subject) (Value, error) {
+		_, err := s.Audio()
+		if err == nil {
+			return String(""), nil
+		}
+		return String(err.Error()), nil
+	},
+}
+
+// FieldNames returns the names of the fields a filter can use, sorted
+func FieldNames() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckFields returns an error naming the first unknown field
+func CheckFields(names []string) error {
+	for _, name := range names {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown field %q (use %s)", name, strings.Join(FieldNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Collect evaluates a filter (nil matches every file) with a worker pool and returns the
+// matching files in file order. The given fields are read as well, so sorting and printing
+// the subjects doesn't touch the files again. Files that can't be evaluated are returned as errors.
+func Collect(files []scanner.AudioFile, filter *Filter, preload []string, threads int) ([]*Subject, []error) {
+	subjects := make([]*Subject, len(files))
+	matched := make([]bool, len(files))
+	failures := make([]error, len(files))
+	workers.Run(len(files), threads, func(index int) {
+		s := NewSubject(files[index])
+		subjects[index] = s
+		matched[index] = true
+		if filter != nil {
+			matched[index], failures[index] = filter.Match(s)
+		}
+		for _, name := range preload {
+			if !matched[index] || failures[index] != nil {
+				break
+			}
+			_, failures[index] = s.Field(name)
+		}
+	})
+
+	var result []*Subject
+	var errs []error
+	for i := range files {
+		switch {
+		case failures[i] != nil:
+			errs = append(errs, failures[i])
+		case matched[i]:
+			result = append(result, subjects[i])
+		}
+	}
+	return result, errs
+}
+
+// Select returns the files matching a filter, in file order, using a worker pool.
+// Files that can't be evaluated are returned as errors.
+func Select(files []scanner.AudioFile, filter *Filter, threads int) ([]scanner.AudioFile, []error) {
+	subjects, errs := Collect(files, filter, nil, threads)
+	return Files(subjects), errs
+}
+
+// Files returns the files of subjects
+func Files(subjects []*Subject) []scanner.AudioFile {
+	files := make([]scanner.AudioFile, len(subjects))
+	for i, s := range subjects {
+		files[i] = s.File
+	}
+	return files
+}
@@ -0,0 +1,38 @@
+package query
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"mp3tools/internal/encoder"
+)
+
+// function is a function filters can call
+type function struct {
+	arity int
+	fn    func(args []Value) Value
+}
+
+// funcs lists the functions a filter can call, mostly encoding diagnostics on tag text
+var funcs = map[string]function{
+	// garbled reports text that is damaged beyond repair (question marks, replacement characters, stray Latin-1)
+	"garbled": {1, func(args []Value) Value { return Bool(encoder.IsGarbled(args[0].str)) }},
+	// fixable reports text in a legacy encoding such as GBK that fix would convert to UTF-8
+	"fixable": {1, func(args []Value) Value {
+		_, _, changed := encoder.FixEncoding(args[0].str)
+		return Bool(changed)
+	}},
+	"len":   {1, func(args []Value) Value { return Number(float64(utf8.RuneCountInString(args[0].str))) }},
+	"lower": {1, func(args []Value) Value { return String(strings.ToLower(args[0].str)) }},
+}
+
+// FuncNames returns the names of the functions a filter can call, sorted
+func FuncNames() []string {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
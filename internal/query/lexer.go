@@ -0,0 +1,154 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp    // Comparison: == != < <= > >= ~ !~
+	tokenAnd   // and, &&
+	tokenOr    // or, ||
+	tokenNot   // not, !
+	tokenLeft  // (
+	tokenRight // )
+	tokenComma
+)
+
+// token is one lexical token of an expression
+type token struct {
+	kind tokenKind
+	text string // Operator, identifier, or the unquoted string
+	num  float64
+	pos  int // Byte offset in the expression, for error messages
+}
+
+// operators lists the comparison operators, longest first so "<=" wins over "<"
+var operators = []string{"==", "!=", "<=", ">=", "!~", "<", ">", "~", "="}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for pos := 0; pos < len(src); {
+		r, size := utf8.DecodeRuneInString(src[pos:])
+		rest := src[pos:]
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+			continue
+		case r == '"' || r == '\'':
+			text, n, err := lexString(rest)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: %w", pos, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos})
+			pos += n
+			continue
+		case r >= '0' && r <= '9' || r == '.' || r == '-' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9':
+			n := 1
+			for n < len(rest) && (rest[n] >= '0' && rest[n] <= '9' || rest[n] == '.') {
+				n++
+			}
+			num, err := strconv.ParseFloat(rest[:n], 64)
+			if err != nil {
+				return nil, fmt.Errorf("at %d: invalid number %q", pos, rest[:n])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: rest[:n], num: num, pos: pos})
+			pos += n
+			continue
+		case r == '_' || unicode.IsLetter(r):
+			n := 0
+			for n < len(rest) {
+				c, size := utf8.DecodeRuneInString(rest[n:])
+				if c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+				n += size
+			}
+			word := rest[:n]
+			kind := tokenIdent
+			switch strings.ToLower(word) {
+			case "and":
+				kind = tokenAnd
+			case "or":
+				kind = tokenOr
+			case "not":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: pos})
+			pos += n
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(rest, "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, text: "&&", pos: pos})
+			pos += 2
+			continue
+		case strings.HasPrefix(rest, "||"):
+			tokens = append(tokens, token{kind: tokenOr, text: "||", pos: pos})
+			pos += 2
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeft, text: "(", pos: pos})
+			pos++
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRight, text: ")", pos: pos})
+			pos++
+			continue
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			pos++
+			continue
+		}
+
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(rest, op) {
+				tokens = append(tokens, token{kind: tokenOp, text: op, pos: pos})
+				pos += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched && r == '!' {
+			tokens = append(tokens, token{kind: tokenNot, text: "!", pos: pos})
+			pos++
+			matched = true
+		}
+		if !matched {
+			return nil, fmt.Errorf("at %d: unexpected %q", pos, r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// lexString reads a quoted string at the start of s and returns its value and length.
+// Backslash escapes a quote or backslash, other backslashes are kept so regexes like "\d" work.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			b.WriteByte(s[i+1])
+			i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,111 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/width"
+)
+
+// SortKey is a field to sort by, written as `year` or `-year` for descending order
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses sort keys such as ["artist", "-bitrate"]
+func ParseSort(specs []string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, spec := range specs {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		key := SortKey{Field: strings.TrimPrefix(spec, "-"), Desc: strings.HasPrefix(spec, "-")}
+		if err := CheckFields([]string{key.Field}); err != nil {
+			return nil, fmt.Errorf("invalid sort key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Sort orders subjects by the keys, comparing like filters do (numbers numerically).
+// The sort is stable, so ties keep file order.
+func Sort(subjects []*Subject, keys []SortKey) {
+	if len(keys) == 0 {
+		return
+	}
+	values := make(map[*Subject][]Value, len(subjects))
+	for _, s := range subjects {
+		row := make([]Value, len(keys))
+		for i, key := range keys {
+			// Collect preloads the keys, a field that fails to read sorts as unset
+			row[i], _ = s.Field(key.Field)
+		}
+		values[s] = row
+	}
+
+	sort.SliceStable(subjects, func(i, j int) bool {
+		a, b := values[subjects[i]], values[subjects[j]]
+		for k, key := range keys {
+			c := compare(a[k], b[k])
+			if key.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// WriteTable writes the fields of each subject as aligned columns under a header row.
+// Line breaks and tabs in values are shown as spaces, so each file stays on one line.
+func WriteTable(w io.Writer, subjects []*Subject, names []string) error {
+	rows := [][]string{names}
+	for _, s := range subjects {
+		row := make([]string, len(names))
+		for i, name := range names {
+			v, _ := s.Field(name)
+			row[i] = strings.Join(strings.Fields(v.String()), " ")
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(names))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		line.WriteByte('\n')
+		if _, err := io.WriteString(w, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayWidth returns the terminal width of text, counting CJK characters as two columns
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,381 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed --where expression such as `album ~ "评书" and year < 1990`
+type Filter struct {
+	src  string
+	root node
+}
+
+// String returns the expression as written
+func (f *Filter) String() string {
+	return f.src
+}
+
+// Parse parses a filter expression.
+//
+// Expressions compare fields with == (or =), !=, <, <=, >, >=, ~ (regex match) and !~,
+// and combine comparisons with and/&&, or/||, not/! and parentheses. Strings are quoted
+// with " or '; a field on its own is true when it is set (non-empty, non-zero). Functions such as
+// garbled(title) take fields or literals as arguments.
+func Parse(src string) (*Filter, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", src, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", src, err)
+	}
+	return &Filter{src: src, root: root}, nil
+}
+
+// Match evaluates the filter against a file
+func (f *Filter) Match(s *Subject) (bool, error) {
+	v, err := f.root.eval(s)
+	if err != nil {
+		return false, err
+	}
+	return v.truthy(), nil
+}
+
+// valueKind is the type of a value
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindBool
+)
+
+// Value is a field, literal or comparison result
+type Value struct {
+	kind valueKind
+	str  string // String form; empty for unset numbers
+	num  float64
+	b    bool
+}
+
+// String returns a text value
+func String(s string) Value {
+	return Value{kind: kindString, str: s}
+}
+
+// Number returns a numeric value; 0 formats as empty, so unset years and tracks equal ""
+func Number(n float64) Value {
+	v := Value{kind: kindNumber, num: n}
+	if n != 0 {
+		v.str = strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return v
+}
+
+// Bool returns a boolean value
+func Bool(b bool) Value {
+	return Value{kind: kindBool, b: b, str: strconv.FormatBool(b)}
+}
+
+// String returns the value as text
+func (v Value) String() string {
+	return v.str
+}
+
+// truthy reports whether a value counts as true on its own
+func (v Value) truthy() bool {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.num != 0
+	default:
+		return v.str != ""
+	}
+}
+
+// compare orders two values: numerically when both are numbers (or a number and numeric text),
+// as text otherwise
+func compare(a, b Value) int {
+	x, xok := a.number()
+	y, yok := b.number()
+	if xok && yok && (a.kind == kindNumber || b.kind == kindNumber) {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.str, b.str)
+}
+
+// number returns the numeric form of a value
+func (v Value) number() (float64, bool) {
+	switch v.kind {
+	case kindNumber:
+		return v.num, true
+	case kindBool:
+		if v.b {
+			return 1, true
+		}
+		return 0, true
+	}
+	if v.str == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v.str), 64)
+	return n, err == nil
+}
+
+// node is a parsed expression
+type node interface {
+	eval(s *Subject) (Value, error)
+}
+
+type literal struct{ value Value }
+
+func (n literal) eval(*Subject) (Value, error) { return n.value, nil }
+
+type fieldRef struct{ name string }
+
+func (n fieldRef) eval(s *Subject) (Value, error) { return s.Field(n.name) }
+
+type not struct{ operand node }
+
+func (n not) eval(s *Subject) (Value, error) {
+	v, err := n.operand.eval(s)
+	return Bool(!v.truthy()), err
+}
+
+// logical is and/or with short-circuit evaluation, so unneeded audio properties aren't read
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n logical) eval(s *Subject) (Value, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return Value{}, err
+	}
+	if left.truthy() != n.and {
+		return Bool(!n.and), nil
+	}
+	right, err := n.right.eval(s)
+	return Bool(right.truthy()), err
+}
+
+type comparison struct {
+	op          string
+	left, right node
+}
+
+func (n comparison) eval(s *Subject) (Value, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return Value{}, err
+	}
+	right, err := n.right.eval(s)
+	if err != nil {
+		return Value{}, err
+	}
+	c := compare(left, right)
+	switch n.op {
+	case "==", "=":
+		return Bool(c == 0), nil
+	case "!=":
+		return Bool(c != 0), nil
+	case "<":
+		return Bool(c < 0), nil
+	case "<=":
+		return Bool(c <= 0), nil
+	case ">":
+		return Bool(c > 0), nil
+	default:
+		return Bool(c >= 0), nil
+	}
+}
+
+type match struct {
+	negate  bool
+	operand node
+	re      *regexp.Regexp
+}
+
+func (n match) eval(s *Subject) (Value, error) {
+	v, err := n.operand.eval(s)
+	if err != nil {
+		return Value{}, err
+	}
+	return Bool(n.re.MatchString(v.str) != n.negate), nil
+}
+
+type call struct {
+	f    function
+	args []node
+}
+
+func (n call) eval(s *Subject) (Value, error) {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(s)
+		if err != nil {
+			return Value{}, err
+		}
+		args[i] = v
+	}
+	return n.f.fn(args), nil
+}
+
+// parser is a recursive descent parser over the tokens of an expression
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+// parseOr parses: and ("or" and)*
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.peek().kind == tokenOr {
+		p.next()
+		var right node
+		right, err = p.parseAnd()
+		left = logical{and: false, left: left, right: right}
+	}
+	return left, err
+}
+
+// parseAnd parses: not ("and" not)*
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	for err == nil && p.peek().kind == tokenAnd {
+		p.next()
+		var right node
+		right, err = p.parseNot()
+		left = logical{and: true, left: left, right: right}
+	}
+	return left, err
+}
+
+// parseNot parses: "not" not | comparison
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		operand, err := p.parseNot()
+		return not{operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+// parseComparison parses: operand (op operand)?
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil || p.peek().kind != tokenOp {
+		return left, err
+	}
+
+	op := p.next().text
+	if op == "~" || op == "!~" {
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, fmt.Errorf("at %d: %s needs a quoted regular expression", t.pos, op)
+		}
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("at %d: %w", t.pos, err)
+		}
+		return match{negate: op == "!~", operand: left, re: re}, nil
+	}
+
+	right, err := p.parseOperand()
+	return comparison{op: op, left: left, right: right}, err
+}
+
+// parseCall parses the arguments of a function call: "(" (or ("," or)*)? ")"
+func (p *parser) parseCall(name token) (node, error) {
+	f, ok := funcs[strings.ToLower(name.text)]
+	if !ok {
+		return nil, fmt.Errorf("at %d: unknown function %q (use %s)", name.pos, name.text, strings.Join(FuncNames(), ", "))
+	}
+	p.next()
+
+	var args []node
+	for p.peek().kind != tokenRight {
+		if len(args) > 0 {
+			if p.peek().kind != tokenComma {
+				return nil, p.errorf("expected , or ) in %s()", name.text)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	if len(args) != f.arity {
+		return nil, fmt.Errorf("at %d: %s() takes %d argument(s), got %d", name.pos, name.text, f.arity, len(args))
+	}
+	return call{f: f, args: args}, nil
+}
+
+// parseOperand parses: string | number | field | call | "(" or ")"
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return literal{String(t.text)}, nil
+	case tokenNumber:
+		return literal{Number(t.num)}, nil
+	case tokenIdent:
+		name := strings.ToLower(t.text)
+		if p.peek().kind == tokenLeft {
+			return p.parseCall(t)
+		}
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("at %d: unknown field %q (use %s)", t.pos, t.text, strings.Join(FieldNames(), ", "))
+		}
+		return fieldRef{name: name}, nil
+	case tokenLeft:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRight {
+			return nil, fmt.Errorf("at %d: missing )", t.pos)
+		}
+		return inner, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("at %d: unexpected end of filter", t.pos)
+	default:
+		return nil, fmt.Errorf("at %d: unexpected %q", t.pos, t.text)
+	}
+}
@@ -0,0 +1,118 @@
+package query
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mp3tools/internal/mpeg"
+	"mp3tools/internal/scanner"
+	"mp3tools/internal/tagger"
+)
+
+// subject returns a subject with preloaded tags, so no file is read
+func subject(rel string, meta tagger.Metadata) *Subject {
+	file := scanner.AudioFile{Path: filepath.Join("/music", rel), RelPath: rel, BasePath: "/music"}
+	audio := &mpeg.Properties{SampleRate: 22050, Bitrate: 48, VBR: true, Duration: 30 * time.Second}
+	return &Subject{File: file, meta: &meta, read: true, audio: audio, analyzed: true}
+}
+
+func TestMatch(t *testing.T) {
+	s := subject("评书/白眉大侠/第001回.mp3", tagger.Metadata{Title: "第001回", Artist: "单田芳", Album: "白眉大侠 评书", Year: 1985, Track: 1})
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`album ~ "评书"`, true},
+		{`album !~ '评书'`, false},
+		{`artist == "单田芳" and year < 1990`, true},
+		{`artist = "x" or track >= 1`, true},
+		{`not (year > 1980 && year < 1990)`, false},
+		{`artist == "x" or artist == "y" and track == 1`, false},
+		{`(artist == "x" or artist == "单田芳") and track == 1`, true},
+		{`comment == ""`, true},
+		{`genre`, false},
+		{`!genre`, true},
+		{`title ~ "^第\d+回$"`, true},
+		{`path ~ "^评书/" and dir == "白眉大侠" and name == "第001回"`, true},
+		{`year == "1985"`, true},
+		{`title > "第000回"`, true},
+		{`bitrate < 64 and vbr and not has_picture`, true},
+		{`duration > 60 or sample_rate != 22050`, false},
+		{`garbled(title) or fixable(artist)`, false},
+		{`garbled("Â§Ã¥Ã¼??")`, true},
+		{`len(title) == 5 and lower("ABC") == "abc"`, true},
+		{`audio_error == ""`, true},
+	}
+	for _, tt := range tests {
+		filter, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		got, err := filter.Match(s)
+		if err != nil {
+			t.Errorf("Match(%q): %v", tt.expr, err)
+		} else if got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	// Unset numbers equal the empty string
+	filter, _ := Parse(`year == "" and track == ""`)
+	if got, _ := filter.Match(subject("a.mp3", tagger.Metadata{})); !got {
+		t.Error("Expected unset year and track to equal \"\"")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`rating > 1`,
+		`title ~ artist`,
+		`title ~ "("`,
+		`(title == "x"`,
+		`title == "x`,
+		`title == "x" extra`,
+		`title ==`,
+		`title # 1`,
+		`garbled()`,
+		`garbled(title`,
+		`nope(title)`,
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", expr)
+		}
+	}
+}
+
+func TestSortAndTable(t *testing.T) {
+	subjects := []*Subject{
+		subject("a.mp3", tagger.Metadata{Title: "第二回", Artist: "单田芳", Year: 1985}),
+		subject("b.mp3", tagger.Metadata{Title: "Two", Artist: "Unknown"}),
+		subject("c.mp3", tagger.Metadata{Title: "第一回", Artist: "单田芳", Year: 1990}),
+	}
+	keys, err := ParseSort([]string{"-artist", "-year"})
+	if err != nil {
+		t.Fatalf("Failed to parse sort keys: %v", err)
+	}
+	Sort(subjects, keys)
+	if got := Files(subjects); got[0].RelPath != "c.mp3" || got[1].RelPath != "a.mp3" || got[2].RelPath != "b.mp3" {
+		t.Errorf("Expected c, a, b, got %v", got)
+	}
+	if _, err := ParseSort([]string{"-size", "rating"}); err == nil {
+		t.Error("Expected an unknown sort field to fail")
+	}
+
+	var out bytes.Buffer
+	if err := WriteTable(&out, subjects[:2], []string{"title", "year", "path"}); err != nil {
+		t.Fatalf("Failed to write table: %v", err)
+	}
+	want := "title   year  path\n" +
+		"第一回  1990  c.mp3\n" +
+		"第二回  1985  a.mp3\n"
+	if out.String() != want {
+		t.Errorf("Expected table\n%s\ngot\n%s", want, out.String())
+	}
+}
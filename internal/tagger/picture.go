@@ -0,0 +1,76 @@
+package tagger
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/dhowden/tag"
+)
+
+// Picture is an embedded image (ID3v2 APIC frame)
+type Picture struct {
+	Type        byte   // Picture type, 3 is the front cover
+	MimeType    string // e.g. image/jpeg
+	Description string
+	Data        []byte
+}
+
+// ReadPictures reads all embedded pictures of an audio file
+func ReadPictures(filePath string) ([]Picture, error) {
+	id3Tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	if err == nil {
+		defer id3Tag.Close()
+
+		var pictures []Picture
+		for _, frame := range id3Tag.GetFrames(id3Tag.CommonID("Attached picture")) {
+			pic, ok := frame.(id3v2.PictureFrame)
+			if !ok {
+				continue
+			}
+			pictures = append(pictures, Picture{
+				Type:        pic.PictureType,
+				MimeType:    pic.MimeType,
+				Description: pic.Description,
+				Data:        pic.Picture,
+			})
+		}
+		return pictures, nil
+	}
+
+	// Fallback to dhowden/tag if id3v2 fails
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	meta, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	pic := meta.Picture()
+	if pic == nil {
+		return nil, nil
+	}
+	return []Picture{{
+		Type:        id3v2.PTFrontCover,
+		MimeType:    pic.MIMEType,
+		Description: pic.Description,
+		Data:        pic.Data,
+	}}, nil
+}
+
+// FrontCover returns the front cover picture, or the first picture if none is marked as front cover
+func FrontCover(pictures []Picture) *Picture {
+	for i := range pictures {
+		if pictures[i].Type == id3v2.PTFrontCover {
+			return &pictures[i]
+		}
+	}
+	if len(pictures) > 0 {
+		return &pictures[0]
+	}
+	return nil
+}
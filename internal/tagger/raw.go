@@ -0,0 +1,15 @@
+package tagger
+
+import "mp3tools/internal/mpeg"
+
+// ID3v2Size returns the full size of the ID3v2 tag at the start of data,
+// including header and footer, or 0 if data does not start with a tag
+func ID3v2Size(data []byte) int {
+	return mpeg.ID3v2Size(data)
+}
+
+// SplitID3v2 splits file data into the leading ID3v2 tag bytes and the remaining audio data
+func SplitID3v2(data []byte) (tag []byte, audio []byte) {
+	size := ID3v2Size(data)
+	return data[:size], data[size:]
+}
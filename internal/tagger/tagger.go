@@ -4,20 +4,24 @@ import (
 	"fmt"
 	"os"
 
+	"mp3tools/internal/mpeg"
+
 	"github.com/bogem/id3v2/v2"
 	"github.com/dhowden/tag"
 )
 
 // Metadata represents audio file metadata
 type Metadata struct {
-	Title   string
-	Artist  string
-	Album   string
-	Year    int
-	Genre   string
-	Track   int
-	Comment string
-	Format  tag.Format
+	Title      string
+	Artist     string
+	Album      string
+	Year       int
+	Genre      string
+	Track      int
+	Comment    string
+	Format     tag.Format
+	HasPicture bool             // File has embedded cover art
+	Audio      *mpeg.Properties // Technical stream properties (nil unless read with ReadAudio)
 }
 
 // ReadTags reads metadata tags from an audio file
@@ -33,6 +37,7 @@ func ReadTags(filePath string) (*Metadata, error) {
 		album := readTextFrame(id3Tag, "TALB")
 		genre := readTextFrame(id3Tag, "TCON")
 		comment := readCommentFrame(id3Tag)
+		hasPicture := len(id3Tag.GetFrames(id3Tag.CommonID("Attached picture"))) > 0
 
 		// Get year and track
 		year := 0
@@ -56,14 +61,15 @@ func ReadTags(filePath string) (*Metadata, error) {
 		}
 
 		return &Metadata{
-			Title:   title,
-			Artist:  artist,
-			Album:   album,
-			Year:    year,
-			Genre:   genre,
-			Track:   track,
-			Comment: comment,
-			Format:  format,
+			Title:      title,
+			Artist:     artist,
+			Album:      album,
+			Year:       year,
+			Genre:      genre,
+			Track:      track,
+			Comment:    comment,
+			Format:     format,
+			HasPicture: hasPicture,
 		}, nil
 	}
 
@@ -86,17 +92,28 @@ func ReadTags(filePath string) (*Metadata, error) {
 	}
 
 	return &Metadata{
-		Title:   meta.Title(),
-		Artist:  meta.Artist(),
-		Album:   meta.Album(),
-		Year:    year,
-		Genre:   meta.Genre(),
-		Track:   track,
-		Comment: meta.Comment(),
-		Format:  meta.Format(),
+		Title:      meta.Title(),
+		Artist:     meta.Artist(),
+		Album:      meta.Album(),
+		Year:       year,
+		Genre:      meta.Genre(),
+		Track:      track,
+		Comment:    meta.Comment(),
+		Format:     meta.Format(),
+		HasPicture: meta.Picture() != nil,
 	}, nil
 }
 
+// ReadAudio reads the technical properties of the audio stream into the metadata
+func (m *Metadata) ReadAudio(filePath string) error {
+	props, err := mpeg.AnalyzeFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read audio properties from %s: %w", filePath, err)
+	}
+	m.Audio = props
+	return nil
+}
+
 // readTextFrame reads a text frame and handles encoding conversion
 func readTextFrame(tag *id3v2.Tag, frameID string) string {
 	textFrame := tag.GetTextFrame(frameID)
@@ -160,6 +177,17 @@ func (m *Metadata) IsEmpty() bool {
 		m.Comment == ""
 }
 
+// Equal checks if all tag fields of two metadata values are identical
+func (m *Metadata) Equal(other *Metadata) bool {
+	return m.Title == other.Title &&
+		m.Artist == other.Artist &&
+		m.Album == other.Album &&
+		m.Year == other.Year &&
+		m.Genre == other.Genre &&
+		m.Track == other.Track &&
+		m.Comment == other.Comment
+}
+
 // GetRawBytes returns raw bytes of a tag field for encoding detection
 func GetRawBytes(filePath string, field string) ([]byte, error) {
 	f, err := os.Open(filePath)
@@ -0,0 +1,24 @@
+package tagger
+
+import (
+	"strings"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// ReadUserTexts reads the user-defined text frames (TXXX) of a file, keyed by upper-case description
+func ReadUserTexts(filePath string) (map[string]string, error) {
+	id3Tag, err := id3v2.Open(filePath, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	defer id3Tag.Close()
+
+	texts := make(map[string]string)
+	for _, frame := range id3Tag.GetFrames("TXXX") {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); ok {
+			texts[strings.ToUpper(udtf.Description)] = udtf.Value
+		}
+	}
+	return texts, nil
+}
@@ -0,0 +1,27 @@
+package workers
+
+import "sync"
+
+// Run calls fn for each index from 0 to n-1 on a pool of threads goroutines (at least one)
+// and returns when all calls are done. Calls for different indexes run concurrently, so fn
+// should only write to per-index slots or guard shared state itself.
+func Run(n, threads int, fn func(index int)) {
+	jobs := make(chan int, n)
+	var wg sync.WaitGroup
+
+	for i := 0; i < max(1, min(threads, n)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				fn(index)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,35 @@
+package workers
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, threads := range []int{0, 1, 4, 100} {
+		seen := make([]int32, 50)
+		var running, peak int32
+		Run(len(seen), threads, func(index int) {
+			now := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+					break
+				}
+			}
+			atomic.AddInt32(&seen[index], 1)
+			atomic.AddInt32(&running, -1)
+		})
+
+		for index, count := range seen {
+			if count != 1 {
+				t.Errorf("threads %d: index %d ran %d times, want once", threads, index, count)
+			}
+		}
+		if limit := int32(max(1, threads)); peak > limit {
+			t.Errorf("threads %d: %d calls ran at once", threads, peak)
+		}
+	}
+
+	Run(0, 4, func(int) { t.Error("Expected no calls for n = 0") })
+}
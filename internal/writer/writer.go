@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bogem/id3v2/v2"
 )
@@ -23,6 +26,10 @@ type TagData struct {
 	Genre   string
 	Track   string
 	Comment string
+	Clear   []string // Fields to remove: title, artist, album, year, genre, track or comment
+
+	Cover         []byte // Front cover image data (optional)
+	CoverMimeType string // image/jpeg or image/png
 }
 
 // New creates a new TagWriter for the specified file
@@ -78,6 +85,13 @@ func (w *TagWriter) SetGenre(genre string) {
 	}
 }
 
+// SetTrack sets the track number tag
+func (w *TagWriter) SetTrack(track string) {
+	if track != "" {
+		w.tag.AddTextFrame(w.tag.CommonID("Track number/Position in set"), id3v2.EncodingUTF8, track)
+	}
+}
+
 // SetComment sets the comment tag
 func (w *TagWriter) SetComment(comment string) {
 	if comment != "" {
@@ -91,8 +105,132 @@ func (w *TagWriter) SetComment(comment string) {
 	}
 }
 
+// fieldFrames lists the frame IDs holding each field; years are TDRC in ID3v2.4 and TYER before
+var fieldFrames = map[string][]string{
+	"title":   {"TIT2"},
+	"artist":  {"TPE1"},
+	"album":   {"TALB"},
+	"year":    {"TDRC", "TYER"},
+	"genre":   {"TCON"},
+	"track":   {"TRCK"},
+	"comment": {"COMM"},
+}
+
+// ClearField removes all frames of a field (title, artist, album, year, genre, track or comment)
+func (w *TagWriter) ClearField(field string) error {
+	ids, ok := fieldFrames[field]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	for _, id := range ids {
+		w.tag.DeleteFrames(id)
+	}
+	return nil
+}
+
+// SetCover sets the front cover picture, replacing any existing front cover
+func (w *TagWriter) SetCover(data []byte, mimeType string) {
+	if len(data) == 0 {
+		return
+	}
+
+	// Keep other picture types (back cover, artist, ...)
+	pictureID := w.tag.CommonID("Attached picture")
+	frames := w.tag.GetFrames(pictureID)
+	w.tag.DeleteFrames(pictureID)
+	for _, frame := range frames {
+		if pic, ok := frame.(id3v2.PictureFrame); ok && pic.PictureType != id3v2.PTFrontCover {
+			w.tag.AddAttachedPicture(pic)
+		}
+	}
+
+	w.tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		MimeType:    mimeType,
+		PictureType: id3v2.PTFrontCover,
+		Description: "Front cover",
+		Picture:     data,
+	})
+}
+
+// SetLyrics sets the unsynchronised lyrics (USLT), replacing any existing ones
+func (w *TagWriter) SetLyrics(lyrics string, language string) {
+	w.tag.DeleteFrames(w.tag.CommonID("Unsynchronised lyrics/text transcription"))
+	if lyrics != "" {
+		w.tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+			Encoding:          id3v2.EncodingUTF8,
+			Language:          language,
+			ContentDescriptor: "",
+			Lyrics:            lyrics,
+		})
+	}
+}
+
+// SetSyncedLyrics sets the synchronised lyrics (SYLT) from an encoded frame body,
+// replacing any existing ones
+func (w *TagWriter) SetSyncedLyrics(body []byte) {
+	w.tag.DeleteFrames("SYLT")
+	if len(body) > 0 {
+		w.tag.AddFrame("SYLT", id3v2.UnknownFrame{Body: body})
+	}
+}
+
+// SetLength sets the audio length in milliseconds (TLEN), replacing any existing value
+func (w *TagWriter) SetLength(length time.Duration) {
+	w.tag.DeleteFrames("TLEN")
+	if length > 0 {
+		w.tag.AddTextFrame("TLEN", id3v2.EncodingUTF8, strconv.FormatInt(length.Milliseconds(), 10))
+	}
+}
+
+// SetChapters sets the chapter frames (CHAP) and their table of contents (CTOC) from encoded
+// frame bodies, replacing any existing ones; no bodies remove them
+func (w *TagWriter) SetChapters(chapters [][]byte, toc []byte) {
+	w.tag.DeleteFrames("CHAP")
+	w.tag.DeleteFrames("CTOC")
+	for _, body := range chapters {
+		w.tag.AddFrame("CHAP", id3v2.UnknownFrame{Body: body})
+	}
+	if len(toc) > 0 {
+		w.tag.AddFrame("CTOC", id3v2.UnknownFrame{Body: toc})
+	}
+}
+
+// SetUserText sets a user-defined text frame (TXXX), replacing frames with the same
+// description (case-insensitive); an empty value removes them
+func (w *TagWriter) SetUserText(description, value string) {
+	frames := w.tag.GetFrames("TXXX")
+	w.tag.DeleteFrames("TXXX")
+	for _, frame := range frames {
+		if udtf, ok := frame.(id3v2.UserDefinedTextFrame); !ok || !strings.EqualFold(udtf.Description, description) {
+			w.tag.AddFrame("TXXX", frame)
+		}
+	}
+
+	if value != "" {
+		w.tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: description,
+			Value:       value,
+		})
+	}
+}
+
+// CopyTags replaces all frames with the frames of another tag
+func (w *TagWriter) CopyTags(from *TagWriter) {
+	w.tag.DeleteAllFrames()
+	for id, frames := range from.tag.AllFrames() {
+		for _, frame := range frames {
+			w.tag.AddFrame(id, frame)
+		}
+	}
+}
+
 // SetAllTags sets all tags at once
 func (w *TagWriter) SetAllTags(data *TagData) {
+	for _, field := range data.Clear {
+		w.ClearField(field)
+	}
 	if data.Title != "" {
 		w.SetTitle(data.Title)
 	}
@@ -108,9 +246,15 @@ func (w *TagWriter) SetAllTags(data *TagData) {
 	if data.Genre != "" {
 		w.SetGenre(data.Genre)
 	}
+	if data.Track != "" {
+		w.SetTrack(data.Track)
+	}
 	if data.Comment != "" {
 		w.SetComment(data.Comment)
 	}
+	if len(data.Cover) > 0 {
+		w.SetCover(data.Cover, data.CoverMimeType)
+	}
 }
 
 // Save writes the tags to the original file
@@ -129,13 +273,6 @@ func (w *TagWriter) SaveTo(destPath string) error {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
-	// Save current tag values before closing
-	title := w.tag.Title()
-	artist := w.tag.Artist()
-	album := w.tag.Album()
-	year := w.tag.Year()
-	genre := w.tag.Genre()
-
 	// Copy original file to destination
 	if err := copyFile(w.filePath, destPath); err != nil {
 		return fmt.Errorf("failed to copy file: %w", err)
@@ -152,11 +289,12 @@ func (w *TagWriter) SaveTo(destPath string) error {
 	destTag.SetVersion(4)
 
 	// Copy all frames
-	destTag.SetTitle(title)
-	destTag.SetArtist(artist)
-	destTag.SetAlbum(album)
-	destTag.SetYear(year)
-	destTag.SetGenre(genre)
+	destTag.DeleteAllFrames()
+	for id, frames := range w.tag.AllFrames() {
+		for _, frame := range frames {
+			destTag.AddFrame(id, frame)
+		}
+	}
 
 	// Save to destination
 	if err := destTag.Save(); err != nil {
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/bogem/id3v2/v2"
 )
 
 func TestNew(t *testing.T) {
@@ -104,3 +106,60 @@ func TestWriteTagsToFile(t *testing.T) {
 	}
 }
 
+func TestSetUserText(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.mp3")
+
+	if err := os.WriteFile(testFile, []byte{}, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	writer, err := New(testFile)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer writer.Close()
+
+	writer.SetUserText("replaygain_track_gain", "+1.00 dB")
+	writer.SetUserText("OTHER", "kept")
+	writer.SetUserText("REPLAYGAIN_TRACK_GAIN", "-2.50 dB")
+
+	values := make(map[string]string)
+	for _, frame := range writer.tag.GetFrames("TXXX") {
+		udtf := frame.(id3v2.UserDefinedTextFrame)
+		values[udtf.Description] = udtf.Value
+	}
+	if len(values) != 2 || values["REPLAYGAIN_TRACK_GAIN"] != "-2.50 dB" || values["OTHER"] != "kept" {
+		t.Errorf("Expected replaced gain and kept frame, got %v", values)
+	}
+
+	writer.SetUserText("replaygain_track_gain", "")
+	if frames := writer.tag.GetFrames("TXXX"); len(frames) != 1 {
+		t.Errorf("Expected empty value to remove the frame, got %d frames", len(frames))
+	}
+}
+
+func TestClearField(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "test.mp3")
+	if err := os.WriteFile(testFile, []byte{}, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	writer, err := New(testFile)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer writer.Close()
+
+	writer.SetAllTags(&TagData{Title: "Title", Year: "2025", Comment: "ad"})
+	writer.SetAllTags(&TagData{Album: "Album", Clear: []string{"year", "comment"}})
+	if writer.tag.Title() != "Title" || writer.tag.Album() != "Album" {
+		t.Errorf("Expected other fields kept, got title %q, album %q", writer.tag.Title(), writer.tag.Album())
+	}
+	if writer.tag.Year() != "" || len(writer.tag.GetFrames("COMM")) != 0 {
+		t.Errorf("Expected year and comment removed, got year %q", writer.tag.Year())
+	}
+	if err := writer.ClearField("rating"); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+}